@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"gitlab.com/nezaysr/go-saham.git/model"
+)
+
+func (c *Client) ListAuditLogs(ctx context.Context, filter model.AuditLogFilter, page int, pageSize int) ([]model.AuditLog, error) {
+	query := pageQuery(page, pageSize)
+	intParam(query, "actor_id", filter.ActorID)
+	intParam(query, "entity_id", filter.EntityID)
+	timeParam(query, "from", filter.From)
+	timeParam(query, "to", filter.To)
+	if filter.EntityType != "" {
+		query.Set("entity_type", filter.EntityType)
+	}
+	if filter.Action != "" {
+		query.Set("action", string(filter.Action))
+	}
+
+	auditLogs := []model.AuditLog{}
+	_, err := c.call(ctx, request{method: http.MethodGet, path: "/api/v1/audit-log", query: query}, &auditLogs)
+	return auditLogs, err
+}
+
+// CacheStats returns the cache counters of the API process that answered.
+func (c *Client) CacheStats(ctx context.Context) (map[string]model.CacheStats, error) {
+	stats := map[string]model.CacheStats{}
+	_, err := c.call(ctx, request{method: http.MethodGet, path: "/api/v1/cache/stats"}, &stats)
+	return stats, err
+}
+
+func exportQuery(format string, filter model.ExportFilter) url.Values {
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+	intParam(query, "user_id", filter.UserID)
+	if filter.Limit > 0 {
+		query.Set("pageSize", strconv.Itoa(filter.Limit))
+		query.Set("page", strconv.Itoa(filter.Page))
+	}
+	return query
+}
+
+// Export streams entity, model.ExportEntityUsers for one, in format to w.
+func (c *Client) Export(ctx context.Context, entity string, format string, filter model.ExportFilter, w io.Writer) error {
+	return c.download(ctx, request{method: http.MethodGet, path: "/api/v1/exports/" + entity, query: exportQuery(format, filter)}, w)
+}
+
+// StartExportJob exports in the background, poll GetExportJob until its
+// Status is model.ExportJobDone.
+func (c *Client) StartExportJob(ctx context.Context, entity string, format string, filter model.ExportFilter) (*model.ExportJob, error) {
+	job := &model.ExportJob{}
+	_, err := c.call(ctx, request{method: http.MethodPost, path: "/api/v1/exports/" + entity + "/jobs", query: exportQuery(format, filter)}, job)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (c *Client) GetExportJob(ctx context.Context, jobID string) (*model.ExportJob, error) {
+	job := &model.ExportJob{}
+	_, err := c.call(ctx, request{method: http.MethodGet, path: "/api/v1/exports/jobs/" + url.PathEscape(jobID)}, job)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (c *Client) DownloadExportJob(ctx context.Context, jobID string, w io.Writer) error {
+	return c.download(ctx, request{method: http.MethodGet, path: "/api/v1/exports/jobs/" + url.PathEscape(jobID) + "/download"}, w)
+}
+
+// Ready returns the health of the database and Redis, with an *Error when the
+// API can't serve.
+func (c *Client) Ready(ctx context.Context) (map[string]string, error) {
+	checks := map[string]string{}
+	_, err := c.call(ctx, request{method: http.MethodGet, path: "/ready"}, &checks)
+	return checks, err
+}
+
+// download copies the body of a route answering with a file to w.
+func (c *Client) download(ctx context.Context, req request, w io.Writer) error {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return decodeError(resp)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
@@ -0,0 +1,253 @@
+// Package client calls the go-saham /api/v1 routes with the payloads and
+// models of the model package.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	sessionCookie     = "session_token"
+	idempotencyHeader = "Idempotency-Key"
+)
+
+// Options configure a Client, the zero value works.
+type Options struct {
+	// HTTPClient sends the requests, http.DefaultClient when nil.
+	HTTPClient *http.Client
+	// Token is a session JWT to start with, Signin replaces it.
+	Token string
+	// Bearer sends the token in an "Authorization: Bearer" header instead of
+	// the session_token cookie.
+	Bearer bool
+	// MaxRetries is how many times a request is retried after a network error,
+	// a 429, 502, 503 or 504, or a 409 for an idempotency key still being
+	// processed. 3 when zero, negative turns retries off.
+	MaxRetries int
+	// RetryWait is the wait before the first retry, doubled for every next
+	// one. 200ms when zero.
+	RetryWait time.Duration
+}
+
+// Client is safe for concurrent use, the session is shared by every call.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	bearer     bool
+	maxRetries int
+	retryWait  time.Duration
+
+	mu    sync.RWMutex
+	token string
+}
+
+func New(baseURL string, options Options) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: options.HTTPClient,
+		bearer:     options.Bearer,
+		maxRetries: options.MaxRetries,
+		retryWait:  options.RetryWait,
+		token:      options.Token,
+	}
+
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+	if c.maxRetries == 0 {
+		c.maxRetries = 3
+	}
+	if c.retryWait == 0 {
+		c.retryWait = 200 * time.Millisecond
+	}
+
+	return c
+}
+
+// Token is the session JWT, empty before Signin.
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+func (c *Client) setToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        []byte
+	contentType string
+}
+
+// envelope is the jsonResponse every JSON route answers with.
+type envelope struct {
+	Error   bool            `json:"error"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func jsonRequest(method string, path string, payload interface{}) (request, error) {
+	req := request{method: method, path: path}
+	if payload == nil {
+		return req, nil
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return req, err
+	}
+	req.body, req.contentType = body, "application/json"
+	return req, nil
+}
+
+// call sends req and decodes the data of the answer into out, when out isn't
+// nil. Answers that aren't 2xx are returned as an *Error.
+func (c *Client) call(ctx context.Context, req request, out interface{}) (*http.Response, error) {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return resp, decodeError(resp)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return resp, nil
+	}
+
+	var body envelope
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return resp, err
+	}
+	if len(body.Data) == 0 {
+		return resp, nil
+	}
+	return resp, json.Unmarshal(body.Data, out)
+}
+
+// do sends req, retrying it as Options say. Writes carry one Idempotency-Key
+// for all their attempts so the API runs them once. The response is returned
+// whatever its status, the caller closes its body.
+func (c *Client) do(ctx context.Context, req request) (*http.Response, error) {
+	idemKey := ""
+	switch req.method {
+	case http.MethodPost, http.MethodPut, http.MethodDelete:
+		idemKey = uuid.New().String()
+	}
+
+	target := c.baseURL + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+
+	wait := c.retryWait
+	for attempt := 0; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, target, bytes.NewReader(req.body))
+		if err != nil {
+			return nil, err
+		}
+		if req.contentType != "" {
+			httpReq.Header.Set("Content-Type", req.contentType)
+		}
+		if idemKey != "" {
+			httpReq.Header.Set(idempotencyHeader, idemKey)
+		}
+		if token := c.Token(); token != "" {
+			if c.bearer {
+				httpReq.Header.Set("Authorization", "Bearer "+token)
+			} else {
+				httpReq.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+			}
+		}
+
+		resp, err := c.httpClient.Do(httpReq)
+		if attempt >= c.maxRetries || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		if resp != nil {
+			if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && retryAfter > 0 {
+				wait = time.Duration(retryAfter) * time.Second
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		// Up to a quarter more, so clients that failed together don't all
+		// come back together.
+		jitter := time.Duration(rand.Int63n(int64(wait)/4 + 1))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait + jitter):
+		}
+		wait *= 2
+	}
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		// A cancelled or expired context won't get better.
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusConflict:
+		// Another attempt with the same key is still running, its answer will
+		// be replayed once it is done.
+		return isIdempotencyInProgress(resp)
+	}
+	return false
+}
+
+func pageQuery(page int, pageSize int) url.Values {
+	query := url.Values{}
+	if page > 0 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if pageSize > 0 {
+		query.Set("pageSize", strconv.Itoa(pageSize))
+	}
+	return query
+}
+
+// createdID is the id at the end of the Location header of a 201.
+func createdID(resp *http.Response) (int, error) {
+	location := resp.Header.Get("Location")
+	return strconv.Atoi(location[strings.LastIndex(location, "/")+1:])
+}
+
+func timeParam(query url.Values, name string, t *time.Time) {
+	if t != nil {
+		query.Set(name, t.Format(time.RFC3339))
+	}
+}
+
+func intParam(query url.Values, name string, i *int) {
+	if i != nil {
+		query.Set(name, strconv.Itoa(*i))
+	}
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"gitlab.com/nezaysr/go-saham.git/model"
+)
+
+// Error is an answer of the API that isn't 2xx. Kind and Code are the ones of
+// the *model.Error the API answered with, so
+// errors.Is(err, model.ErrUserRetired) works the same on both sides.
+type Error struct {
+	Kind      model.ErrorKind
+	Status    int
+	Code      string
+	Message   string
+	Fields    []model.FieldError
+	RequestID string
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Code + ": " + e.Message
+	}
+	return e.Code
+}
+
+// Is matches an *Error or a *model.Error with the same Code.
+func (e *Error) Is(target error) bool {
+	switch t := target.(type) {
+	case *Error:
+		return t.Code == e.Code
+	case *model.Error:
+		return t.Code == e.Code
+	}
+	return false
+}
+
+var kindByStatus = map[int]model.ErrorKind{
+	http.StatusBadRequest:          model.KindBadRequest,
+	http.StatusUnprocessableEntity: model.KindValidation,
+	http.StatusUnauthorized:        model.KindUnauthorized,
+	http.StatusForbidden:           model.KindForbidden,
+	http.StatusNotFound:            model.KindNotFound,
+	http.StatusConflict:            model.KindConflict,
+	http.StatusServiceUnavailable:  model.KindUnavailable,
+	http.StatusNotImplemented:      model.KindNotImplemented,
+}
+
+// problem is the application/problem+json body of the API's errors.
+type problem struct {
+	Title     string             `json:"title"`
+	Status    int                `json:"status"`
+	Detail    string             `json:"detail"`
+	Code      string             `json:"code"`
+	RequestID string             `json:"request_id"`
+	Errors    []model.FieldError `json:"errors"`
+}
+
+// decodeError reads the problem in resp. Answers that aren't one, from a proxy
+// in front of the API say, get a Code made from their status.
+func decodeError(resp *http.Response) *Error {
+	e := &Error{
+		Kind:      kindByStatus[resp.StatusCode],
+		Status:    resp.StatusCode,
+		Code:      strings.ReplaceAll(strings.ToLower(http.StatusText(resp.StatusCode)), " ", "_"),
+		RequestID: resp.Header.Get("X-Request-Id"),
+	}
+
+	var p problem
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&p); err != nil || p.Code == "" {
+		return e
+	}
+
+	e.Code, e.Message, e.Fields = p.Code, p.Detail, p.Errors
+	if p.RequestID != "" {
+		e.RequestID = p.RequestID
+	}
+	return e
+}
+
+// isIdempotencyInProgress peeks at the body of a 409, leaving it readable.
+func isIdempotencyInProgress(resp *http.Response) bool {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	var p problem
+	return json.Unmarshal(body, &p) == nil && p.Code == "idempotency_key_in_progress"
+}
+
+// ErrorKindOf returns the kind of an *Error or a *model.Error in err's chain,
+// model.KindInternal for anything else.
+func ErrorKindOf(err error) model.ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return model.ErrorKindOf(err)
+}
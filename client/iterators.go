@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+
+	"gitlab.com/nezaysr/go-saham.git/model"
+)
+
+// pager walks the pages of a list route. fetch loads a page and says how many
+// rows it had, a page shorter than pageSize is the last one.
+type pager struct {
+	pageSize int
+	page     int
+	rows     int
+	index    int
+	done     bool
+	err      error
+	fetch    func(page int) (int, error)
+}
+
+func newPager(pageSize int, fetch func(page int) (int, error)) pager {
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+	return pager{pageSize: pageSize, index: -1, fetch: fetch}
+}
+
+// Next moves to the next row, loading the next page when needed. It returns
+// false after the last row or on an error, see Err.
+func (p *pager) Next() bool {
+	p.index++
+	if p.index < p.rows {
+		return true
+	}
+	if p.done || p.err != nil {
+		return false
+	}
+
+	p.page++
+	p.index = 0
+	p.rows, p.err = p.fetch(p.page)
+	if p.err != nil || p.rows == 0 {
+		p.done = true
+		return false
+	}
+	if p.rows < p.pageSize {
+		p.done = true
+	}
+	return true
+}
+
+// Err is the error that stopped Next, if any.
+func (p *pager) Err() error {
+	return p.err
+}
+
+type UserIterator struct {
+	pager
+	users []model.Users
+}
+
+// User is the current row, call Next first.
+func (it *UserIterator) User() model.Users {
+	return it.users[it.index]
+}
+
+// Users walks every user, pageSize at a time.
+func (c *Client) Users(ctx context.Context, pageSize int) *UserIterator {
+	it := &UserIterator{}
+	it.pager = newPager(pageSize, func(page int) (int, error) {
+		var err error
+		it.users, err = c.ListUsers(ctx, page, it.pageSize)
+		return len(it.users), err
+	})
+	return it
+}
+
+type OrderItemIterator struct {
+	pager
+	orderItems []model.OrdersItem
+}
+
+func (it *OrderItemIterator) OrderItem() model.OrdersItem {
+	return it.orderItems[it.index]
+}
+
+func (c *Client) OrderItems(ctx context.Context, pageSize int) *OrderItemIterator {
+	it := &OrderItemIterator{}
+	it.pager = newPager(pageSize, func(page int) (int, error) {
+		var err error
+		it.orderItems, err = c.ListOrderItems(ctx, page, it.pageSize)
+		return len(it.orderItems), err
+	})
+	return it
+}
+
+type OrderHistoryIterator struct {
+	pager
+	orderHistories []model.OrdersHistories
+}
+
+func (it *OrderHistoryIterator) OrderHistory() model.OrdersHistories {
+	return it.orderHistories[it.index]
+}
+
+// Orders walks the signed in user's orders.
+func (c *Client) Orders(ctx context.Context, pageSize int) *OrderHistoryIterator {
+	it := &OrderHistoryIterator{}
+	it.pager = newPager(pageSize, func(page int) (int, error) {
+		var err error
+		it.orderHistories, err = c.ListOrders(ctx, page, it.pageSize)
+		return len(it.orderHistories), err
+	})
+	return it
+}
+
+// OrderHistories walks everyone's order histories.
+func (c *Client) OrderHistories(ctx context.Context, pageSize int) *OrderHistoryIterator {
+	it := &OrderHistoryIterator{}
+	it.pager = newPager(pageSize, func(page int) (int, error) {
+		var err error
+		it.orderHistories, err = c.ListOrderHistories(ctx, page, it.pageSize)
+		return len(it.orderHistories), err
+	})
+	return it
+}
+
+func (c *Client) ArchivedOrderHistories(ctx context.Context, filter model.ArchivedOrderHistoryFilter, pageSize int) *OrderHistoryIterator {
+	it := &OrderHistoryIterator{}
+	it.pager = newPager(pageSize, func(page int) (int, error) {
+		var err error
+		it.orderHistories, err = c.ListArchivedOrderHistories(ctx, filter, page, it.pageSize)
+		return len(it.orderHistories), err
+	})
+	return it
+}
+
+type AuditLogIterator struct {
+	pager
+	auditLogs []model.AuditLog
+}
+
+func (it *AuditLogIterator) AuditLog() model.AuditLog {
+	return it.auditLogs[it.index]
+}
+
+func (c *Client) AuditLogs(ctx context.Context, filter model.AuditLogFilter, pageSize int) *AuditLogIterator {
+	it := &AuditLogIterator{}
+	it.pager = newPager(pageSize, func(page int) (int, error) {
+		var err error
+		it.auditLogs, err = c.ListAuditLogs(ctx, filter, page, it.pageSize)
+		return len(it.auditLogs), err
+	})
+	return it
+}
+
+type ErasureRequestIterator struct {
+	pager
+	erasureRequests []model.ErasureRequest
+}
+
+func (it *ErasureRequestIterator) ErasureRequest() model.ErasureRequest {
+	return it.erasureRequests[it.index]
+}
+
+func (c *Client) ErasureRequests(ctx context.Context, pageSize int) *ErasureRequestIterator {
+	it := &ErasureRequestIterator{}
+	it.pager = newPager(pageSize, func(page int) (int, error) {
+		var err error
+		it.erasureRequests, err = c.ListErasureRequests(ctx, page, it.pageSize)
+		return len(it.erasureRequests), err
+	})
+	return it
+}
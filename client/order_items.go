@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"gitlab.com/nezaysr/go-saham.git/model"
+)
+
+var importContentTypes = map[string]string{
+	model.ImportFormatCSV:    "text/csv",
+	model.ImportFormatNDJSON: "application/x-ndjson",
+}
+
+func (c *Client) ListOrderItems(ctx context.Context, page int, pageSize int) ([]model.OrdersItem, error) {
+	orderItems := []model.OrdersItem{}
+	_, err := c.call(ctx, request{method: http.MethodGet, path: "/api/v1/order-items", query: pageQuery(page, pageSize)}, &orderItems)
+	return orderItems, err
+}
+
+func (c *Client) GetOrderItem(ctx context.Context, orderItemID int) (*model.OrdersItem, error) {
+	orderItem := &model.OrdersItem{}
+	_, err := c.call(ctx, request{method: http.MethodGet, path: "/api/v1/order-items/" + strconv.Itoa(orderItemID)}, orderItem)
+	if err != nil {
+		return nil, err
+	}
+	return orderItem, nil
+}
+
+// CreateOrderItem returns the id of the new order item.
+func (c *Client) CreateOrderItem(ctx context.Context, orderItem model.InsertOrderItemPayload) (int, error) {
+	req, err := jsonRequest(http.MethodPost, "/api/v1/order-items", orderItem)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.call(ctx, req, nil)
+	if err != nil {
+		return 0, err
+	}
+	return createdID(resp)
+}
+
+// UpdateOrderItem replaces the order item, its ID is ignored.
+func (c *Client) UpdateOrderItem(ctx context.Context, orderItemID int, orderItem model.UpdateOrderItemPayload) error {
+	orderItem.ID = orderItemID
+	req, err := jsonRequest(http.MethodPut, "/api/v1/order-items/"+strconv.Itoa(orderItemID), orderItem)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.call(ctx, req, nil)
+	return err
+}
+
+func (c *Client) DeleteOrderItem(ctx context.Context, orderItemID int) error {
+	_, err := c.call(ctx, request{method: http.MethodDelete, path: "/api/v1/order-items/" + strconv.Itoa(orderItemID)}, nil)
+	return err
+}
+
+// ImportOrderItems sends rows in options.Format, model.ImportFormatCSV or
+// model.ImportFormatNDJSON. When rows are invalid the report lists them along
+// with an *Error coded "import_rows_invalid".
+func (c *Client) ImportOrderItems(ctx context.Context, rows io.Reader, options model.ImportOrderItemsOptions) (*model.ImportReport, error) {
+	body, err := io.ReadAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("format", options.Format)
+	query.Set("dry_run", strconv.FormatBool(options.DryRun))
+	query.Set("upsert", strconv.FormatBool(options.Upsert))
+
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/order-items/import", query: query, body: body, contentType: importContentTypes[options.Format]})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Invalid rows are answered with the report in a jsonResponse, not a
+	// problem.
+	if resp.StatusCode >= http.StatusBadRequest && resp.Header.Get("Content-Type") != "application/json" {
+		return nil, decodeError(resp)
+	}
+
+	var answer envelope
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, err
+	}
+
+	report := &model.ImportReport{}
+	if err := json.Unmarshal(answer.Data, report); err != nil {
+		return nil, err
+	}
+
+	if answer.Error {
+		return report, &Error{
+			Kind:      kindByStatus[resp.StatusCode],
+			Status:    resp.StatusCode,
+			Code:      "import_rows_invalid",
+			Message:   answer.Message,
+			RequestID: resp.Header.Get("X-Request-Id"),
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"gitlab.com/nezaysr/go-saham.git/model"
+)
+
+// ListOrders lists the signed in user's orders.
+func (c *Client) ListOrders(ctx context.Context, page int, pageSize int) ([]model.OrdersHistories, error) {
+	orderHistories := []model.OrdersHistories{}
+	_, err := c.call(ctx, request{method: http.MethodGet, path: "/api/v1/orders", query: pageQuery(page, pageSize)}, &orderHistories)
+	return orderHistories, err
+}
+
+// Buy orders an order item for the signed in user, descriptions can be nil.
+func (c *Client) Buy(ctx context.Context, orderItemID int, descriptions *string) error {
+	req, err := jsonRequest(http.MethodPost, "/api/v1/orders", struct {
+		OrderItemId  int     `json:"order_item_id"`
+		Descriptions *string `json:"descriptions,omitempty"`
+	}{orderItemID, descriptions})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.call(ctx, req, nil)
+	return err
+}
+
+// RemoveOrder removes one of the signed in user's orders.
+func (c *Client) RemoveOrder(ctx context.Context, orderHistoryID int) error {
+	_, err := c.call(ctx, request{method: http.MethodDelete, path: "/api/v1/orders/" + strconv.Itoa(orderHistoryID)}, nil)
+	return err
+}
+
+// ListOrderHistories lists everyone's order histories.
+func (c *Client) ListOrderHistories(ctx context.Context, page int, pageSize int) ([]model.OrdersHistories, error) {
+	orderHistories := []model.OrdersHistories{}
+	_, err := c.call(ctx, request{method: http.MethodGet, path: "/api/v1/order-histories", query: pageQuery(page, pageSize)}, &orderHistories)
+	return orderHistories, err
+}
+
+func (c *Client) ListArchivedOrderHistories(ctx context.Context, filter model.ArchivedOrderHistoryFilter, page int, pageSize int) ([]model.OrdersHistories, error) {
+	query := pageQuery(page, pageSize)
+	intParam(query, "user_id", filter.UserID)
+	timeParam(query, "from", filter.From)
+	timeParam(query, "to", filter.To)
+
+	orderHistories := []model.OrdersHistories{}
+	_, err := c.call(ctx, request{method: http.MethodGet, path: "/api/v1/order-histories/archive", query: query}, &orderHistories)
+	return orderHistories, err
+}
+
+// ArchiveOrderHistories archives the partitions older than olderThanMonths,
+// the API's default when zero, and returns their names.
+func (c *Client) ArchiveOrderHistories(ctx context.Context, olderThanMonths int) ([]string, error) {
+	query := url.Values{}
+	if olderThanMonths > 0 {
+		query.Set("older_than_months", strconv.Itoa(olderThanMonths))
+	}
+
+	archived := []string{}
+	_, err := c.call(ctx, request{method: http.MethodPost, path: "/api/v1/order-histories/archive", query: query}, &archived)
+	return archived, err
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"gitlab.com/nezaysr/go-saham.git/model"
+)
+
+// Signin starts a session, later calls are made as that user.
+func (c *Client) Signin(ctx context.Context, username string, password string) error {
+	req, err := jsonRequest(http.MethodPost, "/api/v1/auth/signin", model.SigninPayload{Username: username, Password: password})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.call(ctx, req, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == sessionCookie {
+			c.setToken(cookie.Value)
+		}
+	}
+	return nil
+}
+
+// Signout forgets the session. The JWT stays valid until it expires.
+func (c *Client) Signout(ctx context.Context) error {
+	_, err := c.call(ctx, request{method: http.MethodPost, path: "/api/v1/auth/signout"}, nil)
+	c.setToken("")
+	return err
+}
+
+func (c *Client) ListUsers(ctx context.Context, page int, pageSize int) ([]model.Users, error) {
+	users := []model.Users{}
+	_, err := c.call(ctx, request{method: http.MethodGet, path: "/api/v1/users", query: pageQuery(page, pageSize)}, &users)
+	return users, err
+}
+
+func (c *Client) GetUser(ctx context.Context, userID int) (*model.Users, error) {
+	user := &model.Users{}
+	_, err := c.call(ctx, request{method: http.MethodGet, path: "/api/v1/users/" + strconv.Itoa(userID)}, user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// CreateUser returns the id of the new user and its generated password.
+func (c *Client) CreateUser(ctx context.Context, username string, fullname string) (int, string, error) {
+	req, err := jsonRequest(http.MethodPost, "/api/v1/users", model.InsertUserPayload{Username: username, Fullname: fullname})
+	if err != nil {
+		return 0, "", err
+	}
+
+	var password string
+	resp, err := c.call(ctx, req, &password)
+	if err != nil {
+		return 0, "", err
+	}
+
+	userID, err := createdID(resp)
+	return userID, password, err
+}
+
+// UpdateUser changes the fields of user that aren't nil, its ID is ignored.
+func (c *Client) UpdateUser(ctx context.Context, userID int, user model.UpdateUserPayload) error {
+	user.ID = userID
+	req, err := jsonRequest(http.MethodPut, "/api/v1/users/"+strconv.Itoa(userID), user)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.call(ctx, req, nil)
+	return err
+}
+
+func (c *Client) DeleteUser(ctx context.Context, userID int) error {
+	_, err := c.call(ctx, request{method: http.MethodDelete, path: "/api/v1/users/" + strconv.Itoa(userID)}, nil)
+	return err
+}
+
+// UserData returns everything stored about a user.
+func (c *Client) UserData(ctx context.Context, userID int) (*model.UserDataBundle, error) {
+	bundle := &model.UserDataBundle{}
+	_, err := c.call(ctx, request{method: http.MethodGet, path: "/api/v1/users/" + strconv.Itoa(userID) + "/data"}, bundle)
+	if err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// UserDataZip writes the ZIP of everything stored about a user to w.
+func (c *Client) UserDataZip(ctx context.Context, userID int, w io.Writer) error {
+	return c.download(ctx, request{method: http.MethodGet, path: "/api/v1/users/" + strconv.Itoa(userID) + "/data", query: url.Values{"format": {"zip"}}}, w)
+}
+
+func (c *Client) RequestErasure(ctx context.Context, userID int, reason string) (*model.ErasureRequest, error) {
+	req, err := jsonRequest(http.MethodPost, "/api/v1/users/"+strconv.Itoa(userID)+"/erasure-requests", model.InsertErasureRequestPayload{UserId: userID, Reason: reason})
+	if err != nil {
+		return nil, err
+	}
+
+	erasureRequest := &model.ErasureRequest{}
+	if _, err := c.call(ctx, req, erasureRequest); err != nil {
+		return nil, err
+	}
+	return erasureRequest, nil
+}
+
+func (c *Client) ListErasureRequests(ctx context.Context, page int, pageSize int) ([]model.ErasureRequest, error) {
+	erasureRequests := []model.ErasureRequest{}
+	_, err := c.call(ctx, request{method: http.MethodGet, path: "/api/v1/erasure-requests", query: pageQuery(page, pageSize)}, &erasureRequests)
+	return erasureRequests, err
+}
+
+// ApproveErasure runs the erasure, it has to be requested by another admin.
+func (c *Client) ApproveErasure(ctx context.Context, erasureRequestID int) (*model.ErasureRequest, error) {
+	return c.decideErasure(ctx, erasureRequestID, "approve")
+}
+
+func (c *Client) RejectErasure(ctx context.Context, erasureRequestID int) (*model.ErasureRequest, error) {
+	return c.decideErasure(ctx, erasureRequestID, "reject")
+}
+
+func (c *Client) decideErasure(ctx context.Context, erasureRequestID int, decision string) (*model.ErasureRequest, error) {
+	erasureRequest := &model.ErasureRequest{}
+	_, err := c.call(ctx, request{method: http.MethodPost, path: "/api/v1/erasure-requests/" + strconv.Itoa(erasureRequestID) + "/" + decision}, erasureRequest)
+	if err != nil {
+		return nil, err
+	}
+	return erasureRequest, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"gitlab.com/nezaysr/go-saham.git/client"
+	"gitlab.com/nezaysr/go-saham.git/config"
+	"gitlab.com/nezaysr/go-saham.git/model"
+)
+
+// newClientServer serves the real routes, with Redis in process, and calls
+// intercept, when set, before them.
+func newClientServer(t *testing.T, intercept func(w http.ResponseWriter, r *http.Request, next http.Handler) bool) *httptest.Server {
+	t.Helper()
+
+	redis := miniredis.RunT(t)
+	rdb, err := config.NewDatabase(redis.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTestServer(t, rdb)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if intercept != nil && intercept(w, r, e) {
+			return
+		}
+		e.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientAuthenticatesWithCookieOrBearer(t *testing.T) {
+	var mu sync.Mutex
+	var seen []*http.Request
+	server := newClientServer(t, func(w http.ResponseWriter, r *http.Request, next http.Handler) bool {
+		mu.Lock()
+		seen = append(seen, r.Clone(context.Background()))
+		mu.Unlock()
+		return false
+	})
+
+	for _, bearer := range []bool{false, true} {
+		mu.Lock()
+		seen = nil
+		mu.Unlock()
+
+		c := client.New(server.URL, client.Options{Bearer: bearer})
+		if _, err := c.GetUser(context.Background(), 1); client.ErrorKindOf(err) != model.KindUnauthorized {
+			t.Errorf("bearer %t: GetUser before Signin got %v, want unauthorized", bearer, err)
+		}
+
+		if err := c.Signin(context.Background(), "admin", "admin"); err != nil {
+			t.Fatalf("bearer %t: %v", bearer, err)
+		}
+		user, err := c.GetUser(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("bearer %t: %v", bearer, err)
+		}
+		if user.Username != "admin" {
+			t.Errorf("bearer %t: got user %q, want admin", bearer, user.Username)
+		}
+
+		mu.Lock()
+		last := seen[len(seen)-1]
+		mu.Unlock()
+		_, cookieErr := last.Cookie("session_token")
+		if bearer && (cookieErr == nil || !strings.HasPrefix(last.Header.Get("Authorization"), "Bearer ")) {
+			t.Errorf("bearer client sent Authorization %q and cookie error %v", last.Header.Get("Authorization"), cookieErr)
+		}
+		if !bearer && (cookieErr != nil || last.Header.Get("Authorization") != "") {
+			t.Errorf("cookie client sent Authorization %q and cookie error %v", last.Header.Get("Authorization"), cookieErr)
+		}
+	}
+}
+
+func TestClientIteratorsWalkEveryPage(t *testing.T) {
+	server := newClientServer(t, nil)
+	c := client.New(server.URL, client.Options{})
+	if err := c.Signin(context.Background(), "admin", "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int]bool{}
+	for i := 0; i < 5; i++ {
+		id, err := c.CreateOrderItem(context.Background(), model.InsertOrderItemPayload{
+			Name:      fmt.Sprintf("ITER%d", i),
+			Price:     100 + i,
+			ExpiredAt: time.Now().Add(24 * time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[id] = true
+	}
+
+	all, err := c.ListOrderItems(context.Background(), 1, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := 0
+	it := c.OrderItems(context.Background(), 2)
+	for it.Next() {
+		delete(want, it.OrderItem().ID)
+		got++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got != len(all) {
+		t.Errorf("iterator returned %d order items over pages of 2, the list has %d", got, len(all))
+	}
+	if len(want) > 0 {
+		t.Errorf("iterator missed order items %v", want)
+	}
+}
+
+func TestClientRetriesWithTheSameIdempotencyKey(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	var replayed string
+	server := newClientServer(t, func(w http.ResponseWriter, r *http.Request, next http.Handler) bool {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/order-items" {
+			return false
+		}
+
+		mu.Lock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		attempt := len(keys)
+		mu.Unlock()
+
+		if attempt > 1 {
+			rec := httptest.NewRecorder()
+			next.ServeHTTP(rec, r)
+			replayed = rec.Header().Get("Idempotent-Replayed")
+			for k, v := range rec.Header() {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.Code)
+			w.Write(rec.Body.Bytes())
+			return true
+		}
+
+		// The first attempt is created but its answer is lost on the way back.
+		next.ServeHTTP(httptest.NewRecorder(), r)
+		w.WriteHeader(http.StatusBadGateway)
+		return true
+	})
+
+	c := client.New(server.URL, client.Options{RetryWait: time.Millisecond})
+	if err := c.Signin(context.Background(), "admin", "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := c.CreateOrderItem(context.Background(), model.InsertOrderItemPayload{Name: "RETRY", Price: 100, ExpiredAt: time.Now().Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Fatalf("got Idempotency-Keys %q, want the same key twice", keys)
+	}
+	if replayed != "true" {
+		t.Errorf("the retry wasn't answered from the stored response")
+	}
+
+	orderItems, err := c.ListOrderItems(context.Background(), 1, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := 0
+	for _, orderItem := range orderItems {
+		if orderItem.Name == "RETRY" {
+			created++
+			if orderItem.ID != id {
+				t.Errorf("created order item %d, the retry answered %d", orderItem.ID, id)
+			}
+		}
+	}
+	if created != 1 {
+		t.Errorf("got %d RETRY order items, want 1", created)
+	}
+}
+
+func TestClientErrorsMatchTheAPIErrors(t *testing.T) {
+	server := newClientServer(t, nil)
+	c := client.New(server.URL, client.Options{})
+
+	err := c.Signin(context.Background(), "admin", "wrong password")
+	if !errors.Is(err, model.ErrInvalidCredentials) {
+		t.Errorf("got %v, want errors.Is model.ErrInvalidCredentials", err)
+	}
+	if kind := client.ErrorKindOf(err); kind != model.KindUnauthorized {
+		t.Errorf("got kind %v, want unauthorized", kind)
+	}
+
+	if err := c.Signin(context.Background(), "admin", "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.GetUser(context.Background(), 999999)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound || apiErr.Code != "user_not_found" {
+		t.Errorf("got %#v, want a 404 user_not_found *client.Error", err)
+	}
+	if kind := client.ErrorKindOf(err); kind != model.KindNotFound {
+		t.Errorf("got kind %v, want not found", kind)
+	}
+
+	erasure, err := c.RequestErasure(context.Background(), 1, "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.ApproveErasure(context.Background(), erasure.ID)
+	if !errors.Is(err, model.ErrErasureSelfApproval) {
+		t.Errorf("got %v, want errors.Is model.ErrErasureSelfApproval", err)
+	}
+	if errors.Is(err, model.ErrUserRetired) {
+		t.Errorf("%v matches an unrelated error", err)
+	}
+
+	_, err = c.CreateOrderItem(context.Background(), model.InsertOrderItemPayload{Name: "INVALID"})
+	if !errors.As(err, &apiErr) || apiErr.Kind != model.KindValidation || len(apiErr.Fields) == 0 {
+		t.Errorf("got %#v, want a validation *client.Error with its fields", err)
+	}
+}
+
+func TestClientDoesNotDependOnTheServer(t *testing.T) {
+	out, err := exec.Command("go", "list", "-deps", "gitlab.com/nezaysr/go-saham.git/client").Output()
+	if err != nil {
+		t.Skipf("go list: %v", err)
+	}
+
+	for _, dep := range strings.Fields(string(out)) {
+		switch {
+		case strings.HasPrefix(dep, "gitlab.com/nezaysr/go-saham.git/") && dep != "gitlab.com/nezaysr/go-saham.git/model" && dep != "gitlab.com/nezaysr/go-saham.git/client",
+			strings.Contains(dep, "gorm"), dep == "database/sql":
+			t.Errorf("the client depends on %s", dep)
+		}
+	}
+}
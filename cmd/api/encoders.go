@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vmihailenco/msgpack/v5"
+	data "gitlab.com/nezaysr/go-saham.git/data"
+	"gitlab.com/nezaysr/go-saham.git/grpcapi"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// responseEncoder writes the answers of writeResponse in one format. The first
+// of mediaTypes is the Content-Type, the others are aliases clients send.
+type responseEncoder struct {
+	mediaTypes []string
+	// rich encoders get a richResponse, the others a jsonResponse.
+	rich bool
+	// lists encoders can only write payloads whose data is a list.
+	lists  bool
+	encode func(w io.Writer, body interface{}) error
+}
+
+// responseEncoders are tried in order for wildcards in Accept, so JSON stays
+// the default.
+var responseEncoders = []responseEncoder{
+	{mediaTypes: []string{"application/json"}, encode: encodeJSON},
+	{mediaTypes: []string{richEnvelopeMediaType}, rich: true, encode: encodeJSON},
+	{mediaTypes: []string{"text/csv"}, lists: true, encode: encodeCSV},
+	{mediaTypes: []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}, encode: encodeMsgpack},
+	{mediaTypes: []string{"application/x-protobuf", "application/protobuf"}, encode: encodeProtobuf},
+}
+
+type acceptedRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept returns the media ranges of an Accept header, most preferred
+// first. Ranges with q=0 are left out.
+func parseAccept(header string) []acceptedRange {
+	ranges := []acceptedRange{}
+	for _, accepted := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if qParam, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qParam, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptedRange{mediaType: mediaType, q: q})
+		}
+	}
+
+	// Ties go to the most specific range, text/csv before text/* before */*.
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+	return ranges
+}
+
+func (e *responseEncoder) matches(mediaRange string) bool {
+	for _, mediaType := range e.mediaTypes {
+		if mediaRange == "*/*" || mediaRange == mediaType {
+			return true
+		}
+		if strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoder picks the encoder of the most preferred media type in
+// Accept that can write payload, JSON when there is no Accept header.
+func negotiateEncoder(c echo.Context, payload jsonResponse) (*responseEncoder, error) {
+	header := c.Request().Header.Get(echo.HeaderAccept)
+	if strings.TrimSpace(header) == "" {
+		return &responseEncoders[0], nil
+	}
+
+	if encoder := acceptedEncoder(header, isList(payload.Data)); encoder != nil {
+		return encoder, nil
+	}
+	return nil, errNotAcceptable(isList(payload.Data))
+}
+
+// acceptedEncoder is the encoder of the most preferred media type in header,
+// nil when none of them can be written. list says whether the data is a list.
+func acceptedEncoder(header string, list bool) *responseEncoder {
+	for _, accepted := range parseAccept(header) {
+		for i := range responseEncoders {
+			encoder := &responseEncoders[i]
+			if encoder.matches(accepted.mediaType) && (!encoder.lists || list) {
+				return encoder
+			}
+		}
+	}
+	return nil
+}
+
+func errNotAcceptable(list bool) error {
+	mediaTypes := []string{}
+	for _, encoder := range responseEncoders {
+		if !encoder.lists || list {
+			mediaTypes = append(mediaTypes, encoder.mediaTypes[0])
+		}
+	}
+	return echo.NewHTTPError(http.StatusNotAcceptable, "this answer can be written as "+strings.Join(mediaTypes, ", "))
+}
+
+// AcceptMiddleware answers 406 before the handler runs when none of the media
+// types in Accept can write the route's answer, so a write isn't made for a
+// client that can't read its result. The answer is known from routeDocs;
+// routes answering with a file or with no content negotiate themselves.
+func AcceptMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		header := c.Request().Header.Get(echo.HeaderAccept)
+		if strings.TrimSpace(header) == "" {
+			return next(c)
+		}
+
+		doc, ok := routeDocFor(c.Request().Method, c.Path())
+		if !ok || len(doc.Produces) > 0 || doc.Status == http.StatusNoContent {
+			return next(c)
+		}
+
+		list := isList(doc.Response)
+		if acceptedEncoder(header, list) == nil {
+			c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+			return errNotAcceptable(list)
+		}
+		return next(c)
+	}
+}
+
+func isList(value interface{}) bool {
+	if projection, ok := value.(projected); ok {
+		return projection.list
+	}
+
+	v := reflect.ValueOf(value)
+	return v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8
+}
+
+func encodeJSON(w io.Writer, body interface{}) error {
+	o, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(o)
+	return err
+}
+
+// genericJSON is value as encoding/json would write it, decoded into maps,
+// slices and numbers, so the other formats carry the same fields as JSON.
+func genericJSON(value interface{}) (interface{}, error) {
+	o, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(o))
+	d.UseNumber()
+
+	var generic interface{}
+	if err := d.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return withNumbers(generic), nil
+}
+
+// withNumbers turns the json.Numbers of a decoded value into int64 or float64.
+func withNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		n, _ := v.Float64()
+		return n
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = withNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = withNumbers(item)
+		}
+	}
+	return value
+}
+
+func encodeMsgpack(w io.Writer, body interface{}) error {
+	generic, err := genericJSON(body)
+	if err != nil {
+		return err
+	}
+
+	encoder := msgpack.NewEncoder(w)
+	encoder.SetSortMapKeys(true)
+	return encoder.Encode(generic)
+}
+
+// encodeCSV writes the rows of a list, one column per JSON field in the order
+// of the struct or of ?fields=. Nested values are written as JSON.
+func encodeCSV(w io.Writer, body interface{}) error {
+	payload := body.(jsonResponse)
+
+	generic, err := genericJSON(payload.Data)
+	if err != nil {
+		return err
+	}
+	rows, _ := generic.([]interface{})
+
+	var columns []string
+	if projection, ok := payload.Data.(projected); ok {
+		columns = projection.columns
+	} else {
+		columns = jsonFieldNames(reflect.TypeOf(payload.Data).Elem())
+	}
+	writer := csv.NewWriter(w)
+	if columns == nil {
+		if err := writer.Write([]string{"value"}); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := writer.Write([]string{csvCell(row)}); err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := writer.Write(columns); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			fields, _ := row.(map[string]interface{})
+			record := make([]string, len(columns))
+			for i, column := range columns {
+				record[i] = csvCell(fields[column])
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return data.EscapeCSVCell(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	o, _ := json.Marshal(value)
+	return string(o)
+}
+
+// encodeProtobuf writes a grpcapi.Response, with the messages of the gRPC API
+// for users, order items and order histories.
+func encodeProtobuf(w io.Writer, body interface{}) error {
+	payload := body.(jsonResponse)
+	response := &grpcapi.Response{Error: payload.Error, Message: payload.Message}
+
+	switch value := payload.Data.(type) {
+	case nil:
+	case *data.Users:
+		response.Data = &grpcapi.Response_User{User: toGRPCUser(value)}
+	case []data.Users:
+		users := &grpcapi.ListUsersResponse{}
+		for i := range value {
+			users.Users = append(users.Users, toGRPCUser(&value[i]))
+		}
+		response.Data = &grpcapi.Response_Users{Users: users}
+	case *data.OrdersItem:
+		response.Data = &grpcapi.Response_OrderItem{OrderItem: toGRPCOrderItem(value)}
+	case []data.OrdersItem:
+		orderItems := &grpcapi.ListOrderItemsResponse{}
+		for i := range value {
+			orderItems.OrderItems = append(orderItems.OrderItems, toGRPCOrderItem(&value[i]))
+		}
+		response.Data = &grpcapi.Response_OrderItems{OrderItems: orderItems}
+	case *data.OrdersHistories:
+		response.Data = &grpcapi.Response_OrderHistory{OrderHistory: toGRPCOrderHistory(value)}
+	case []data.OrdersHistories:
+		orderHistories := &grpcapi.OrderHistoryList{}
+		for i := range value {
+			orderHistories.OrderHistories = append(orderHistories.OrderHistories, toGRPCOrderHistory(&value[i]))
+		}
+		response.Data = &grpcapi.Response_OrderHistories{OrderHistories: orderHistories}
+	default:
+		generic, err := genericJSON(value)
+		if err != nil {
+			return err
+		}
+
+		structValue, err := structpb.NewValue(generic)
+		if err != nil {
+			return err
+		}
+		response.Data = &grpcapi.Response_Value{Value: structValue}
+	}
+
+	o, err := proto.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(o)
+	return err
+}
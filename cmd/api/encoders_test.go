@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestUnsupportedAcceptIsRejectedBeforeTheHandler(t *testing.T) {
+	e := newTestServer(t, nil)
+	cookies := signinCookies(t, e)
+
+	serve := func(method string, target string, accept string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAccept, accept)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := `{"name":"NOT_ACCEPTED","price":100,"expired_at":"` + time.Now().Add(24*time.Hour).Format(time.RFC3339) + `"}`
+	if rec := serve(http.MethodPost, "/api/v1/order-items", "text/csv", body); rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("POST with Accept: text/csv answered %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodPost, "/order_item/c", "application/xml", body); rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("legacy POST with Accept: application/xml answered %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := serve(http.MethodGet, "/api/v1/order-items?pageSize=100", "text/csv", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET list with Accept: text/csv answered %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "NOT_ACCEPTED") {
+		t.Fatalf("the rejected POST created its order item:\n%s", rec.Body.String())
+	}
+
+	if rec := serve(http.MethodGet, "/api/v1/users/1", "text/csv", ""); rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("GET a user with Accept: text/csv answered %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodGet, "/docs", "text/html", ""); rec.Code != http.StatusOK {
+		t.Fatalf("GET /docs with Accept: text/html answered %d", rec.Code)
+	}
+}
+
+func TestCSVCellEscapesFormulas(t *testing.T) {
+	cases := map[interface{}]string{
+		"=1+2":        "'=1+2",
+		"+1":          "'+1",
+		"-1":          "'-1",
+		"@SUM(A1:A2)": "'@SUM(A1:A2)",
+		"ANTM":        "ANTM",
+		"":            "",
+		int64(-1):     "-1",
+		float64(-1.5): "-1.5",
+		"\t=1":        "'\t=1",
+		"\r=1":        "'\r=1",
+		"a=b":         "a=b",
+	}
+	for value, want := range cases {
+		if got := csvCell(value); got != want {
+			t.Errorf("csvCell(%#v) = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// richEnvelopeMediaType is what clients put in Accept to get responses with
+// meta and links. Without it they get jsonResponse as always.
+const richEnvelopeMediaType = "application/vnd.saham.v1+json"
+
+type richResponse struct {
+	Error   bool          `json:"error"`
+	Message string        `json:"message"`
+	Data    interface{}   `json:"data,omitempty"`
+	Meta    responseMeta  `json:"meta"`
+	Links   responseLinks `json:"links"`
+}
+
+type responseMeta struct {
+	Page       int       `json:"page,omitempty"`
+	PageSize   int       `json:"page_size,omitempty"`
+	Total      *int      `json:"total,omitempty"`
+	TotalPages *int      `json:"total_pages,omitempty"`
+	RequestID  string    `json:"request_id"`
+	ServerTime time.Time `json:"server_time"`
+}
+
+type responseLinks struct {
+	Self    string            `json:"self"`
+	Next    string            `json:"next,omitempty"`
+	Prev    string            `json:"prev,omitempty"`
+	Related map[string]string `json:"related,omitempty"`
+}
+
+// listPage describes the page a list handler answers with. Total is only
+// called for the rich envelope, when it is nil next is guessed from Count.
+type listPage struct {
+	Page     int
+	PageSize int
+	Count    int
+	Total    func() (int, error)
+}
+
+// relatedLinks are the resources related to what a route returns, by route.
+// Path params are filled in from the request.
+var relatedLinks = map[string]map[string]string{
+	"GET /api/v1/users": {
+		"order_histories": "/api/v1/order-histories",
+	},
+	"GET /api/v1/users/:user_id": {
+		"data":                     "/api/v1/users/:user_id/data",
+		"erasure_requests":         "/api/v1/users/:user_id/erasure-requests",
+		"archived_order_histories": "/api/v1/order-histories/archive?user_id=:user_id",
+	},
+	"GET /api/v1/order-items/:order_item_id": {
+		"order_items": "/api/v1/order-items",
+	},
+	"GET /api/v1/orders": {
+		"order_items": "/api/v1/order-items",
+	},
+	"GET /api/v1/order-histories": {
+		"archive":     "/api/v1/order-histories/archive",
+		"order_items": "/api/v1/order-items",
+		"users":       "/api/v1/users",
+	},
+	"GET /api/v1/order-histories/archive": {
+		"order_histories": "/api/v1/order-histories",
+	},
+	"GET /api/v1/erasure-requests": {
+		"audit_log": "/api/v1/audit-log?entity_type=erasure_requests",
+	},
+}
+
+// writeResponse writes payload in the format the Accept header asks for, in
+// the rich envelope for richEnvelopeMediaType.
+func writeResponse(c echo.Context, status int, payload jsonResponse, headers ...http.Header) error {
+	return writePage(c, status, payload, nil, headers...)
+}
+
+// writePage is writeResponse for lists, the rich envelope gets the page in
+// its meta and the next and prev links.
+func writePage(c echo.Context, status int, payload jsonResponse, page *listPage, headers ...http.Header) error {
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+
+	encoder, err := negotiateEncoder(c, payload)
+	if err != nil {
+		return err
+	}
+
+	var body interface{} = payload
+	if encoder.rich {
+		body, err = richBody(c, payload, page)
+		if err != nil {
+			return err
+		}
+	}
+
+	var o bytes.Buffer
+	if err := encoder.encode(&o, body); err != nil {
+		return err
+	}
+
+	if len(headers) > 0 {
+		for k, v := range headers[0] {
+			c.Response().Header()[k] = v
+		}
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, encoder.mediaTypes[0])
+	c.Response().WriteHeader(status)
+	_, err = c.Response().Write(o.Bytes())
+	return err
+}
+
+func richBody(c echo.Context, payload jsonResponse, page *listPage) (richResponse, error) {
+	response := richResponse{
+		Error:   payload.Error,
+		Message: payload.Message,
+		Data:    payload.Data,
+		Meta: responseMeta{
+			RequestID:  c.Response().Header().Get(echo.HeaderXRequestID),
+			ServerTime: time.Now().UTC(),
+		},
+		Links: responseLinks{
+			Self:    c.Request().URL.RequestURI(),
+			Related: routeRelatedLinks(c),
+		},
+	}
+
+	if page != nil {
+		response.Meta.Page = page.Page
+		response.Meta.PageSize = page.PageSize
+
+		hasNext := page.PageSize > 0 && page.Count >= page.PageSize
+		if page.Total != nil {
+			total, err := page.Total()
+			if err != nil {
+				return response, err
+			}
+
+			totalPages := 0
+			if page.PageSize > 0 {
+				totalPages = (total + page.PageSize - 1) / page.PageSize
+			}
+			response.Meta.Total = &total
+			response.Meta.TotalPages = &totalPages
+			hasNext = page.Page < totalPages
+		}
+
+		if hasNext {
+			response.Links.Next = pageLink(c, page.Page+1)
+		}
+		if page.Page > 1 {
+			response.Links.Prev = pageLink(c, page.Page-1)
+		}
+	}
+
+	return response, nil
+}
+
+// pageLink is the URL of the request with its page query param set to page.
+func pageLink(c echo.Context, page int) string {
+	link := *c.Request().URL
+	query := link.Query()
+	query.Set("page", strconv.Itoa(page))
+	link.RawQuery = query.Encode()
+	return link.RequestURI()
+}
+
+func routeRelatedLinks(c echo.Context) map[string]string {
+	links, ok := relatedLinks[c.Request().Method+" "+c.Path()]
+	if !ok {
+		return nil
+	}
+
+	related := map[string]string{}
+	for name, link := range links {
+		for i, param := range c.ParamNames() {
+			link = strings.ReplaceAll(link, ":"+param, c.ParamValues()[i])
+		}
+		related[name] = link
+	}
+	return related
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	data "gitlab.com/nezaysr/go-saham.git/data"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem is an RFC 7807 problem details body. Code is the stable name of the
+// error for clients to switch on and Errors lists the invalid fields of a 422,
+// the other fields are for people.
+type problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      string            `json:"code"`
+	RequestID string            `json:"request_id,omitempty"`
+	Errors    []data.FieldError `json:"errors,omitempty"`
+}
+
+var statusByErrorKind = map[data.ErrorKind]int{
+	data.KindBadRequest:     http.StatusBadRequest,
+	data.KindValidation:     http.StatusUnprocessableEntity,
+	data.KindUnauthorized:   http.StatusUnauthorized,
+	data.KindForbidden:      http.StatusForbidden,
+	data.KindNotFound:       http.StatusNotFound,
+	data.KindConflict:       http.StatusConflict,
+	data.KindUnavailable:    http.StatusServiceUnavailable,
+	data.KindNotImplemented: http.StatusNotImplemented,
+}
+
+// HTTPErrorHandler answers every error returned by the handlers and
+// middlewares with a problem. Only the messages of *data.Error and
+// *echo.HTTPError reach the client, anything else is logged and answered with
+// a bare 500.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+	p := problem{
+		Type:      "about:blank",
+		Status:    http.StatusInternalServerError,
+		Code:      "internal_error",
+		Instance:  c.Request().URL.Path,
+		RequestID: requestID,
+	}
+
+	var domainErr *data.Error
+	var httpErr *echo.HTTPError
+	switch {
+	case errors.As(err, &domainErr) && domainErr.Kind != data.KindInternal:
+		p.Status = statusByErrorKind[domainErr.Kind]
+		p.Code = domainErr.Code
+		p.Detail = domainErr.Message
+		p.Errors = domainErr.Fields
+	case errors.As(err, &httpErr):
+		p.Status = httpErr.Code
+		p.Code = strings.ReplaceAll(strings.ToLower(http.StatusText(httpErr.Code)), " ", "_")
+		if message, ok := httpErr.Message.(string); ok {
+			p.Detail = message
+		}
+	}
+	p.Title = http.StatusText(p.Status)
+
+	if p.Status >= http.StatusInternalServerError {
+		log.Printf("Request %s %s %s failed: %v", requestID, c.Request().Method, c.Request().URL.Path, err)
+	}
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("Failed to marshal problem: %v", err)
+		return
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(p.Status)
+	} else {
+		err = c.Blob(p.Status, problemContentType, body)
+	}
+	if err != nil {
+		log.Printf("Failed to write problem: %v", err)
+	}
+}
+
+// invalidParam is the error for a path or query param that can't be parsed.
+func invalidParam(name string, err error) error {
+	return data.BadRequest("invalid_"+name, name+" is not valid").Wrap(err)
+}
+
+// invalidBody turns a JSON decoding error into one that says what is wrong
+// without quoting the decoder.
+func invalidBody(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var timeErr *time.ParseError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return data.BadRequest("empty_body", "body is empty").Wrap(err)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return data.BadRequest("invalid_body", typeErr.Field+" must be "+jsonTypeName(typeErr.Type)).Wrap(err)
+	case errors.As(err, &timeErr):
+		return data.BadRequest("invalid_body", "times must be RFC 3339, like 2024-01-31T00:00:00Z").Wrap(err)
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return data.BadRequest("invalid_body", "body is not valid JSON").Wrap(err)
+	case err.Error() == "http: request body too large":
+		return data.BadRequest("body_too_large", "body is too large").Wrap(err)
+	}
+
+	return data.BadRequest("invalid_body", "body can't be read").Wrap(err)
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Ptr:
+		return jsonTypeName(t.Elem())
+	}
+	return "an object"
+}
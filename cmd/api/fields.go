@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	data "gitlab.com/nezaysr/go-saham.git/data"
+)
+
+// embed is a relation ?include= can add to the rows of a type, found by the
+// id in the key field and loaded for every row at once.
+type embed struct {
+	key  string
+	rows reflect.Type
+	load func(actor data.Actor, ids []int) (map[int]interface{}, error)
+}
+
+var embeds = map[reflect.Type]map[string]embed{
+	reflect.TypeOf(data.OrdersHistories{}): {
+		"order_item": {key: "order_item_id", rows: reflect.TypeOf(data.OrdersItem{}), load: loadOrderItems},
+		"user":       {key: "user_id", rows: reflect.TypeOf(data.Users{}), load: loadUsers},
+	},
+	reflect.TypeOf(data.Users{}): {
+		"first_order": {key: "first_order_id", rows: reflect.TypeOf(data.OrdersItem{}), load: loadOrderItems},
+	},
+}
+
+func loadUsers(actor data.Actor, ids []int) (map[int]interface{}, error) {
+	users, err := data.GetUsersByIDs(actor, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[int]interface{}{}
+	for i := range users {
+		found[users[i].ID] = &users[i]
+	}
+	return found, nil
+}
+
+func loadOrderItems(actor data.Actor, ids []int) (map[int]interface{}, error) {
+	orderItems, err := data.GetOrderItemsByIDs(actor, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[int]interface{}{}
+	for i := range orderItems {
+		found[orderItems[i].ID] = &orderItems[i]
+	}
+	return found, nil
+}
+
+// jsonFieldNames are the JSON field names of struct t in their order, without
+// the fields tagged `sensitive`, nil when t isn't a struct.
+func jsonFieldNames(t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	names := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.Tag.Get("sensitive") == "true" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			names = append(names, jsonFieldNames(field.Type)...)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// projected is data cut down to the fields of ?fields=, with the relations
+// of ?include=. It is written with its fields in columns order.
+type projected struct {
+	columns []string
+	rows    []map[string]interface{}
+	list    bool
+}
+
+func (p projected) MarshalJSON() ([]byte, error) {
+	if !p.list {
+		if len(p.rows) == 0 {
+			return []byte("null"), nil
+		}
+		return marshalOrdered(p.columns, p.rows[0])
+	}
+
+	var o bytes.Buffer
+	o.WriteByte('[')
+	for i, row := range p.rows {
+		if i > 0 {
+			o.WriteByte(',')
+		}
+		object, err := marshalOrdered(p.columns, row)
+		if err != nil {
+			return nil, err
+		}
+		o.Write(object)
+	}
+	o.WriteByte(']')
+	return o.Bytes(), nil
+}
+
+func marshalOrdered(columns []string, row map[string]interface{}) ([]byte, error) {
+	var o bytes.Buffer
+	o.WriteByte('{')
+	written := 0
+	for _, column := range columns {
+		value, ok := row[column]
+		if !ok {
+			continue
+		}
+		if written > 0 {
+			o.WriteByte(',')
+		}
+		written++
+
+		name, _ := json.Marshal(column)
+		o.Write(name)
+		o.WriteByte(':')
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		o.Write(encoded)
+	}
+	o.WriteByte('}')
+	return o.Bytes(), nil
+}
+
+// project applies the fields and include query params to value, a row or a
+// slice of rows, and returns it as is when neither is set.
+//
+// fields takes the JSON names of the row's fields, and "order_item.name" for
+// the fields of an included relation. Fields tagged `sensitive` can't be
+// asked for. Relations are loaded with one query each, whatever the number of
+// rows.
+func project(c echo.Context, value interface{}) (interface{}, error) {
+	fieldsParam, includeParam := c.QueryParam("fields"), c.QueryParam("include")
+	if fieldsParam == "" && includeParam == "" {
+		return value, nil
+	}
+
+	rowType := reflect.TypeOf(value)
+	list := rowType.Kind() == reflect.Slice
+	for rowType.Kind() == reflect.Slice || rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+
+	relations := embeds[rowType]
+	included := []string{}
+	if includeParam != "" {
+		for _, name := range strings.Split(includeParam, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := relations[name]; !ok && len(relations) == 0 {
+				return nil, data.BadRequest("invalid_include", "include has "+name+", there is nothing to include here")
+			} else if !ok {
+				return nil, data.BadRequest("invalid_include", "include has "+name+", it can have "+relationNames(relations))
+			}
+			included = append(included, name)
+		}
+	}
+
+	columns, relationColumns, err := selectedFields(fieldsParam, rowType, relations, included)
+	if err != nil {
+		return nil, err
+	}
+
+	generic, err := genericJSON(value)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []map[string]interface{}{}
+	switch v := generic.(type) {
+	case []interface{}:
+		for _, row := range v {
+			if fields, ok := row.(map[string]interface{}); ok {
+				rows = append(rows, fields)
+			}
+		}
+	case map[string]interface{}:
+		rows = append(rows, v)
+	}
+
+	actor := actorFromContext(c)
+	for _, name := range included {
+		relation := relations[name]
+		if err := embedRelation(actor, rows, name, relation, relationColumns[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	result := projected{columns: columns, list: list}
+	for _, row := range rows {
+		selected := map[string]interface{}{}
+		for _, column := range columns {
+			if value, ok := row[column]; ok {
+				selected[column] = value
+			}
+		}
+		result.rows = append(result.rows, selected)
+	}
+	return result, nil
+}
+
+// selectedFields are the columns of the rows and of each included relation,
+// every field that can be selected when fields isn't set.
+func selectedFields(fieldsParam string, rowType reflect.Type, relations map[string]embed, included []string) ([]string, map[string][]string, error) {
+	allowed := jsonFieldNames(rowType)
+	relationColumns := map[string][]string{}
+
+	if fieldsParam == "" {
+		return append(allowed, included...), relationColumns, nil
+	}
+
+	relationAllowed := map[string][]string{}
+	for _, name := range included {
+		relationAllowed[name] = jsonFieldNames(relations[name].rows)
+	}
+
+	asked := map[string]bool{}
+	for _, field := range strings.Split(fieldsParam, ",") {
+		field = strings.TrimSpace(field)
+		if relation := strings.SplitN(field, ".", 2); len(relation) == 2 {
+			names, ok := relationAllowed[relation[0]]
+			if !ok || !contains(names, relation[1]) {
+				return nil, nil, data.BadRequest("invalid_fields", "fields has "+field+", include "+relation[0]+" and pick from its fields")
+			}
+			relationColumns[relation[0]] = append(relationColumns[relation[0]], relation[1])
+			continue
+		}
+
+		if !contains(allowed, field) {
+			return nil, nil, data.BadRequest("invalid_fields", "fields has "+field+", it can have "+strings.Join(allowed, ", "))
+		}
+		asked[field] = true
+	}
+
+	columns := []string{}
+	for _, name := range allowed {
+		if asked[name] {
+			columns = append(columns, name)
+		}
+	}
+	return append(columns, included...), relationColumns, nil
+}
+
+// embedRelation sets name on every row to its related row, or nil, keeping
+// only columns of it when there are some.
+func embedRelation(actor data.Actor, rows []map[string]interface{}, name string, relation embed, columns []string) error {
+	ids := []int{}
+	seen := map[int]bool{}
+	for _, row := range rows {
+		if id, ok := row[relation.key].(int64); ok && !seen[int(id)] {
+			seen[int(id)] = true
+			ids = append(ids, int(id))
+		}
+	}
+
+	found := map[int]interface{}{}
+	if len(ids) > 0 {
+		var err error
+		found, err = relation.load(actor, ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	embedded := map[int]interface{}{}
+	for id, related := range found {
+		relatedColumns := columns
+		if len(relatedColumns) == 0 {
+			relatedColumns = jsonFieldNames(relation.rows)
+		}
+
+		generic, err := genericJSON(related)
+		if err != nil {
+			return err
+		}
+		fields, _ := generic.(map[string]interface{})
+
+		selected := map[string]interface{}{}
+		for _, column := range relatedColumns {
+			if value, ok := fields[column]; ok {
+				selected[column] = value
+			}
+		}
+		embedded[id] = projected{columns: relatedColumns, rows: []map[string]interface{}{selected}}
+	}
+
+	for _, row := range rows {
+		row[name] = nil
+		if id, ok := row[relation.key].(int64); ok {
+			if related, ok := embedded[int(id)]; ok {
+				row[name] = related
+			}
+		}
+	}
+	return nil
+}
+
+func relationNames(relations map[string]embed) string {
+	names := []string{}
+	for name := range relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func contains(names []string, name string) bool {
+	for _, candidate := range names {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
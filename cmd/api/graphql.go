@@ -0,0 +1,628 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/location"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/labstack/echo/v4"
+	"gitlab.com/nezaysr/go-saham.git/config"
+	data "gitlab.com/nezaysr/go-saham.git/data"
+)
+
+const graphQLDefaultPageSize = 10
+
+// graphQLRequest is what a GraphQL request runs with, it is in the context of
+// every resolver. The loaders batch the lookups of one request.
+type graphQLRequest struct {
+	actor              data.Actor
+	users              *batchLoader
+	orderItems         *batchLoader
+	mu                 sync.Mutex
+	userOrderHistories map[[2]int]*batchLoader
+}
+
+type graphQLRequestKey struct{}
+
+func graphQLRequestFrom(ctx context.Context) *graphQLRequest {
+	return ctx.Value(graphQLRequestKey{}).(*graphQLRequest)
+}
+
+func newGraphQLRequest(actor data.Actor) *graphQLRequest {
+	return &graphQLRequest{
+		actor: actor,
+		users: newBatchLoader(func(ids []int) (map[int]interface{}, error) {
+			users, err := data.GetUsersByIDs(actor, ids)
+			if err != nil {
+				return nil, err
+			}
+			found := map[int]interface{}{}
+			for i := range users {
+				found[users[i].ID] = &users[i]
+			}
+			return found, nil
+		}),
+		orderItems: newBatchLoader(func(ids []int) (map[int]interface{}, error) {
+			orderItems, err := data.GetOrderItemsByIDs(actor, ids)
+			if err != nil {
+				return nil, err
+			}
+			found := map[int]interface{}{}
+			for i := range orderItems {
+				found[orderItems[i].ID] = &orderItems[i]
+			}
+			return found, nil
+		}),
+		userOrderHistories: map[[2]int]*batchLoader{},
+	}
+}
+
+// orderHistoriesOfUsers loads the page of order histories of users, one loader
+// per page since a query can ask for different pages in different places.
+func (r *graphQLRequest) orderHistoriesOfUsers(page int, pageSize int) *batchLoader {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]int{page, pageSize}
+	if loader, ok := r.userOrderHistories[key]; ok {
+		return loader
+	}
+
+	loader := newBatchLoader(func(userIDs []int) (map[int]interface{}, error) {
+		order_histories, err := data.GetOrderHistoriesByUserIDs(r.actor, userIDs, page, pageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		byUser := map[int][]*data.OrdersHistories{}
+		for i := range order_histories {
+			byUser[order_histories[i].UserId] = append(byUser[order_histories[i].UserId], &order_histories[i])
+		}
+
+		found := map[int]interface{}{}
+		for _, userID := range userIDs {
+			found[userID] = append([]*data.OrdersHistories{}, byUser[userID]...)
+		}
+		return found, nil
+	})
+	r.userOrderHistories[key] = loader
+	return loader
+}
+
+// batchLoader collects the ids resolvers ask for and loads them with one fetch
+// when the first of their thunks is called. graphql-go calls the thunks of a
+// level once every resolver of that level ran, so a level is one fetch.
+type batchLoader struct {
+	mu      sync.Mutex
+	fetch   func(ids []int) (map[int]interface{}, error)
+	pending []int
+	queued  map[int]bool
+	results map[int]interface{}
+	errs    map[int]error
+}
+
+func newBatchLoader(fetch func(ids []int) (map[int]interface{}, error)) *batchLoader {
+	return &batchLoader{
+		fetch:   fetch,
+		queued:  map[int]bool{},
+		results: map[int]interface{}{},
+		errs:    map[int]error{},
+	}
+}
+
+// Load queues id and returns the thunk resolving it, to nil when it doesn't
+// exist.
+func (l *batchLoader) Load(id int) func() (interface{}, error) {
+	l.mu.Lock()
+	_, loaded := l.results[id]
+	if !loaded && !l.queued[id] {
+		l.pending = append(l.pending, id)
+		l.queued[id] = true
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if len(l.pending) > 0 {
+			ids := l.pending
+			l.pending = nil
+
+			found, err := l.fetch(ids)
+			for _, id := range ids {
+				delete(l.queued, id)
+				if err != nil {
+					l.errs[id] = err
+					continue
+				}
+				if value, ok := found[id]; ok {
+					l.results[id] = value
+				} else {
+					l.results[id] = nil
+				}
+			}
+		}
+
+		return l.results[id], l.errs[id]
+	}
+}
+
+// graphQLError is what resolvers' errors turn into, the code goes in the
+// extensions of the error.
+type graphQLError struct {
+	code    string
+	message string
+}
+
+func (e graphQLError) Error() string {
+	return e.message
+}
+
+func (e graphQLError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+// safeGraphQLError keeps only the code and message of a *data.Error, anything
+// else is logged and reported as internal_error, like HTTPErrorHandler does.
+func safeGraphQLError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var domainErr *data.Error
+	if errors.As(err, &domainErr) && domainErr.Kind != data.KindInternal {
+		return graphQLError{code: domainErr.Code, message: domainErr.Message}
+	}
+
+	log.Printf("GraphQL request %s failed: %v", graphQLRequestFrom(ctx).actor.RequestID, err)
+	return graphQLError{code: "internal_error", message: "internal error"}
+}
+
+// resolver makes fn's errors, and those of the thunks it returns, safe to show.
+func resolver(fn graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		value, err := fn(p)
+		if err != nil {
+			return nil, safeGraphQLError(p.Context, err)
+		}
+
+		if thunk, ok := value.(func() (interface{}, error)); ok {
+			return func() (interface{}, error) {
+				value, err := thunk()
+				return value, safeGraphQLError(p.Context, err)
+			}, nil
+		}
+		return value, nil
+	}
+}
+
+func requireAdmin(ctx context.Context) error {
+	if graphQLRequestFrom(ctx).actor.Role != data.Admin {
+		return data.Forbidden("role_required", "this needs the admin role")
+	}
+	return nil
+}
+
+var pageArgs = graphql.FieldConfigArgument{
+	"page":     &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1},
+	"pageSize": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: graphQLDefaultPageSize},
+}
+
+func pageOf(p graphql.ResolveParams) (int, int) {
+	page, _ := p.Args["page"].(int)
+	pageSize, _ := p.Args["pageSize"].(int)
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = graphQLDefaultPageSize
+	}
+	return page, pageSize
+}
+
+func nullableTime(t *data.NullableTime) interface{} {
+	if t == nil || !t.Valid {
+		return nil
+	}
+	return t.Time
+}
+
+func graphQLField(t graphql.Output, get func(source interface{}) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source), nil
+	}}
+}
+
+var graphQLSchema = newGraphQLSchema()
+
+func newGraphQLSchema() graphql.Schema {
+	var userType, orderItemType, orderHistoryType *graphql.Object
+
+	orderItemType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "OrderItem",
+		Fields: graphql.Fields{
+			"id":        graphQLField(graphql.NewNonNull(graphql.Int), func(s interface{}) interface{} { return s.(*data.OrdersItem).ID }),
+			"name":      graphQLField(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(*data.OrdersItem).Name }),
+			"price":     graphQLField(graphql.NewNonNull(graphql.Int), func(s interface{}) interface{} { return s.(*data.OrdersItem).Price }),
+			"expiredAt": graphQLField(graphql.NewNonNull(graphql.DateTime), func(s interface{}) interface{} { return s.(*data.OrdersItem).ExpiredAt }),
+			"createdAt": graphQLField(graphql.NewNonNull(graphql.DateTime), func(s interface{}) interface{} { return s.(*data.OrdersItem).CreatedAt }),
+			"updatedAt": graphQLField(graphql.DateTime, func(s interface{}) interface{} { return nullableTime(s.(*data.OrdersItem).UpdatedAt) }),
+		},
+	})
+
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":       graphQLField(graphql.NewNonNull(graphql.Int), func(s interface{}) interface{} { return s.(*data.Users).ID }),
+				"username": graphQLField(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(*data.Users).Username }),
+				"fullname": graphQLField(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(*data.Users).Fullname }),
+				"role":     graphQLField(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return string(s.(*data.Users).Role) }),
+				"firstOrderId": graphQLField(graphql.Int, func(s interface{}) interface{} {
+					if id := s.(*data.Users).FirstOrderId; id != nil {
+						return *id
+					}
+					return nil
+				}),
+				"createdAt": graphQLField(graphql.NewNonNull(graphql.DateTime), func(s interface{}) interface{} { return s.(*data.Users).CreatedAt }),
+				"updatedAt": graphQLField(graphql.DateTime, func(s interface{}) interface{} { return nullableTime(s.(*data.Users).UpdatedAt) }),
+				"firstOrder": &graphql.Field{
+					Type:        orderItemType,
+					Description: "The first order item the user bought.",
+					Resolve: resolver(func(p graphql.ResolveParams) (interface{}, error) {
+						id := p.Source.(*data.Users).FirstOrderId
+						if id == nil {
+							return nil, nil
+						}
+						return graphQLRequestFrom(p.Context).orderItems.Load(*id), nil
+					}),
+				},
+				"orderHistories": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(orderHistoryType))),
+					Description: "Newest first, only admins can read other users' order histories.",
+					Args:        pageArgs,
+					Resolve: resolver(func(p graphql.ResolveParams) (interface{}, error) {
+						user := p.Source.(*data.Users)
+						request := graphQLRequestFrom(p.Context)
+						if request.actor.ID == nil || *request.actor.ID != user.ID {
+							if err := requireAdmin(p.Context); err != nil {
+								return nil, err
+							}
+						}
+
+						page, pageSize := pageOf(p)
+						return request.orderHistoriesOfUsers(page, pageSize).Load(user.ID), nil
+					}),
+				},
+			}
+		}),
+	})
+
+	orderHistoryType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "OrderHistory",
+		Fields: graphql.Fields{
+			"id":          graphQLField(graphql.NewNonNull(graphql.Int), func(s interface{}) interface{} { return s.(*data.OrdersHistories).ID }),
+			"userId":      graphQLField(graphql.NewNonNull(graphql.Int), func(s interface{}) interface{} { return s.(*data.OrdersHistories).UserId }),
+			"orderItemId": graphQLField(graphql.NewNonNull(graphql.Int), func(s interface{}) interface{} { return s.(*data.OrdersHistories).OrderItemId }),
+			"descriptions": graphQLField(graphql.String, func(s interface{}) interface{} {
+				if descriptions := s.(*data.OrdersHistories).Descriptions; descriptions != nil {
+					return *descriptions
+				}
+				return nil
+			}),
+			"createdAt": graphQLField(graphql.NewNonNull(graphql.DateTime), func(s interface{}) interface{} { return s.(*data.OrdersHistories).CreatedAt }),
+			"user": &graphql.Field{
+				Type: userType,
+				Resolve: resolver(func(p graphql.ResolveParams) (interface{}, error) {
+					return graphQLRequestFrom(p.Context).users.Load(p.Source.(*data.OrdersHistories).UserId), nil
+				}),
+			},
+			"orderItem": &graphql.Field{
+				Type: orderItemType,
+				Resolve: resolver(func(p graphql.ResolveParams) (interface{}, error) {
+					return graphQLRequestFrom(p.Context).orderItems.Load(p.Source.(*data.OrdersHistories).OrderItemId), nil
+				}),
+			},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"users": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType))),
+				Description: "Admins only.",
+				Args:        pageArgs,
+				Resolve: resolver(func(p graphql.ResolveParams) (interface{}, error) {
+					if err := requireAdmin(p.Context); err != nil {
+						return nil, err
+					}
+
+					request := graphQLRequestFrom(p.Context)
+					page, pageSize := pageOf(p)
+					users, err := data.GetUserList(request.actor, page, pageSize)
+					if err != nil {
+						return nil, err
+					}
+
+					result := make([]*data.Users, len(users))
+					for i := range users {
+						result[i] = &users[i]
+					}
+					return result, nil
+				}),
+			},
+			"user": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)}},
+				Resolve: resolver(func(p graphql.ResolveParams) (interface{}, error) {
+					return data.GetUserByID(graphQLRequestFrom(p.Context).actor, p.Args["id"].(int))
+				}),
+			},
+			"orderItems": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(orderItemType))),
+				Args: pageArgs,
+				Resolve: resolver(func(p graphql.ResolveParams) (interface{}, error) {
+					request := graphQLRequestFrom(p.Context)
+					page, pageSize := pageOf(p)
+					orderItems, err := data.GetOrderItemList(request.actor, page, pageSize)
+					if err != nil {
+						return nil, err
+					}
+
+					result := make([]*data.OrdersItem, len(orderItems))
+					for i := range orderItems {
+						result[i] = &orderItems[i]
+					}
+					return result, nil
+				}),
+			},
+			"orderItem": &graphql.Field{
+				Type: orderItemType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)}},
+				Resolve: resolver(func(p graphql.ResolveParams) (interface{}, error) {
+					return data.GetOrderItemByID(graphQLRequestFrom(p.Context).actor, p.Args["id"].(int))
+				}),
+			},
+			"orderHistories": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(orderHistoryType))),
+				Description: "Everyone's order histories, newest first. Admins only.",
+				Args:        pageArgs,
+				Resolve: resolver(func(p graphql.ResolveParams) (interface{}, error) {
+					if err := requireAdmin(p.Context); err != nil {
+						return nil, err
+					}
+
+					request := graphQLRequestFrom(p.Context)
+					page, pageSize := pageOf(p)
+					order_histories, err := data.GetAllOrderHistories(request.actor, page, pageSize)
+					if err != nil {
+						return nil, err
+					}
+					return orderHistoryPointers(order_histories), nil
+				}),
+			},
+			"myOrders": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(orderHistoryType))),
+				Description: "The signed in user's order histories, newest first.",
+				Args:        pageArgs,
+				Resolve: resolver(func(p graphql.ResolveParams) (interface{}, error) {
+					request := graphQLRequestFrom(p.Context)
+					if request.actor.ID == nil {
+						return nil, errUserRequired
+					}
+
+					page, pageSize := pageOf(p)
+					order_histories, err := data.GetOrderHistoriesByUserID(request.actor, page, pageSize, strconv.Itoa(*request.actor.ID))
+					if err != nil {
+						return nil, err
+					}
+					return orderHistoryPointers(order_histories), nil
+				}),
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+	if err != nil {
+		log.Fatalf("Invalid GraphQL schema: %v", err)
+	}
+	return schema
+}
+
+func orderHistoryPointers(order_histories []data.OrdersHistories) []*data.OrdersHistories {
+	result := make([]*data.OrdersHistories, len(order_histories))
+	for i := range order_histories {
+		result[i] = &order_histories[i]
+	}
+	return result
+}
+
+type graphQLPayload struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLHandler answers GraphQL queries with {data, errors}, the errors have
+// the API's codes in their extensions.
+func GraphQLHandler() echo.HandlerFunc {
+	maxDepth := config.GetGraphQLMaxDepth()
+	maxComplexity := config.GetGraphQLMaxComplexity()
+
+	return func(c echo.Context) error {
+		var requestPayload graphQLPayload
+
+		err := readJSON(c.Response().Writer, c.Request(), &requestPayload)
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(requestPayload.Query) == "" {
+			return data.BadRequest("missing_query", "query is required")
+		}
+
+		request := newGraphQLRequest(actorFromContext(c))
+		ctx := context.WithValue(c.Request().Context(), graphQLRequestKey{}, request)
+
+		result := executeGraphQL(ctx, requestPayload.Query, requestPayload.OperationName, requestPayload.Variables, maxDepth, maxComplexity)
+
+		return writeJSON(c.Response().Writer, http.StatusOK, result)
+	}
+}
+
+func executeGraphQL(ctx context.Context, query string, operationName string, variables map[string]interface{}, maxDepth int, maxComplexity int) *graphql.Result {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	validation := graphql.ValidateDocument(&graphQLSchema, doc, nil)
+	if !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}
+	}
+
+	limits := graphQLLimits{fragments: map[string]*ast.FragmentDefinition{}, variables: variables}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			limits.fragments[fragment.Name.Value] = fragment
+		}
+	}
+	for _, definition := range doc.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok || (operationName != "" && (operation.Name == nil || operation.Name.Value != operationName)) {
+			continue
+		}
+
+		complexity, depth := limits.cost(operation.SelectionSet, graphQLSchema.QueryType(), 0)
+		if depth > maxDepth {
+			return graphQLRejected(graphQLError{
+				code:    "query_too_deep",
+				message: "query nests " + strconv.Itoa(depth) + " levels, at most " + strconv.Itoa(maxDepth) + " are allowed",
+			})
+		}
+		if complexity > maxComplexity {
+			return graphQLRejected(graphQLError{
+				code:    "query_too_complex",
+				message: "query costs " + strconv.Itoa(complexity) + ", at most " + strconv.Itoa(maxComplexity) + " is allowed",
+			})
+		}
+	}
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        graphQLSchema,
+		AST:           doc,
+		OperationName: operationName,
+		Args:          variables,
+		Context:       ctx,
+	})
+}
+
+func graphQLRejected(err graphQLError) *graphql.Result {
+	return &graphql.Result{Errors: []gqlerrors.FormattedError{{
+		Message:    err.message,
+		Locations:  []location.SourceLocation{},
+		Extensions: err.Extensions(),
+	}}}
+}
+
+// graphQLLimits measures a query before it runs. Every field costs 1, plus the
+// cost of its fields, times the page size for lists.
+type graphQLLimits struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+func (l graphQLLimits) cost(selections *ast.SelectionSet, parent *graphql.Object, depth int) (int, int) {
+	if selections == nil || parent == nil {
+		return 0, depth
+	}
+
+	total, deepest := 0, depth
+	for _, selection := range selections.Selections {
+		var cost, reached int
+
+		switch selection := selection.(type) {
+		case *ast.Field:
+			// Introspection is left alone, tools send deep queries for it.
+			if strings.HasPrefix(selection.Name.Value, "__") {
+				continue
+			}
+
+			definition, ok := parent.Fields()[selection.Name.Value]
+			if !ok {
+				continue
+			}
+
+			fieldType, isList := unwrapGraphQLType(definition.Type)
+			child, _ := fieldType.(*graphql.Object)
+			childCost, childDepth := l.cost(selection.SelectionSet, child, depth+1)
+
+			rows := 1
+			if isList {
+				rows = l.pageSize(selection)
+			}
+			cost, reached = 1+rows*childCost, childDepth
+		case *ast.InlineFragment:
+			cost, reached = l.cost(selection.SelectionSet, parent, depth)
+		case *ast.FragmentSpread:
+			if fragment, ok := l.fragments[selection.Name.Value]; ok {
+				cost, reached = l.cost(fragment.SelectionSet, parent, depth)
+			}
+		}
+
+		total += cost
+		if reached > deepest {
+			deepest = reached
+		}
+	}
+	return total, deepest
+}
+
+func (l graphQLLimits) pageSize(field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "pageSize" {
+			continue
+		}
+
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(value.Value); err == nil && n > 0 {
+				return n
+			}
+		case *ast.Variable:
+			if n, ok := l.variables[value.Name.Value].(float64); ok && n > 0 {
+				return int(n)
+			}
+		}
+	}
+	return graphQLDefaultPageSize
+}
+
+func unwrapGraphQLType(t graphql.Type) (graphql.Type, bool) {
+	isList := false
+	for {
+		switch wrapper := t.(type) {
+		case *graphql.NonNull:
+			t = wrapper.OfType
+		case *graphql.List:
+			t, isList = wrapper.OfType, true
+		default:
+			return t, isList
+		}
+	}
+}
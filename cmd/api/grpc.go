@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	data "gitlab.com/nezaysr/go-saham.git/data"
+	"gitlab.com/nezaysr/go-saham.git/grpcapi"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const grpcMethodPrefix = "/saham.v1.Saham/"
+
+// grpcPublicMethods don't need a session.
+var grpcPublicMethods = map[string]bool{
+	grpcMethodPrefix + "Signin": true,
+}
+
+// grpcAdminMethods are the ones behind RoleRequiredMiddleware on /api/v1.
+var grpcAdminMethods = map[string]bool{
+	grpcMethodPrefix + "ListUsers":          true,
+	grpcMethodPrefix + "CreateUser":         true,
+	grpcMethodPrefix + "DeleteUser":         true,
+	grpcMethodPrefix + "CreateOrderItem":    true,
+	grpcMethodPrefix + "UpdateOrderItem":    true,
+	grpcMethodPrefix + "DeleteOrderItem":    true,
+	grpcMethodPrefix + "ListOrderHistories": true,
+}
+
+var grpcCodeByErrorKind = map[data.ErrorKind]codes.Code{
+	data.KindBadRequest:     codes.InvalidArgument,
+	data.KindValidation:     codes.InvalidArgument,
+	data.KindUnauthorized:   codes.Unauthenticated,
+	data.KindForbidden:      codes.PermissionDenied,
+	data.KindNotFound:       codes.NotFound,
+	data.KindConflict:       codes.FailedPrecondition,
+	data.KindUnavailable:    codes.Unavailable,
+	data.KindNotImplemented: codes.Unimplemented,
+}
+
+type grpcActorKey struct{}
+
+// ServeGRPC serves grpcapi.Saham on port until the listener fails.
+func ServeGRPC(port int) {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		log.Fatalf("Failed to listen for gRPC on port %d: %v", port, err)
+	}
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcUnaryInterceptor),
+		grpc.StreamInterceptor(grpcStreamInterceptor),
+	)
+	grpcapi.RegisterSahamServer(server, &grpcServer{})
+
+	log.Printf("gRPC server started on %s", listener.Addr())
+	if err := server.Serve(listener); err != nil {
+		log.Printf("gRPC server stopped: %v", err)
+	}
+}
+
+func grpcUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := grpcAuthenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, grpcError(ctx, info.FullMethod, err)
+	}
+
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return nil, grpcError(ctx, info.FullMethod, err)
+	}
+	return resp, nil
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcAuthenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return grpcError(ctx, info.FullMethod, err)
+	}
+
+	if err := handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx}); err != nil {
+		return grpcError(ctx, info.FullMethod, err)
+	}
+	return nil
+}
+
+// grpcAuthenticate checks the JWT in the "authorization: Bearer" metadata the
+// way AuthenticationMiddleware and RoleRequiredMiddleware do, or the API key
+// in the "x-api-key" metadata, and puts the caller's actor in the context.
+func grpcAuthenticate(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	actor := data.Actor{Type: data.ActorSystem, RequestID: uuid.New().String()}
+	if requestIDs := md.Get("x-request-id"); len(requestIDs) > 0 && requestIDs[0] != "" {
+		actor.RequestID = requestIDs[0]
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		actor.IP, _, _ = net.SplitHostPort(p.Addr.String())
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", actor.RequestID))
+
+	if grpcPublicMethods[method] {
+		return context.WithValue(ctx, grpcActorKey{}, actor), nil
+	}
+
+	authorization := md.Get("authorization")
+	if apiKeys := md.Get("x-api-key"); len(apiKeys) > 0 {
+		role, ok := apiKeyRole(apiKeys[0])
+		if !ok {
+			return ctx, errInvalidAPIKey
+		}
+		actor.Type, actor.Role = data.ActorAPIKey, data.UserRole(role)
+	} else if len(authorization) > 0 && strings.HasPrefix(authorization[0], "Bearer ") {
+		id, role, err := verifyToken(strings.TrimPrefix(authorization[0], "Bearer "))
+		if err != nil {
+			return ctx, errInvalidSession.Wrap(err)
+		}
+
+		userID, err := strconv.Atoi(id)
+		if err != nil {
+			return ctx, errInvalidSession.Wrap(err)
+		}
+		actor.ID, actor.Type, actor.Role = &userID, data.ActorUser, data.UserRole(role)
+	} else {
+		return ctx, errMissingSession
+	}
+
+	if grpcAdminMethods[method] && actor.Role != data.Admin {
+		return ctx, data.Forbidden("role_required", "this needs the admin role")
+	}
+
+	return context.WithValue(ctx, grpcActorKey{}, actor), nil
+}
+
+// grpcUserID is the id of the signed in user, API keys don't have one.
+func grpcUserID(actor data.Actor) (int, error) {
+	if actor.ID == nil {
+		return 0, errUserRequired
+	}
+	return *actor.ID, nil
+}
+
+func grpcActor(ctx context.Context) data.Actor {
+	actor, _ := ctx.Value(grpcActorKey{}).(data.Actor)
+	return actor
+}
+
+// grpcError is HTTPErrorHandler for gRPC: *data.Error keeps its code and
+// message, with the invalid fields of a validation error as details, anything
+// else is logged and answered with a bare Internal.
+func grpcError(ctx context.Context, method string, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var domainErr *data.Error
+	if !errors.As(err, &domainErr) || domainErr.Kind == data.KindInternal {
+		log.Printf("gRPC request %s %s failed: %v", grpcActor(ctx).RequestID, method, err)
+		return status.Error(codes.Internal, "internal_error")
+	}
+
+	code := grpcCodeByErrorKind[domainErr.Kind]
+	if domainErr.Kind == data.KindConflict && strings.HasSuffix(domainErr.Code, "_exists") {
+		code = codes.AlreadyExists
+	}
+
+	st := status.New(code, domainErr.Code+": "+domainErr.Message)
+	if len(domainErr.Fields) > 0 {
+		violations := &errdetails.BadRequest{}
+		for _, field := range domainErr.Fields {
+			violations.FieldViolations = append(violations.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       field.Field,
+				Description: field.Message,
+			})
+		}
+		if withDetails, err := st.WithDetails(violations); err == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
+}
+
+type grpcServer struct {
+	grpcapi.UnimplementedSahamServer
+}
+
+func (s *grpcServer) Signin(ctx context.Context, req *grpcapi.SigninRequest) (*grpcapi.SigninResponse, error) {
+	token, err := data.Signin(grpcActor(ctx), data.SigninPayload{Username: req.Username, Password: req.Password})
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcapi.SigninResponse{Token: token}, nil
+}
+
+func (s *grpcServer) ListUsers(ctx context.Context, req *grpcapi.ListRequest) (*grpcapi.ListUsersResponse, error) {
+	page, pageSize := grpcPage(req)
+
+	users, err := data.GetUserList(grpcActor(ctx), page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &grpcapi.ListUsersResponse{}
+	for i := range users {
+		resp.Users = append(resp.Users, toGRPCUser(&users[i]))
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) GetUser(ctx context.Context, req *grpcapi.GetUserRequest) (*grpcapi.User, error) {
+	user, err := data.GetUserByID(grpcActor(ctx), int(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return toGRPCUser(user), nil
+}
+
+func (s *grpcServer) CreateUser(ctx context.Context, req *grpcapi.CreateUserRequest) (*grpcapi.CreateUserResponse, error) {
+	generatedPassword := strings.ReplaceAll(uuid.New().String(), "-", "")
+
+	userID, err := data.PostNewUser(grpcActor(ctx), data.InsertUserPayload{
+		Username: req.Username,
+		Fullname: req.Fullname,
+		Password: generatedPassword,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := data.GetUserByID(grpcActor(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcapi.CreateUserResponse{User: toGRPCUser(user), Password: generatedPassword}, nil
+}
+
+func (s *grpcServer) UpdateUser(ctx context.Context, req *grpcapi.UpdateUserRequest) (*grpcapi.User, error) {
+	user := data.UpdateUserPayload{
+		ID:       int(req.Id),
+		Fullname: req.Fullname,
+	}
+	if req.FirstOrderId != nil {
+		firstOrderID := int(*req.FirstOrderId)
+		user.FirstOrderId = &firstOrderID
+	}
+
+	if err := data.UpdateAUserByID(grpcActor(ctx), user); err != nil {
+		return nil, err
+	}
+
+	return s.GetUser(ctx, &grpcapi.GetUserRequest{Id: req.Id})
+}
+
+func (s *grpcServer) DeleteUser(ctx context.Context, req *grpcapi.DeleteUserRequest) (*emptypb.Empty, error) {
+	if err := data.DeleteAUserByID(grpcActor(ctx), int(req.Id)); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) ListOrderItems(ctx context.Context, req *grpcapi.ListRequest) (*grpcapi.ListOrderItemsResponse, error) {
+	page, pageSize := grpcPage(req)
+
+	orderItems, err := data.GetOrderItemList(grpcActor(ctx), page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &grpcapi.ListOrderItemsResponse{}
+	for i := range orderItems {
+		resp.OrderItems = append(resp.OrderItems, toGRPCOrderItem(&orderItems[i]))
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) GetOrderItem(ctx context.Context, req *grpcapi.GetOrderItemRequest) (*grpcapi.OrderItem, error) {
+	orderItem, err := data.GetOrderItemByID(grpcActor(ctx), int(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return toGRPCOrderItem(orderItem), nil
+}
+
+func (s *grpcServer) CreateOrderItem(ctx context.Context, req *grpcapi.CreateOrderItemRequest) (*grpcapi.OrderItem, error) {
+	orderItemID, err := data.PostNewOrderItem(grpcActor(ctx), data.InsertOrderItemPayload{
+		Name:      req.Name,
+		Price:     int(req.Price),
+		ExpiredAt: fromGRPCTime(req.ExpiredAt),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetOrderItem(ctx, &grpcapi.GetOrderItemRequest{Id: int64(orderItemID)})
+}
+
+func (s *grpcServer) UpdateOrderItem(ctx context.Context, req *grpcapi.UpdateOrderItemRequest) (*grpcapi.OrderItem, error) {
+	err := data.UpdateOrderItemByID(grpcActor(ctx), data.UpdateOrderItemPayload{
+		ID:        int(req.Id),
+		Name:      req.Name,
+		Price:     int(req.Price),
+		ExpiredAt: fromGRPCTime(req.ExpiredAt),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetOrderItem(ctx, &grpcapi.GetOrderItemRequest{Id: req.Id})
+}
+
+func (s *grpcServer) DeleteOrderItem(ctx context.Context, req *grpcapi.DeleteOrderItemRequest) (*emptypb.Empty, error) {
+	if err := data.DeleteOrderItemByID(grpcActor(ctx), int(req.Id)); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) Purchase(ctx context.Context, req *grpcapi.PurchaseRequest) (*grpcapi.PurchaseResponse, error) {
+	actor := grpcActor(ctx)
+	userID, err := grpcUserID(actor)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, orderHistoryID, err := data.BuyOrderItem(actor, userID, int(req.OrderItemId), req.Descriptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcapi.PurchaseResponse{OrderHistoryId: int64(orderHistoryID)}, nil
+}
+
+func (s *grpcServer) ListOrders(req *grpcapi.StreamOrderHistoriesRequest, stream grpcapi.Saham_ListOrdersServer) error {
+	actor := grpcActor(stream.Context())
+	userID, err := grpcUserID(actor)
+	if err != nil {
+		return err
+	}
+
+	return streamOrderHistories(stream.Context(), req.BatchSize, stream.Send, func(beforeID int, limit int) ([]data.OrdersHistories, error) {
+		return data.GetOrderHistoriesBefore(actor, &userID, beforeID, limit)
+	})
+}
+
+func (s *grpcServer) ListOrderHistories(req *grpcapi.StreamOrderHistoriesRequest, stream grpcapi.Saham_ListOrderHistoriesServer) error {
+	actor := grpcActor(stream.Context())
+
+	var userID *int
+	if req.UserId != nil {
+		id := int(*req.UserId)
+		userID = &id
+	}
+
+	return streamOrderHistories(stream.Context(), req.BatchSize, stream.Send, func(beforeID int, limit int) ([]data.OrdersHistories, error) {
+		return data.GetOrderHistoriesBefore(actor, userID, beforeID, limit)
+	})
+}
+
+// streamOrderHistories sends every row load returns, newest first and
+// batchSize rows at a time, until a batch comes back short. Each batch
+// continues below the id of the last row sent, so rows added or removed
+// meanwhile don't shift it.
+func streamOrderHistories(ctx context.Context, batchSize int32, send func(*grpcapi.OrderHistory) error, load func(beforeID int, limit int) ([]data.OrdersHistories, error)) error {
+	limit := int(batchSize)
+	if limit <= 0 {
+		limit = 100
+	}
+
+	for beforeID := 0; ; {
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+
+		order_histories, err := load(beforeID, limit)
+		if err != nil {
+			return err
+		}
+
+		for i := range order_histories {
+			if err := send(toGRPCOrderHistory(&order_histories[i])); err != nil {
+				return err
+			}
+		}
+
+		if len(order_histories) < limit {
+			return nil
+		}
+		beforeID = order_histories[len(order_histories)-1].ID
+	}
+}
+
+// grpcPage is page and pageSize of the REST list routes, with their defaults.
+func grpcPage(req *grpcapi.ListRequest) (int, int) {
+	page, pageSize := int(req.Page), int(req.PageSize)
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+	return page, pageSize
+}
+
+func toGRPCUser(user *data.Users) *grpcapi.User {
+	u := &grpcapi.User{
+		Id:        int64(user.ID),
+		Username:  user.Username,
+		Fullname:  user.Fullname,
+		Role:      string(user.Role),
+		CreatedAt: timestamppb.New(user.CreatedAt),
+		UpdatedAt: toGRPCNullableTime(user.UpdatedAt),
+	}
+	if user.FirstOrderId != nil {
+		firstOrderID := int64(*user.FirstOrderId)
+		u.FirstOrderId = &firstOrderID
+	}
+	return u
+}
+
+func toGRPCOrderItem(orderItem *data.OrdersItem) *grpcapi.OrderItem {
+	return &grpcapi.OrderItem{
+		Id:        int64(orderItem.ID),
+		Name:      orderItem.Name,
+		Price:     int64(orderItem.Price),
+		ExpiredAt: timestamppb.New(orderItem.ExpiredAt),
+		CreatedAt: timestamppb.New(orderItem.CreatedAt),
+		UpdatedAt: toGRPCNullableTime(orderItem.UpdatedAt),
+	}
+}
+
+func toGRPCOrderHistory(orderHistory *data.OrdersHistories) *grpcapi.OrderHistory {
+	return &grpcapi.OrderHistory{
+		Id:           int64(orderHistory.ID),
+		UserId:       int64(orderHistory.UserId),
+		OrderItemId:  int64(orderHistory.OrderItemId),
+		Descriptions: orderHistory.Descriptions,
+		CreatedAt:    timestamppb.New(orderHistory.CreatedAt),
+	}
+}
+
+func toGRPCNullableTime(t *data.NullableTime) *timestamppb.Timestamp {
+	if t == nil || !t.Valid {
+		return nil
+	}
+	return timestamppb.New(t.Time)
+}
+
+// fromGRPCTime leaves a missing timestamp zero, so it fails the required rule
+// instead of reading as 1970.
+func fromGRPCTime(t *timestamppb.Timestamp) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.AsTime()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/nezaysr/go-saham.git/data"
+	"gitlab.com/nezaysr/go-saham.git/grpcapi"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGRPCAuthenticateAPIKey(t *testing.T) {
+	hash := func(key string) string {
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	}
+	t.Setenv("API_KEYS", "risk:admin:"+hash("admin-key")+",reports:user:"+hash("user-key"))
+
+	const adminMethod = grpcMethodPrefix + "ListOrderHistories"
+	if !grpcAdminMethods[adminMethod] {
+		t.Fatalf("%s isn't an admin method", adminMethod)
+	}
+
+	authenticate := func(key string, method string) (context.Context, error) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", key))
+		return grpcAuthenticate(ctx, method)
+	}
+
+	ctx, err := authenticate("admin-key", adminMethod)
+	if err != nil {
+		t.Fatalf("admin key: %v", err)
+	}
+	actor := grpcActor(ctx)
+	if actor.Type != data.ActorAPIKey || actor.Role != data.Admin || actor.ID != nil {
+		t.Fatalf("admin key actor = %+v", actor)
+	}
+
+	if _, err := authenticate("user-key", adminMethod); data.ErrorKindOf(err) != data.KindForbidden {
+		t.Fatalf("user key on an admin method: got %v, want forbidden", err)
+	}
+
+	if _, err := authenticate("wrong-key", adminMethod); !errors.Is(err, errInvalidAPIKey) {
+		t.Fatalf("wrong key: got %v, want %v", err, errInvalidAPIKey)
+	}
+
+	ctx, err = authenticate("user-key", grpcMethodPrefix+"Purchase")
+	if err != nil {
+		t.Fatalf("user key: %v", err)
+	}
+	if _, err := (&grpcServer{}).Purchase(ctx, &grpcapi.PurchaseRequest{OrderItemId: 1}); !errors.Is(err, errUserRequired) {
+		t.Fatalf("purchase with an API key: got %v, want %v", err, errUserRequired)
+	}
+}
+
+func TestGRPCOrderHistoryStreamSurvivesDeletes(t *testing.T) {
+	adminID := 1
+	admin := data.Actor{ID: &adminID, Type: data.ActorUser, Role: data.Admin}
+
+	userID, err := data.PostNewUser(admin, data.InsertUserPayload{Username: "streamed.orders", Fullname: "Streamed Orders", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderItemID, err := data.PostNewOrderItem(admin, data.InsertOrderItemPayload{Name: "STREAMED", Price: 100, ExpiredAt: time.Now().Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{}
+	for i := 0; i < 5; i++ {
+		_, _, id, err := data.BuyOrderItem(admin, userID, orderItemID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append([]int64{int64(id)}, want...)
+	}
+
+	// Deleting a row that was already sent must not make the next batch
+	// skip one that wasn't.
+	got := []int64{}
+	send := func(orderHistory *grpcapi.OrderHistory) error {
+		got = append(got, orderHistory.Id)
+		if len(got) == 1 {
+			return data.RemoveAnOrderHistory(admin, int(orderHistory.Id))
+		}
+		return nil
+	}
+	err = streamOrderHistories(context.Background(), 2, send, func(beforeID int, limit int) ([]data.OrdersHistories, error) {
+		return data.GetOrderHistoriesBefore(admin, &userID, beforeID, limit)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("streamed %v, want %v", got, want)
+	}
+}
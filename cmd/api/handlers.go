@@ -10,6 +10,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"gitlab.com/nezaysr/go-saham.git/config"
 	data "gitlab.com/nezaysr/go-saham.git/data"
+	"gitlab.com/nezaysr/go-saham.git/storage"
 )
 
 func heartbeat(c echo.Context) error {
@@ -20,17 +21,51 @@ func heartbeat(c echo.Context) error {
 		Data:    "http://localhost:3000/" + name,
 	}
 
-	return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	return writeResponse(c, http.StatusOK, payload)
+}
+
+// Readiness is ready as long as the database answers. Without Redis it still
+// serves, only slower, and reports itself as degraded.
+func Readiness(rdb *config.Database) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		status := http.StatusOK
+		checks := map[string]string{
+			"database": "ok",
+			"redis":    "ok",
+		}
+		message := "Ready"
+
+		if err := storage.GetDBInstance().DB().Ping(); err != nil {
+			status = http.StatusServiceUnavailable
+			checks["database"] = err.Error()
+			message = "Not ready"
+		}
+
+		if !rdb.Healthy() {
+			checks["redis"] = "unavailable, reads go to the database"
+			if status == http.StatusOK {
+				message = "Degraded"
+			}
+		}
+
+		payload := jsonResponse{
+			Error:   status != http.StatusOK,
+			Message: message,
+			Data:    checks,
+		}
+
+		return writeResponse(c, status, payload)
+	}
 }
 
 func SigninHandler(c echo.Context) error {
 	tokenStr, err := userSignin(c)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusInternalServerError)
+		return err
 	}
 
 	if err := setJWTToCookie(c, tokenStr); err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusInternalServerError)
+		return err
 	}
 
 	payload := jsonResponse{
@@ -38,7 +73,7 @@ func SigninHandler(c echo.Context) error {
 		Message: "Successfully Login",
 	}
 
-	return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	return writeResponse(c, http.StatusOK, payload)
 }
 
 func userSignin(c echo.Context) (string, error) {
@@ -57,7 +92,7 @@ func userSignin(c echo.Context) (string, error) {
 		Password: requestPayload.Password,
 	}
 
-	tokenString, err := data.Signin(signinPayload)
+	tokenString, err := data.Signin(actorFromContext(c), signinPayload)
 	if err != nil {
 		return "", err
 	}
@@ -80,35 +115,40 @@ func UserSignout(c echo.Context) error {
 		Message: "Successfully logged out",
 	}
 
-	return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	return writeResponse(c, http.StatusOK, payload)
 }
 
-func GetUsers(rdb *config.Database) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		pageSize := 10 // default page size
-		page := 1      // default page
+func GetUsers(c echo.Context) error {
+	pageSize := 10 // default page size
+	page := 1      // default page
 
-		if pageSizeParam := c.QueryParam("pageSize"); pageSizeParam != "" {
-			pageSize, _ = strconv.Atoi(pageSizeParam)
-		}
+	if pageSizeParam := c.QueryParam("pageSize"); pageSizeParam != "" {
+		pageSize, _ = strconv.Atoi(pageSizeParam)
+	}
 
-		if pageParam := c.QueryParam("page"); pageParam != "" {
-			page, _ = strconv.Atoi(pageParam)
-		}
+	if pageParam := c.QueryParam("page"); pageParam != "" {
+		page, _ = strconv.Atoi(pageParam)
+	}
 
-		users, err := data.GetUserList(rdb, page, pageSize)
-		if err != nil {
-			return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
-		}
+	users, err := data.GetUserList(actorFromContext(c), page, pageSize)
+	if err != nil {
+		return err
+	}
 
-		payload := jsonResponse{
-			Error:   false,
-			Message: "Users list",
-			Data:    users,
-		}
+	projection, err := project(c, users)
+	if err != nil {
+		return err
+	}
 
-		return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Users list",
+		Data:    projection,
 	}
+
+	return writePage(c, http.StatusOK, payload, &listPage{Page: page, PageSize: pageSize, Count: len(users), Total: func() (int, error) {
+		return data.CountUsers(actorFromContext(c))
+	}})
 }
 
 func GetAUser(c echo.Context) error {
@@ -116,21 +156,26 @@ func GetAUser(c echo.Context) error {
 
 	userID, err := strconv.Atoi(userIDRaw)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return invalidParam("user_id", err)
+	}
+
+	user, err := data.GetUserByID(actorFromContext(c), userID)
+	if err != nil {
+		return err
 	}
 
-	user, err := data.GetUserByID(userID)
+	projection, err := project(c, user)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return err
 	}
 
 	payload := jsonResponse{
 		Error:   false,
 		Message: "User with id " + userIDRaw,
-		Data:    user,
+		Data:    projection,
 	}
 
-	return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	return writeResponse(c, http.StatusOK, payload)
 }
 
 func CreateAUser(c echo.Context) error {
@@ -143,7 +188,7 @@ func CreateAUser(c echo.Context) error {
 
 	err := readJSON(c.Response().Writer, c.Request(), &requestPayload)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusInternalServerError)
+		return err
 	}
 
 	user := data.InsertUserPayload{
@@ -152,9 +197,9 @@ func CreateAUser(c echo.Context) error {
 		Password: generatedPassword,
 	}
 
-	newID, err := data.PostNewUser(user)
+	newID, err := data.PostNewUser(actorFromContext(c), user)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusInternalServerError)
+		return err
 	}
 
 	newIDString := strconv.Itoa(newID)
@@ -165,7 +210,11 @@ func CreateAUser(c echo.Context) error {
 		Data:    generatedPassword,
 	}
 
-	return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	headers := http.Header{}
+	headers.Set("Location", "/api/v1/users/"+newIDString)
+
+	c.Set(idempotencySecretKey, true)
+	return writeResponse(c, http.StatusCreated, payload, headers)
 }
 
 func UpdateAUser(c echo.Context) error {
@@ -173,7 +222,7 @@ func UpdateAUser(c echo.Context) error {
 
 	userID, err := strconv.Atoi(userIDRaw)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return invalidParam("user_id", err)
 	}
 
 	var requestPayload struct {
@@ -183,7 +232,7 @@ func UpdateAUser(c echo.Context) error {
 
 	err = readJSON(c.Response().Writer, c.Request(), &requestPayload)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusInternalServerError)
+		return err
 	}
 
 	user := data.UpdateUserPayload{
@@ -192,9 +241,9 @@ func UpdateAUser(c echo.Context) error {
 		FirstOrderId: requestPayload.FirstOrderId,
 	}
 
-	err = data.UpdateAUserByID(user)
+	err = data.UpdateAUserByID(actorFromContext(c), user)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return err
 	}
 
 	payload := jsonResponse{
@@ -203,7 +252,7 @@ func UpdateAUser(c echo.Context) error {
 		Data:    "user updated",
 	}
 
-	return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	return writeResponse(c, http.StatusOK, payload)
 }
 
 func DeleteAUser(c echo.Context) error {
@@ -211,49 +260,48 @@ func DeleteAUser(c echo.Context) error {
 
 	userID, err := strconv.Atoi(userIDRaw)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return invalidParam("user_id", err)
 	}
 
-	err = data.DeleteAUserByID(userID)
+	err = data.DeleteAUserByID(actorFromContext(c), userID)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
-	}
-
-	payload := jsonResponse{
-		Error:   false,
-		Message: "User with id " + userIDRaw + " has been deleted",
-		Data:    "user deleted",
+		return err
 	}
 
-	return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	return c.NoContent(http.StatusNoContent)
 }
 
-func GetOrderItemList(rdb *config.Database) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		pageSize := 10 // default page size
-		page := 1      // default page
+func GetOrderItemList(c echo.Context) error {
+	pageSize := 10 // default page size
+	page := 1      // default page
 
-		if pageSizeParam := c.QueryParam("pageSize"); pageSizeParam != "" {
-			pageSize, _ = strconv.Atoi(pageSizeParam)
-		}
+	if pageSizeParam := c.QueryParam("pageSize"); pageSizeParam != "" {
+		pageSize, _ = strconv.Atoi(pageSizeParam)
+	}
 
-		if pageParam := c.QueryParam("page"); pageParam != "" {
-			page, _ = strconv.Atoi(pageParam)
-		}
+	if pageParam := c.QueryParam("page"); pageParam != "" {
+		page, _ = strconv.Atoi(pageParam)
+	}
 
-		order_item, err := data.GetOrderItemList(rdb, page, pageSize)
-		if err != nil {
-			return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
-		}
+	order_item, err := data.GetOrderItemList(actorFromContext(c), page, pageSize)
+	if err != nil {
+		return err
+	}
 
-		payload := jsonResponse{
-			Error:   false,
-			Message: "Order Item list",
-			Data:    order_item,
-		}
+	projection, err := project(c, order_item)
+	if err != nil {
+		return err
+	}
 
-		return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Order Item list",
+		Data:    projection,
 	}
+
+	return writePage(c, http.StatusOK, payload, &listPage{Page: page, PageSize: pageSize, Count: len(order_item), Total: func() (int, error) {
+		return data.CountOrderItems(actorFromContext(c))
+	}})
 }
 
 func GetAnOrderItem(c echo.Context) error {
@@ -261,21 +309,26 @@ func GetAnOrderItem(c echo.Context) error {
 
 	orderItemID, err := strconv.Atoi(orderItemIDRaw)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return invalidParam("order_item_id", err)
+	}
+
+	orderItem, err := data.GetOrderItemByID(actorFromContext(c), orderItemID)
+	if err != nil {
+		return err
 	}
 
-	orderItem, err := data.GetOrderItemByID(orderItemID)
+	projection, err := project(c, orderItem)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return err
 	}
 
 	payload := jsonResponse{
 		Error:   false,
 		Message: "Order Item with id " + orderItemIDRaw,
-		Data:    orderItem,
+		Data:    projection,
 	}
 
-	return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	return writeResponse(c, http.StatusOK, payload)
 }
 
 func CreateAnOrderItem(c echo.Context) error {
@@ -287,7 +340,7 @@ func CreateAnOrderItem(c echo.Context) error {
 
 	err := readJSON(c.Response().Writer, c.Request(), &requestPayload)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusInternalServerError)
+		return err
 	}
 
 	order_item := data.InsertOrderItemPayload{
@@ -296,9 +349,9 @@ func CreateAnOrderItem(c echo.Context) error {
 		ExpiredAt: requestPayload.ExpiredAt,
 	}
 
-	newID, err := data.PostNewOrderItem(order_item)
+	newID, err := data.PostNewOrderItem(actorFromContext(c), order_item)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusInternalServerError)
+		return err
 	}
 
 	newIDString := strconv.Itoa(newID)
@@ -309,7 +362,10 @@ func CreateAnOrderItem(c echo.Context) error {
 		Data:    "order item created",
 	}
 
-	return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	headers := http.Header{}
+	headers.Set("Location", "/api/v1/order-items/"+newIDString)
+
+	return writeResponse(c, http.StatusCreated, payload, headers)
 }
 
 func UpdateAnOrderItem(c echo.Context) error {
@@ -317,7 +373,7 @@ func UpdateAnOrderItem(c echo.Context) error {
 
 	orderItemID, err := strconv.Atoi(orderItemIDRaw)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return invalidParam("order_item_id", err)
 	}
 
 	var requestPayload struct {
@@ -328,7 +384,7 @@ func UpdateAnOrderItem(c echo.Context) error {
 
 	err = readJSON(c.Response().Writer, c.Request(), &requestPayload)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusInternalServerError)
+		return err
 	}
 
 	order_item := data.UpdateOrderItemPayload{
@@ -338,9 +394,9 @@ func UpdateAnOrderItem(c echo.Context) error {
 		ExpiredAt: requestPayload.ExpiredAt,
 	}
 
-	err = data.UpdateOrderItemByID(order_item)
+	err = data.UpdateOrderItemByID(actorFromContext(c), order_item)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return err
 	}
 
 	payload := jsonResponse{
@@ -349,7 +405,7 @@ func UpdateAnOrderItem(c echo.Context) error {
 		Data:    "order item updated",
 	}
 
-	return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	return writeResponse(c, http.StatusOK, payload)
 }
 
 func DeleteAnOrderItem(c echo.Context) error {
@@ -357,160 +413,616 @@ func DeleteAnOrderItem(c echo.Context) error {
 
 	orderItemID, err := strconv.Atoi(orderItemIDRaw)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return invalidParam("order_item_id", err)
 	}
 
-	err = data.DeleteOrderItemByID(orderItemID)
+	err = data.DeleteOrderItemByID(actorFromContext(c), orderItemID)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return err
 	}
 
-	payload := jsonResponse{
-		Error:   false,
-		Message: "Order Item with id " + orderItemIDRaw + " has been deleted",
-		Data:    "order item deleted",
+	return c.NoContent(http.StatusNoContent)
+}
+
+func UserGetOrderItem(c echo.Context) error {
+	orderItemIDRaw := c.Param("order_item_id")
+
+	orderItemID, err := strconv.Atoi(orderItemIDRaw)
+	if err != nil {
+		return invalidParam("order_item_id", err)
 	}
 
-	return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	return buyOrderItem(c, orderItemID, nil)
 }
 
-func UserGetOrderItem(c echo.Context) error {
-	id := c.Get("id").(string)
+func CreateAnOrder(c echo.Context) error {
 	var requestPayload struct {
+		OrderItemId  int     `json:"order_item_id"`
 		Descriptions *string `json:"descriptions,omitempty"`
 	}
 
-	orderItemIDRaw := c.Param("order_item_id")
+	err := readJSON(c.Response().Writer, c.Request(), &requestPayload)
+	if err != nil {
+		return err
+	}
 
-	orderItemID, err := strconv.Atoi(orderItemIDRaw)
+	return buyOrderItem(c, requestPayload.OrderItemId, requestPayload.Descriptions)
+}
+
+// buyOrderItem records the signed in user buying an order item.
+func buyOrderItem(c echo.Context, orderItemID int, descriptions *string) error {
+	userID, err := userIDFromContext(c)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return err
 	}
 
-	userID, err := strconv.Atoi(id)
+	user, orderItem, _, err := data.BuyOrderItem(actorFromContext(c), userID, orderItemID, descriptions)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return err
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: user.Fullname + " just bought a " + orderItem.Name,
+		Data:    "Order History created",
 	}
 
-	user, err := data.GetUserByID(userID)
+	return writeResponse(c, http.StatusCreated, payload)
+}
+
+func UserRemoveOrderItem(c echo.Context) error {
+	orderHistoryIDRaw := c.Param("order_history_id")
+
+	orderHistoryID, err := strconv.Atoi(orderHistoryIDRaw)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return invalidParam("order_history_id", err)
 	}
 
-	orderItem, err := data.GetOrderItemByID(orderItemID)
+	err = data.RemoveAnOrderHistory(actorFromContext(c), orderHistoryID)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return err
 	}
 
-	if user.FirstOrderId == nil {
-		user := data.UpdateUserPayload{
-			ID:           userID,
-			FirstOrderId: &orderItem.ID,
-		}
+	return c.NoContent(http.StatusNoContent)
+}
 
-		err = data.UpdateAUserByID(user)
-		if err != nil {
-			return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
-		}
+func GetOrderHistories(c echo.Context) error {
+	pageSize := 10 // default page size
+	page := 1      // default page
+
+	if pageSizeParam := c.QueryParam("pageSize"); pageSizeParam != "" {
+		pageSize, _ = strconv.Atoi(pageSizeParam)
 	}
 
-	order_history := data.InsertOrderHistoryPayload{
-		UserId:       userID,
-		OrderItemId:  orderItemID,
-		Descriptions: requestPayload.Descriptions,
+	if pageParam := c.QueryParam("page"); pageParam != "" {
+		page, _ = strconv.Atoi(pageParam)
 	}
 
-	_, err = data.PostAnOrderHistory(order_history)
+	order_histories, err := data.GetAllOrderHistories(actorFromContext(c), page, pageSize)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return err
+	}
+
+	projection, err := project(c, order_histories)
+	if err != nil {
+		return err
 	}
 
 	payload := jsonResponse{
 		Error:   false,
-		Message: user.Fullname + " just bought a " + orderItem.Name,
-		Data:    "Order History created",
+		Message: "Order Histories",
+		Data:    projection,
 	}
 
-	return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	return writePage(c, http.StatusOK, payload, &listPage{Page: page, PageSize: pageSize, Count: len(order_histories), Total: func() (int, error) {
+		return data.CountOrderHistories(actorFromContext(c), nil)
+	}})
 }
 
-func UserRemoveOrderItem(c echo.Context) error {
-	id := c.Get("id").(string)
-	orderHistoryIDRaw := c.Param("order_history_id")
+func GetAnUsersOrderHistories(c echo.Context) error {
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		return err
+	}
 
-	orderHistoryID, err := strconv.Atoi(orderHistoryIDRaw)
+	pageSize := 10 // default page size
+	page := 1      // default page
+
+	if pageSizeParam := c.QueryParam("pageSize"); pageSizeParam != "" {
+		pageSize, _ = strconv.Atoi(pageSizeParam)
+	}
+
+	if pageParam := c.QueryParam("page"); pageParam != "" {
+		page, _ = strconv.Atoi(pageParam)
+	}
+
+	order_histories, err := data.GetOrderHistoriesByUserID(actorFromContext(c), page, pageSize, strconv.Itoa(userID))
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return err
 	}
 
-	err = data.RemoveAnOrderHistory(orderHistoryID)
+	projection, err := project(c, order_histories)
 	if err != nil {
-		return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+		return err
 	}
 
 	payload := jsonResponse{
 		Error:   false,
-		Message: "Order History with id " + orderHistoryIDRaw + " owned by user id " + id + " has been deleted",
-		Data:    "order history deleted",
+		Message: "Order Histories",
+		Data:    projection,
 	}
 
-	return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	return writePage(c, http.StatusOK, payload, &listPage{Page: page, PageSize: pageSize, Count: len(order_histories), Total: func() (int, error) {
+		return data.CountOrderHistories(actorFromContext(c), &userID)
+	}})
 }
 
-func GetOrderHistories(rdb *config.Database) echo.HandlerFunc {
+// importMaxBytes is the largest CSV or NDJSON file ImportOrderItems reads.
+const importMaxBytes = 32 << 20
+
+func ImportOrderItems(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = importFormatFromContentType(c.Request().Header.Get(echo.HeaderContentType))
+	}
+
+	dryRun, _ := strconv.ParseBool(c.QueryParam("dry_run"))
+	upsert, _ := strconv.ParseBool(c.QueryParam("upsert"))
+
+	body := http.MaxBytesReader(c.Response().Writer, c.Request().Body, importMaxBytes)
+
+	report, err := data.ImportOrderItems(actorFromContext(c), body, data.ImportOrderItemsOptions{
+		Format: format,
+		DryRun: dryRun,
+		Upsert: upsert,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(report.Errors) > 0 {
+		payload := jsonResponse{
+			Error:   true,
+			Message: strconv.Itoa(len(report.Errors)) + " invalid rows, nothing was imported",
+			Data:    report,
+		}
+
+		return writeResponse(c, http.StatusUnprocessableEntity, payload)
+	}
+
+	message := "Order Items imported"
+	if dryRun {
+		message = "Order Items validated, dry run so nothing was imported"
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    report,
+	}
+
+	return writeResponse(c, http.StatusOK, payload)
+}
+
+func importFormatFromContentType(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "text/csv"):
+		return data.ImportFormatCSV
+	case strings.HasPrefix(contentType, "application/x-ndjson"), strings.HasPrefix(contentType, "application/ndjson"):
+		return data.ImportFormatNDJSON
+	}
+	return ""
+}
+
+func ExportTable(c echo.Context) error {
+	entity := c.Param("entity")
+	format := c.QueryParam("format")
+	if format == "" {
+		format = data.ExportFormatCSV
+	}
+
+	if !data.IsExportEntity(entity) {
+		return data.ErrUnknownExportEntity
+	}
+	if !data.IsExportFormat(format) {
+		return data.ErrUnknownExportFormat
+	}
+
+	filter, err := exportFilterFromQuery(c)
+	if err != nil {
+		return err
+	}
+
+	w := c.Response().Writer
+	w.Header().Set("Content-Type", data.ExportContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+data.ExportFileName(entity, format)+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent once rows start streaming, so a failure halfway
+	// through can only be logged and the response cut short.
+	if err := data.ExportTable(w, entity, format, filter); err != nil {
+		c.Logger().Errorf("export of %s failed: %v", entity, err)
+	}
+
+	return nil
+}
+
+func StartExportJob(rdb *config.Database) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		pageSize := 10 // default page size
-		page := 1      // default page
+		format := c.QueryParam("format")
+		if format == "" {
+			format = data.ExportFormatCSV
+		}
+
+		filter, err := exportFilterFromQuery(c)
+		if err != nil {
+			return err
+		}
 
-		if pageSizeParam := c.QueryParam("pageSize"); pageSizeParam != "" {
-			pageSize, _ = strconv.Atoi(pageSizeParam)
+		job, err := data.StartExportJob(rdb, c.Param("entity"), format, filter)
+		if err != nil {
+			return err
 		}
 
-		if pageParam := c.QueryParam("page"); pageParam != "" {
-			page, _ = strconv.Atoi(pageParam)
+		payload := jsonResponse{
+			Error:   false,
+			Message: "Export job " + job.ID + " has been started",
+			Data:    job,
 		}
 
-		order_histories, err := data.GetAllOrderHistories(rdb, page, pageSize)
+		return writeResponse(c, http.StatusAccepted, payload)
+	}
+}
+
+func GetExportJob(rdb *config.Database) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		job, err := data.GetExportJob(rdb, c.Param("job_id"))
 		if err != nil {
-			return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+			return err
 		}
 
 		payload := jsonResponse{
 			Error:   false,
-			Message: "Order Histories",
-			Data:    order_histories,
+			Message: "Export job " + job.ID + " is " + job.Status,
+			Data:    job,
 		}
 
-		return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+		return writeResponse(c, http.StatusOK, payload)
 	}
 }
 
-func GetAnUsersOrderHistories(rdb *config.Database) echo.HandlerFunc {
+func DownloadExportJob(rdb *config.Database) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		id := c.Get("id").(string)
+		job, err := data.GetExportJob(rdb, c.Param("job_id"))
+		if err != nil {
+			return err
+		}
+
+		if job.Status != data.ExportJobDone {
+			return data.Conflict("export_job_not_done", "export job is "+job.Status)
+		}
+
+		c.Response().Header().Set("Content-Type", data.ExportContentType(job.Format))
+		return c.Attachment(data.ExportJobFilePath(job), job.FileName)
+	}
+}
 
-		pageSize := 10 // default page size
-		page := 1      // default page
+func exportFilterFromQuery(c echo.Context) (data.ExportFilter, error) {
+	var filter data.ExportFilter
 
-		if pageSizeParam := c.QueryParam("pageSize"); pageSizeParam != "" {
-			pageSize, _ = strconv.Atoi(pageSizeParam)
+	if userIDParam := c.QueryParam("user_id"); userIDParam != "" {
+		userID, err := strconv.Atoi(userIDParam)
+		if err != nil {
+			return filter, invalidParam("user_id", err)
 		}
+		filter.UserID = &userID
+	}
+
+	if pageSizeParam := c.QueryParam("pageSize"); pageSizeParam != "" {
+		filter.Limit, _ = strconv.Atoi(pageSizeParam)
+		filter.Page = 1
+	}
+
+	if pageParam := c.QueryParam("page"); pageParam != "" {
+		filter.Page, _ = strconv.Atoi(pageParam)
+	}
+
+	return filter, nil
+}
+
+func GetAuditLogs(c echo.Context) error {
+	pageSize := 10 // default page size
+	page := 1      // default page
+
+	if pageSizeParam := c.QueryParam("pageSize"); pageSizeParam != "" {
+		pageSize, _ = strconv.Atoi(pageSizeParam)
+	}
 
-		if pageParam := c.QueryParam("page"); pageParam != "" {
-			page, _ = strconv.Atoi(pageParam)
+	if pageParam := c.QueryParam("page"); pageParam != "" {
+		page, _ = strconv.Atoi(pageParam)
+	}
+
+	filter := data.AuditLogFilter{
+		EntityType: c.QueryParam("entity_type"),
+		Action:     data.AuditAction(c.QueryParam("action")),
+	}
+
+	if actorIDParam := c.QueryParam("actor_id"); actorIDParam != "" {
+		actorID, err := strconv.Atoi(actorIDParam)
+		if err != nil {
+			return invalidParam("actor_id", err)
 		}
+		filter.ActorID = &actorID
+	}
 
-		order_histories, err := data.GetOrderHistoriesByUserID(rdb, page, pageSize, id)
+	if entityIDParam := c.QueryParam("entity_id"); entityIDParam != "" {
+		entityID, err := strconv.Atoi(entityIDParam)
 		if err != nil {
-			return errorJSON(c.Response().Writer, err, http.StatusBadRequest)
+			return invalidParam("entity_id", err)
 		}
+		filter.EntityID = &entityID
+	}
 
-		payload := jsonResponse{
-			Error:   false,
-			Message: "Order Histories",
-			Data:    order_histories,
+	if fromParam := c.QueryParam("from"); fromParam != "" {
+		from, err := time.Parse(time.RFC3339, fromParam)
+		if err != nil {
+			return invalidParam("from", err)
+		}
+		filter.From = &from
+	}
+
+	if toParam := c.QueryParam("to"); toParam != "" {
+		to, err := time.Parse(time.RFC3339, toParam)
+		if err != nil {
+			return invalidParam("to", err)
+		}
+		filter.To = &to
+	}
+
+	audit_logs, err := data.GetAuditLogs(actorFromContext(c), filter, page, pageSize)
+	if err != nil {
+		return err
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Audit log",
+		Data:    audit_logs,
+	}
+
+	return writePage(c, http.StatusOK, payload, &listPage{Page: page, PageSize: pageSize, Count: len(audit_logs), Total: func() (int, error) {
+		return data.CountAuditLogs(actorFromContext(c), filter)
+	}})
+}
+
+func ExportUserData(c echo.Context) error {
+	userIDRaw := c.Param("user_id")
+
+	userID, err := strconv.Atoi(userIDRaw)
+	if err != nil {
+		return invalidParam("user_id", err)
+	}
+
+	bundle, err := data.GetUserDataBundle(actorFromContext(c), userID)
+	if err != nil {
+		return err
+	}
+
+	if c.QueryParam("format") == "zip" {
+		w := c.Response().Writer
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="user-`+userIDRaw+`-data.zip"`)
+		w.WriteHeader(http.StatusOK)
+
+		if err := data.WriteUserDataZip(w, bundle); err != nil {
+			c.Logger().Errorf("data export of user %d failed: %v", userID, err)
 		}
+		return nil
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Personal data of user with id " + userIDRaw,
+		Data:    bundle,
+	}
 
-		return writeJSON(c.Response().Writer, http.StatusAccepted, payload)
+	return writeResponse(c, http.StatusOK, payload)
+}
+
+func RequestUserErasure(c echo.Context) error {
+	userIDRaw := c.Param("user_id")
+
+	userID, err := strconv.Atoi(userIDRaw)
+	if err != nil {
+		return invalidParam("user_id", err)
+	}
+
+	var requestPayload struct {
+		Reason string `json:"reason"`
+	}
+
+	err = readJSON(c.Response().Writer, c.Request(), &requestPayload)
+	if err != nil {
+		return err
+	}
+
+	erasureRequest, err := data.RequestErasure(actorFromContext(c), data.InsertErasureRequestPayload{
+		UserId: userID,
+		Reason: requestPayload.Reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Erasure of user with id " + userIDRaw + " is waiting for approval by another admin",
+		Data:    erasureRequest,
+	}
+
+	return writeResponse(c, http.StatusCreated, payload)
+}
+
+func GetErasureRequests(c echo.Context) error {
+	pageSize := 10 // default page size
+	page := 1      // default page
+
+	if pageSizeParam := c.QueryParam("pageSize"); pageSizeParam != "" {
+		pageSize, _ = strconv.Atoi(pageSizeParam)
+	}
+
+	if pageParam := c.QueryParam("page"); pageParam != "" {
+		page, _ = strconv.Atoi(pageParam)
+	}
+
+	erasure_requests, err := data.GetErasureRequests(actorFromContext(c), page, pageSize)
+	if err != nil {
+		return err
 	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Erasure requests",
+		Data:    erasure_requests,
+	}
+
+	return writePage(c, http.StatusOK, payload, &listPage{Page: page, PageSize: pageSize, Count: len(erasure_requests), Total: func() (int, error) {
+		return data.CountErasureRequests(actorFromContext(c))
+	}})
+}
+
+func ApproveUserErasure(c echo.Context) error {
+	erasureRequestIDRaw := c.Param("erasure_request_id")
+
+	erasureRequestID, err := strconv.Atoi(erasureRequestIDRaw)
+	if err != nil {
+		return invalidParam("erasure_request_id", err)
+	}
+
+	erasureRequest, err := data.ApproveErasure(actorFromContext(c), erasureRequestID)
+	if err != nil {
+		return err
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "User with id " + strconv.Itoa(erasureRequest.UserId) + " has been erased",
+		Data:    erasureRequest,
+	}
+
+	return writeResponse(c, http.StatusOK, payload)
+}
+
+func RejectUserErasure(c echo.Context) error {
+	erasureRequestIDRaw := c.Param("erasure_request_id")
+
+	erasureRequestID, err := strconv.Atoi(erasureRequestIDRaw)
+	if err != nil {
+		return invalidParam("erasure_request_id", err)
+	}
+
+	erasureRequest, err := data.RejectErasure(actorFromContext(c), erasureRequestID)
+	if err != nil {
+		return err
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Erasure request with id " + erasureRequestIDRaw + " has been rejected",
+		Data:    erasureRequest,
+	}
+
+	return writeResponse(c, http.StatusOK, payload)
+}
+
+func GetArchivedOrderHistories(c echo.Context) error {
+	pageSize := 10 // default page size
+	page := 1      // default page
+
+	if pageSizeParam := c.QueryParam("pageSize"); pageSizeParam != "" {
+		pageSize, _ = strconv.Atoi(pageSizeParam)
+	}
+
+	if pageParam := c.QueryParam("page"); pageParam != "" {
+		page, _ = strconv.Atoi(pageParam)
+	}
+
+	var filter data.ArchivedOrderHistoryFilter
+
+	if userIDParam := c.QueryParam("user_id"); userIDParam != "" {
+		userID, err := strconv.Atoi(userIDParam)
+		if err != nil {
+			return invalidParam("user_id", err)
+		}
+		filter.UserID = &userID
+	}
+
+	if fromParam := c.QueryParam("from"); fromParam != "" {
+		from, err := time.Parse(time.RFC3339, fromParam)
+		if err != nil {
+			return invalidParam("from", err)
+		}
+		filter.From = &from
+	}
+
+	if toParam := c.QueryParam("to"); toParam != "" {
+		to, err := time.Parse(time.RFC3339, toParam)
+		if err != nil {
+			return invalidParam("to", err)
+		}
+		filter.To = &to
+	}
+
+	order_histories, err := data.GetArchivedOrderHistories(actorFromContext(c), filter, page, pageSize)
+	if err != nil {
+		return err
+	}
+
+	projection, err := project(c, order_histories)
+	if err != nil {
+		return err
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Archived Order Histories",
+		Data:    projection,
+	}
+
+	return writePage(c, http.StatusOK, payload, &listPage{Page: page, PageSize: pageSize, Count: len(order_histories)})
+}
+
+func ArchiveOrderHistories(c echo.Context) error {
+	olderThanMonths := config.GetOrderHistoryArchiveAfter()
+
+	if olderThanParam := c.QueryParam("older_than_months"); olderThanParam != "" {
+		var err error
+		olderThanMonths, err = strconv.Atoi(olderThanParam)
+		if err != nil {
+			return invalidParam("older_than_months", err)
+		}
+	}
+
+	archived, err := data.ArchiveOrderHistories(olderThanMonths)
+	if err != nil {
+		return err
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: strconv.Itoa(len(archived)) + " Order Histories partitions archived",
+		Data:    archived,
+	}
+
+	return writeResponse(c, http.StatusOK, payload)
+}
+
+func GetCacheStats(c echo.Context) error {
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Cache stats",
+		Data:    data.GetCacheStats(),
+	}
+
+	return writeResponse(c, http.StatusOK, payload)
 }
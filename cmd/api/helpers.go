@@ -2,9 +2,12 @@ package main
 
 import (
 	"encoding/json"
-	"errors"
 	"io"
 	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	data "gitlab.com/nezaysr/go-saham.git/data"
 )
 
 type jsonResponse struct {
@@ -13,35 +16,19 @@ type jsonResponse struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
-type CustomErrorMessage interface {
-	ErrorMessage() string
-}
-
-type MyCustomError struct {
-	msg string
-}
-
-func (e *MyCustomError) Error() string {
-	return e.msg
-}
-
-func (e *MyCustomError) ErrorMessage() string {
-	return "Custom message: " + e.msg
-}
-
-func readJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
+func readJSON(w http.ResponseWriter, r *http.Request, payload interface{}) error {
 	maxBytes := 1048576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 
 	d := json.NewDecoder(r.Body)
-	err := d.Decode(data)
+	err := d.Decode(payload)
 	if err != nil {
-		return err
+		return invalidBody(err)
 	}
 
 	err = d.Decode(&struct{}{})
 	if err != io.EOF {
-		return errors.New("body must have only a single JSON value")
+		return data.BadRequest("invalid_body", "body must have only a single JSON value")
 	}
 
 	return nil
@@ -69,20 +56,38 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}, headers ...h
 	return nil
 }
 
-func errorJSON(w http.ResponseWriter, err error, status ...int) error {
-	statusCode := http.StatusBadRequest
+// actorFromContext describes the caller of the current request for the audit
+// log, a signed in user or a service with an API key.
+func actorFromContext(c echo.Context) data.Actor {
+	actor := data.Actor{
+		Type:      data.ActorSystem,
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+		IP:        c.RealIP(),
+	}
+
+	if id, ok := c.Get("id").(string); ok {
+		if userID, err := strconv.Atoi(id); err == nil {
+			actor.ID = &userID
+			actor.Type = data.ActorUser
+		}
+	}
 
-	if len(status) > 0 {
-		statusCode = status[0]
+	if apiKey, _ := c.Get("api_key").(bool); apiKey {
+		actor.Type = data.ActorAPIKey
 	}
 
-	var payload jsonResponse
-	payload.Error = true
-	if customMsg, ok := err.(CustomErrorMessage); ok {
-		payload.Message = customMsg.ErrorMessage()
-	} else {
-		payload.Message = err.Error()
+	if role, ok := c.Get("role").(string); ok {
+		actor.Role = data.UserRole(role)
 	}
 
-	return writeJSON(w, statusCode, payload)
+	return actor
+}
+
+// userIDFromContext is the id of the signed in user, API keys don't have one.
+func userIDFromContext(c echo.Context) (int, error) {
+	actor := actorFromContext(c)
+	if actor.ID == nil {
+		return 0, errUserRequired
+	}
+	return *actor.ID, nil
 }
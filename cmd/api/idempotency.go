@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"gitlab.com/nezaysr/go-saham.git/config"
+	data "gitlab.com/nezaysr/go-saham.git/data"
+)
+
+const idempotencyHeader = "Idempotency-Key"
+
+// idempotencySecretKey is set on the context by handlers whose answer carries
+// a secret, such as a generated password, so it isn't kept in Redis.
+const idempotencySecretKey = "idempotency_secret"
+
+var errIdempotencyKeyInProgress = data.Conflict("idempotency_key_in_progress", "request with this idempotency key is still being processed")
+
+var errIdempotentResponseNotKept = data.Conflict("idempotent_response_not_kept", "request with this idempotency key was already processed, its response carried a secret and was not kept")
+
+// idempotencyBodyLimits are the routes reading bodies larger than the 1 MiB
+// buffered for other requests, the middleware reads up to their own limit.
+var idempotencyBodyLimits = map[string]int64{
+	"POST /api/v1/order-items/import": importMaxBytes,
+	"POST /order_item/import":         importMaxBytes,
+}
+
+// idempotencyUnsafeGetRoutes are GET routes that change data, the legacy
+// purchase alias, and are protected like a POST.
+var idempotencyUnsafeGetRoutes = map[string]bool{
+	"GET /users/goi/:order_item_id": true,
+}
+
+type idempotentResponse struct {
+	Fingerprint string      `json:"fingerprint"`
+	Done        bool        `json:"done"`
+	Secret      bool        `json:"secret,omitempty"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// responseRecorder keeps a copy of what the handler writes so it can be
+// replayed for a retried request carrying the same Idempotency-Key.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware replays the stored answer of a write retried with the
+// same Idempotency-Key. It goes after AuthenticationMiddleware, keys are kept
+// per session. While the first request runs its key is locked for the short
+// IDEMPOTENCY_LOCK_TTL, so a request that never finishes doesn't hold it for
+// the IDEMPOTENCY_TTL its answer is kept.
+func IdempotencyMiddleware(rdb *config.Database) echo.MiddlewareFunc {
+	ttl := config.GetIdempotencyTTL()
+	lockTTL := config.GetIdempotencyLockTTL()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			idemKey := req.Header.Get(idempotencyHeader)
+			if idemKey == "" || !isIdempotentRequest(c) {
+				return next(c)
+			}
+
+			maxBytes, ok := idempotencyBodyLimits[req.Method+" "+c.Path()]
+			if !ok {
+				maxBytes = 1048576
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(c.Response().Writer, req.Body, maxBytes))
+			if err != nil {
+				return invalidBody(err)
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			cacheKey := idempotencyCacheKey(c, idemKey)
+			fingerprint := requestFingerprint(req.Method, req.URL.RequestURI(), body)
+
+			pending, _ := json.Marshal(idempotentResponse{Fingerprint: fingerprint})
+			acquired, err := rdb.Client.SetNX(config.Ctx, cacheKey, pending, lockTTL).Result()
+			if err != nil {
+				if err != config.ErrRedisUnavailable {
+					log.Printf("Failed to reserve idempotency key: %v", err)
+				}
+				return next(c)
+			}
+
+			if !acquired {
+				return replayIdempotentResponse(c, rdb, cacheKey, fingerprint)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			// Errors are written here rather than by echo so the recorder sees
+			// them, client errors are replayed like any other answer.
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			// Server errors are not stored so that the client can safely retry them.
+			if recorder.status == 0 || recorder.status >= http.StatusInternalServerError {
+				if err := rdb.Client.Del(config.Ctx, cacheKey).Err(); err != nil {
+					log.Printf("Failed to release idempotency key: %v", err)
+				}
+				return nil
+			}
+
+			response := idempotentResponse{
+				Fingerprint: fingerprint,
+				Done:        true,
+				Status:      recorder.status,
+				Header:      recorder.Header().Clone(),
+				Body:        recorder.body.Bytes(),
+			}
+			response.Header.Del(echo.HeaderSetCookie)
+
+			// Answers carrying a secret are remembered as done without their
+			// body, a retry learns the request went through but not the secret.
+			if secret, _ := c.Get(idempotencySecretKey).(bool); secret {
+				response = idempotentResponse{Fingerprint: fingerprint, Done: true, Secret: true}
+			}
+
+			stored, err := json.Marshal(response)
+			if err != nil {
+				log.Printf("Failed to marshal idempotent response: %v", err)
+				return nil
+			}
+
+			if err := rdb.Client.Set(config.Ctx, cacheKey, stored, ttl).Err(); err != nil {
+				log.Printf("Failed to store idempotent response: %v", err)
+			}
+
+			return nil
+		}
+	}
+}
+
+func replayIdempotentResponse(c echo.Context, rdb *config.Database, cacheKey string, fingerprint string) error {
+	cachedData, err := rdb.Client.Get(config.Ctx, cacheKey).Bytes()
+	if err == redis.Nil {
+		return errIdempotencyKeyInProgress
+	} else if err != nil {
+		log.Printf("Failed to get idempotent response: %v", err)
+		return data.Unavailable("idempotency_unavailable", "the stored response can't be read, retry later").Wrap(err)
+	}
+
+	var stored idempotentResponse
+	if err := json.Unmarshal(cachedData, &stored); err != nil {
+		return err
+	}
+
+	if stored.Fingerprint != fingerprint {
+		return data.Validation("idempotency_key_reused", "idempotency key was already used with a different request")
+	}
+
+	if !stored.Done {
+		return errIdempotencyKeyInProgress
+	}
+
+	if stored.Secret {
+		return errIdempotentResponseNotKept
+	}
+
+	w := c.Response().Writer
+	for k, v := range stored.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.Status)
+	_, err = w.Write(stored.Body)
+
+	return err
+}
+
+func isIdempotentRequest(c echo.Context) bool {
+	route := c.Request().Method + " " + c.Path()
+	switch c.Request().Method {
+	case http.MethodPost, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return idempotencyUnsafeGetRoutes[route]
+}
+
+// idempotencyCacheKey scopes the client supplied key to the caller's session so
+// two users can't read each other's stored responses by picking the same key.
+func idempotencyCacheKey(c echo.Context, idemKey string) string {
+	// Keys are kept apart per session, or per API key for services.
+	credential := c.Request().Header.Get(apiKeyHeader)
+	if credential == "" {
+		credential, _ = sessionToken(c)
+	}
+
+	sum := sha256.Sum256([]byte(credential))
+	return "idempotency:" + hex.EncodeToString(sum[:8]) + ":" + idemKey
+}
+
+func requestFingerprint(method string, uri string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(uri))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
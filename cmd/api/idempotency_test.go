@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4"
+	"gitlab.com/nezaysr/go-saham.git/config"
+)
+
+func TestIdempotencyKeysOfUnauthenticatedWritesArentKept(t *testing.T) {
+	redis := miniredis.RunT(t)
+	rdb, err := config.NewDatabase(redis.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTestServer(t, rdb)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/order-items", strings.NewReader(`{"name":"UNAUTHENTICATED","price":1}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(idempotencyHeader, "unauthenticated")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("POST without a session answered %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, key := range redis.Keys() {
+		if strings.HasPrefix(key, "idempotency:") {
+			t.Errorf("the 401 was kept under %s", key)
+		}
+	}
+}
+
+func TestIdempotencyKeyIsLockedBrieflyAndKeptLong(t *testing.T) {
+	redis := miniredis.RunT(t)
+	rdb, err := config.NewDatabase(redis.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lockTTL time.Duration
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.POST("/write", func(c echo.Context) error {
+		for _, key := range redis.Keys() {
+			lockTTL = redis.TTL(key)
+		}
+		return c.NoContent(http.StatusCreated)
+	}, IdempotencyMiddleware(rdb))
+
+	req := httptest.NewRequest(http.MethodPost, "/write", nil)
+	req.Header.Set(idempotencyHeader, "locked")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST answered %d: %s", rec.Code, rec.Body.String())
+	}
+	if lockTTL <= 0 || lockTTL > config.GetIdempotencyLockTTL() {
+		t.Errorf("key was locked for %s while the request ran, want at most %s", lockTTL, config.GetIdempotencyLockTTL())
+	}
+
+	keys := redis.Keys()
+	if len(keys) != 1 {
+		t.Fatalf("got keys %v, want the stored answer", keys)
+	}
+	if ttl := redis.TTL(keys[0]); ttl != config.GetIdempotencyTTL() {
+		t.Errorf("answer is kept for %s, want %s", ttl, config.GetIdempotencyTTL())
+	}
+}
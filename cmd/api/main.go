@@ -9,6 +9,8 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"gitlab.com/nezaysr/go-saham.git/config"
+	data "gitlab.com/nezaysr/go-saham.git/data"
+	"gitlab.com/nezaysr/go-saham.git/encryption"
 	"gitlab.com/nezaysr/go-saham.git/storage"
 )
 
@@ -27,22 +29,62 @@ func main() {
 		log.Fatal("Error converting port number")
 	}
 
+	keyfile, err := config.GetEncryptionKeyfile()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if err := encryption.LoadKeyfile(keyfile); err != nil {
+		log.Fatalf("Failed to load encryption keyfile: %s", err.Error())
+	}
+
 	redisPort := os.Getenv("REDIS_PORT")
 	redisPassword := os.Getenv("REDIS_PASSWORD")
 
+	// Without Redis the API still serves, straight from the database.
 	database, err := config.NewDatabase(redisPort, redisPassword)
 	if err != nil {
-		log.Fatalf("Failed to connect to redis: %s", err.Error())
+		log.Printf("Failed to connect to redis, starting without it: %s", err.Error())
 	}
+	data.UseCache(database)
 
 	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
 	storage.NewDB()
+	if err := migrateSQLite(); err != nil {
+		log.Fatalf("Failed to migrate: %s", err.Error())
+	}
+	go data.MaintainOrderHistoryPartitions()
+	go data.ListenForCacheInvalidation()
+	go data.MaintainExportFiles()
 
 	Routes(e, database)
+	// Every route has to be in the spec, so a new one can't ship undocumented.
+	if _, err := buildOpenAPISpec(e.Routes()); err != nil {
+		log.Fatalf("OpenAPI spec is incomplete: %v", err)
+	}
+
+	if grpcPort := config.GetGRPCPort(); grpcPort != 0 {
+		go ServeGRPC(grpcPort)
+	}
 	e.Start(fmt.Sprintf(":%d", port))
 
 }
 
+// migrateSQLite brings a SQLite database up to date on startup, a ":memory:"
+// one is empty every time and can't be migrated by cmd/migrate beforehand.
+func migrateSQLite() error {
+	if config.GetDBType() != config.DBTypeSQLite {
+		return nil
+	}
+
+	if err := storage.Migrate(); err != nil {
+		return err
+	}
+
+	_, err := data.BackfillEncryptedUsers()
+	return err
+}
+
 // logger := logrus.New()
 // e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
 // 	Format: "time=${time_rfc3339} method=${method}, uri=${uri}, status=${status}\n",
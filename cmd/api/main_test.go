@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/nezaysr/go-saham.git/config"
+	data "gitlab.com/nezaysr/go-saham.git/data"
+	"gitlab.com/nezaysr/go-saham.git/encryption"
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+// The tests run against a ":memory:" SQLite database migrated like on
+// startup, with Redis unreachable unless a test says otherwise.
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "go-saham-api")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Setenv("DBType", config.DBTypeSQLite)
+	os.Setenv("DBPath", ":memory:")
+	os.Setenv("EXPORT_DIR", filepath.Join(dir, "exports"))
+
+	if err := loadTestKeyfile(filepath.Join(dir, "keys.json")); err != nil {
+		log.Fatal(err)
+	}
+
+	storage.NewDB()
+	if err := migrateSQLite(); err != nil {
+		log.Fatalf("Failed to migrate: %s", err.Error())
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func loadTestKeyfile(path string) error {
+	masterKey, err := encryption.GenerateKey()
+	if err != nil {
+		return err
+	}
+	blindIndexKey, err := encryption.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(encryption.Keyfile{
+		Active:        "test",
+		Keys:          map[string]string{"test": masterKey},
+		BlindIndexKey: blindIndexKey,
+	})
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+		return err
+	}
+
+	return encryption.LoadKeyfile(path)
+}
+
+// newTestServer routes an echo instance like main, using rdb for Redis.
+func newTestServer(t *testing.T, rdb *config.Database) *echo.Echo {
+	t.Helper()
+
+	if rdb == nil {
+		rdb, _ = config.NewDatabase("127.0.0.1:1", "")
+	}
+	data.UseCache(rdb)
+
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	Routes(e, rdb)
+	return e
+}
+
+// signinCookies signs in as the admin created by the first migration.
+func signinCookies(t *testing.T, e *echo.Echo) []*http.Cookie {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/signin", strings.NewReader(`{"username":"admin","password":"admin"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("signin answered %d: %s", rec.Code, rec.Body.String())
+	}
+	return rec.Result().Cookies()
+}
+
+func TestStartupMigratesInMemorySQLite(t *testing.T) {
+	e := newTestServer(t, nil)
+	cookies := signinCookies(t, e)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/1", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/users/1 answered %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var payload struct {
+		Data data.Users `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Data.Username != "admin" {
+		t.Errorf("got username %q, want admin", payload.Data.Username)
+	}
+}
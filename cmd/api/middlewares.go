@@ -1,14 +1,19 @@
 package main
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo/v4"
+	"gitlab.com/nezaysr/go-saham.git/config"
+	data "gitlab.com/nezaysr/go-saham.git/data"
 )
 
 func setJWTToCookie(c echo.Context, tokenString string) error {
@@ -25,26 +30,66 @@ func setJWTToCookie(c echo.Context, tokenString string) error {
 	return nil
 }
 
+// apiKeyHeader carries the API key of a service calling as itself.
+const apiKeyHeader = "X-API-Key"
+
+var (
+	errMissingSession = data.Unauthorized("missing_session", "sign in first")
+	errInvalidSession = data.Unauthorized("invalid_session", "session is invalid or expired, sign in again")
+	errInvalidAPIKey  = data.Unauthorized("invalid_api_key", "API key is unknown")
+	errUserRequired   = data.Forbidden("user_required", "this is about the signed in user, sign in instead of using an API key")
+)
+
+// sessionToken is the JWT of the session_token cookie or, for clients that
+// don't keep cookies, of an "Authorization: Bearer" header.
+func sessionToken(c echo.Context) (string, error) {
+	if cookie, err := c.Cookie("session_token"); err == nil {
+		return cookie.Value, nil
+	}
+
+	authorization := c.Request().Header.Get(echo.HeaderAuthorization)
+	if token := strings.TrimPrefix(authorization, "Bearer "); token != authorization && token != "" {
+		return token, nil
+	}
+
+	return "", http.ErrNoCookie
+}
+
+// AuthenticationMiddleware lets signed in users through, and services sending
+// one of the API_KEYS in the X-API-Key header. A service acts with the role of
+// its key and isn't a user, so it has no "id".
 func AuthenticationMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		cookie, err := c.Cookie("session_token")
+		if key := c.Request().Header.Get(apiKeyHeader); key != "" {
+			role, ok := apiKeyRole(key)
+			if !ok {
+				return errInvalidAPIKey
+			}
+
+			c.Set("api_key", true)
+			c.Set("role", role)
+
+			return next(c)
+		}
+
+		tokenString, err := sessionToken(c)
 		if err != nil {
-			return errorJSON(c.Response().Writer, err, http.StatusUnauthorized)
+			return errMissingSession.Wrap(err)
 		}
 
-		tokenString := cookie.Value
-		id, err := verifyToken(tokenString)
+		id, role, err := verifyToken(tokenString)
 		if err != nil {
-			return errorJSON(c.Response().Writer, err, http.StatusUnauthorized)
+			return errInvalidSession.Wrap(err)
 		}
 
 		c.Set("id", id)
+		c.Set("role", role)
 
 		return next(c)
 	}
 }
 
-func verifyToken(tokenString string) (string, error) {
+func verifyToken(tokenString string) (string, string, error) {
 	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
 		_, ok := t.Method.(*jwt.SigningMethodHMAC)
 		if ok != true {
@@ -53,41 +98,48 @@ func verifyToken(tokenString string) (string, error) {
 		return []byte(os.Getenv("JWT_SECRET")), nil
 	})
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	if !token.Valid {
-		return "", fmt.Errorf("invalid token")
+		return "", "", fmt.Errorf("invalid token")
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
-		return "", fmt.Errorf("invalid token")
+		return "", "", fmt.Errorf("invalid token")
 	}
 
 	exp, ok := claims["exp"].(float64)
 	if !ok {
-		return "", fmt.Errorf("Invalid expiration time")
+		return "", "", fmt.Errorf("Invalid expiration time")
 	}
 
 	if time.Now().Unix() > int64(exp) {
-		return "", fmt.Errorf("Token expired")
+		return "", "", fmt.Errorf("Token expired")
 	}
 
 	idInt := int(claims["id"].(float64))
 	id := strconv.Itoa(idInt)
+	role, _ := claims["role"].(string)
 
-	return id, nil
+	return id, role, nil
 }
 
 func RoleRequiredMiddleware(next echo.HandlerFunc, role string) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		cookie, err := c.Cookie("session_token")
-		if err != nil {
-			return errorJSON(c.Response().Writer, err, http.StatusUnauthorized)
+		// API keys were checked by AuthenticationMiddleware, which set their role.
+		if apiKey, _ := c.Get("api_key").(bool); apiKey {
+			if c.Get("role") != role {
+				return data.Forbidden("role_required", "this needs the "+role+" role")
+			}
+			return next(c)
 		}
 
-		cookieValue := cookie.Value
+		cookieValue, err := sessionToken(c)
+		if err != nil {
+			return errMissingSession.Wrap(err)
+		}
 
 		token, err := jwt.Parse(cookieValue, func(t *jwt.Token) (interface{}, error) {
 			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -98,12 +150,44 @@ func RoleRequiredMiddleware(next echo.HandlerFunc, role string) echo.HandlerFunc
 		})
 
 		claims, _ := token.Claims.(jwt.MapClaims)
-		customErr := fmt.Errorf("%s", "Unauthorized!!")
 		if claims["role"] != role {
-			return errorJSON(c.Response().Writer, customErr, http.StatusUnauthorized)
-
+			return data.Forbidden("role_required", "this needs the "+role+" role")
 		}
 
 		return next(c)
 	}
 }
+
+// apiKeyRole returns the role of the API_KEYS entry key hashes to.
+func apiKeyRole(key string) (string, bool) {
+	sum := sha256.Sum256([]byte(key))
+	for _, apiKey := range config.GetAPIKeys() {
+		if subtle.ConstantTimeCompare(sum[:], apiKey.Hash) == 1 {
+			return apiKey.Role, true
+		}
+	}
+	return "", false
+}
+
+// Deprecated marks a route from before /api/v1. It answers as before, with
+// headers pointing at successor, a path that may use the route's params, and
+// telling when the route goes away.
+func Deprecated(successor string) echo.MiddlewareFunc {
+	sunset := config.GetLegacyRoutesSunset().Format(http.TimeFormat)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			link := successor
+			for _, name := range c.ParamNames() {
+				link = strings.ReplaceAll(link, ":"+name, c.Param(name))
+			}
+
+			header := c.Response().Header()
+			header.Set("Deprecation", "true")
+			header.Set("Sunset", sunset)
+			header.Set("Link", "<"+link+`>; rel="successor-version"`)
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/nezaysr/go-saham.git/data"
+)
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	hash := func(key string) string {
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	}
+	t.Setenv("API_KEYS", "risk:admin:"+hash("admin-key")+",reports:user:"+hash("user-key"))
+
+	e := newTestServer(t, nil)
+	request := func(method string, target string, key string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(apiKeyHeader, key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		target string
+		key    string
+		want   int
+	}{
+		{"admin key on an admin route", http.MethodGet, "/api/v1/users", "admin-key", http.StatusOK},
+		{"user key on an admin route", http.MethodGet, "/api/v1/users", "user-key", http.StatusForbidden},
+		{"user key on a user route", http.MethodGet, "/api/v1/order-items", "user-key", http.StatusOK},
+		{"unknown key", http.MethodGet, "/api/v1/order-items", "wrong-key", http.StatusUnauthorized},
+		{"key on the signed in user's orders", http.MethodGet, "/api/v1/orders", "admin-key", http.StatusForbidden},
+	} {
+		if rec := request(tc.method, tc.target, tc.key, ""); rec.Code != tc.want {
+			t.Errorf("%s: got %d, want %d: %s", tc.name, rec.Code, tc.want, rec.Body.String())
+		}
+	}
+
+	expiredAt := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	rec := request(http.MethodPost, "/api/v1/order-items", "admin-key", `{"name":"API KEY ITEM","price":100,"expired_at":"`+expiredAt+`"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create with an API key answered %d: %s", rec.Code, rec.Body.String())
+	}
+	id := path.Base(rec.Header().Get(echo.HeaderLocation))
+
+	rec = request(http.MethodGet, "/api/v1/audit-log?entity_type=orders_items&entity_id="+id, "admin-key", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("audit log answered %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Data []struct {
+			ActorID   *int           `json:"actor_id"`
+			ActorType data.ActorType `json:"actor_type"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Data) != 1 {
+		t.Fatalf("got %d audit entries for order item %s, want 1", len(response.Data), id)
+	}
+	if entry := response.Data[0]; entry.ActorType != data.ActorAPIKey || entry.ActorID != nil {
+		t.Errorf("audit entry actor = %s %v, want an API key without id", entry.ActorType, entry.ActorID)
+	}
+}
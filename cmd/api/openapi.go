@@ -0,0 +1,522 @@
+package main
+
+import (
+	embedfs "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	data "gitlab.com/nezaysr/go-saham.git/data"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// docsAssets are the Swagger UI files docs.html loads, vendored so the page
+// works without reaching a CDN.
+//
+//go:embed swagger-ui/swagger-ui-bundle.js swagger-ui/swagger-ui.css
+var docsAssets embedfs.FS
+
+// routeDoc describes a route in the OpenAPI spec. Body is the data payload the
+// request body ends up in, minus the Omit fields the route fills in itself,
+// and Response is what the route returns in the data of jsonResponse.
+type routeDoc struct {
+	Summary   string
+	Tag       string
+	Public    bool
+	Admin     bool
+	Query     []queryParam
+	Body      interface{}
+	Omit      []string
+	BodyTypes []string
+	Status    int
+	Response  interface{}
+	// Produces is set for routes answering with a file instead of JSON.
+	Produces []string
+}
+
+type queryParam struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+var paginationParams = []queryParam{
+	{Name: "page", Type: "integer", Description: "page number, starting at 1"},
+	{Name: "pageSize", Type: "integer", Description: "rows per page, 10 by default"},
+}
+
+// projectionParams are ?fields= and ?include= of the routes calling project,
+// include lists the relations of the route's rows.
+func projectionParams(include string) []queryParam {
+	params := []queryParam{{Name: "fields", Type: "string", Description: "comma separated fields to return, \"order_item.name\" for a field of an included relation"}}
+	if include != "" {
+		params = append(params, queryParam{Name: "include", Type: "string", Description: "comma separated relations to embed: " + include})
+	}
+	return params
+}
+
+func queryParams(groups ...[]queryParam) []queryParam {
+	params := []queryParam{}
+	for _, group := range groups {
+		params = append(params, group...)
+	}
+	return params
+}
+
+var routeDocs = map[string]routeDoc{
+	"GET /ping/:your_name": {Summary: "Check the API is alive", Tag: "health", Public: true, Status: http.StatusOK, Response: ""},
+	"GET /ready":           {Summary: "Check the API can serve, Redis down is reported as degraded", Tag: "health", Public: true, Status: http.StatusOK, Response: map[string]string{}},
+	"GET /openapi.json":    {Summary: "This document", Tag: "health", Public: true, Status: http.StatusOK, Produces: []string{"application/json"}},
+	"GET /docs":            {Summary: "API documentation", Tag: "health", Public: true, Status: http.StatusOK, Produces: []string{"text/html"}},
+	"GET /docs/assets/*":   {Summary: "Swagger UI scripts and styles of the API documentation", Tag: "health", Public: true, Status: http.StatusOK, Produces: []string{"application/javascript", "text/css"}},
+
+	"POST /api/v1/auth/signin":  {Summary: "Sign in, the session is set in the session_token cookie", Tag: "auth", Public: true, Body: data.SigninPayload{}, Status: http.StatusOK},
+	"POST /api/v1/auth/signout": {Summary: "Sign out", Tag: "auth", Public: true, Status: http.StatusOK},
+
+	"GET /api/v1/users":                                         {Summary: "List users", Tag: "users", Admin: true, Query: queryParams(paginationParams, projectionParams("first_order")), Status: http.StatusOK, Response: []data.Users{}},
+	"POST /api/v1/users":                                        {Summary: "Create a user, the generated password is returned once", Tag: "users", Admin: true, Body: data.InsertUserPayload{}, Omit: []string{"password"}, Status: http.StatusCreated, Response: ""},
+	"GET /api/v1/users/:user_id":                                {Summary: "Get a user", Tag: "users", Query: projectionParams("first_order"), Status: http.StatusOK, Response: data.Users{}},
+	"PUT /api/v1/users/:user_id":                                {Summary: "Update a user", Tag: "users", Body: data.UpdateUserPayload{}, Omit: []string{"id"}, Status: http.StatusOK, Response: ""},
+	"DELETE /api/v1/users/:user_id":                             {Summary: "Delete a user", Tag: "users", Admin: true, Status: http.StatusNoContent},
+	"GET /api/v1/users/:user_id/data":                           {Summary: "Export everything stored about a user", Tag: "personal data", Admin: true, Query: []queryParam{{Name: "format", Type: "string", Description: "zip for a ZIP of JSON files"}}, Status: http.StatusOK, Response: data.UserDataBundle{}},
+	"POST /api/v1/users/:user_id/erasure-requests":              {Summary: "Request erasure of a user's personal data, another admin approves it", Tag: "personal data", Admin: true, Body: data.InsertErasureRequestPayload{}, Omit: []string{"user_id"}, Status: http.StatusCreated, Response: data.ErasureRequest{}},
+	"GET /api/v1/erasure-requests":                              {Summary: "List erasure requests", Tag: "personal data", Admin: true, Query: paginationParams, Status: http.StatusOK, Response: []data.ErasureRequest{}},
+	"POST /api/v1/erasure-requests/:erasure_request_id/approve": {Summary: "Approve and run an erasure request", Tag: "personal data", Admin: true, Status: http.StatusOK, Response: data.ErasureRequest{}},
+	"POST /api/v1/erasure-requests/:erasure_request_id/reject":  {Summary: "Reject an erasure request", Tag: "personal data", Admin: true, Status: http.StatusOK, Response: data.ErasureRequest{}},
+
+	"GET /api/v1/order-items":                   {Summary: "List order items", Tag: "order items", Query: queryParams(paginationParams, projectionParams("")), Status: http.StatusOK, Response: []data.OrdersItem{}},
+	"POST /api/v1/order-items":                  {Summary: "Create an order item", Tag: "order items", Admin: true, Body: data.InsertOrderItemPayload{}, Status: http.StatusCreated, Response: ""},
+	"GET /api/v1/order-items/:order_item_id":    {Summary: "Get an order item", Tag: "order items", Query: projectionParams(""), Status: http.StatusOK, Response: data.OrdersItem{}},
+	"PUT /api/v1/order-items/:order_item_id":    {Summary: "Replace an order item", Tag: "order items", Admin: true, Body: data.UpdateOrderItemPayload{}, Omit: []string{"id"}, Status: http.StatusOK, Response: ""},
+	"DELETE /api/v1/order-items/:order_item_id": {Summary: "Delete an order item", Tag: "order items", Admin: true, Status: http.StatusNoContent},
+	"POST /api/v1/order-items/import": {Summary: "Import order items from CSV (name,price,expired_at) or NDJSON, nothing is written unless every row is valid", Tag: "order items", Admin: true, Query: []queryParam{
+		{Name: "format", Type: "string", Description: "csv or ndjson, taken from Content-Type when missing"},
+		{Name: "dry_run", Type: "boolean", Description: "only validate the rows"},
+		{Name: "upsert", Type: "boolean", Description: "update order items with the same name"},
+	}, BodyTypes: []string{"text/csv", "application/x-ndjson"}, Status: http.StatusOK, Response: data.ImportReport{}},
+
+	"GET /api/v1/orders":                      {Summary: "List the signed in user's orders", Tag: "orders", Query: queryParams(paginationParams, projectionParams("order_item, user")), Status: http.StatusOK, Response: []data.OrdersHistories{}},
+	"POST /api/v1/orders":                     {Summary: "Buy an order item", Tag: "orders", Body: data.InsertOrderHistoryPayload{}, Omit: []string{"user_id"}, Status: http.StatusCreated, Response: ""},
+	"DELETE /api/v1/orders/:order_history_id": {Summary: "Remove an order", Tag: "orders", Status: http.StatusNoContent},
+
+	"POST /api/v1/graphql": {Summary: "Run a GraphQL query, answered with {data, errors} rather than the usual envelope", Tag: "graphql", Body: graphQLPayload{}, Status: http.StatusOK, Produces: []string{"application/json"}},
+
+	"GET /api/v1/order-histories": {Summary: "List everyone's order histories", Tag: "order histories", Admin: true, Query: queryParams(paginationParams, projectionParams("order_item, user")), Status: http.StatusOK, Response: []data.OrdersHistories{}},
+	"GET /api/v1/order-histories/archive": {Summary: "List archived order histories", Tag: "order histories", Admin: true, Query: queryParams([]queryParam{
+		{Name: "user_id", Type: "integer"},
+		{Name: "from", Type: "date-time"},
+		{Name: "to", Type: "date-time"},
+	}, paginationParams, projectionParams("order_item, user")), Status: http.StatusOK, Response: []data.OrdersHistories{}},
+	"POST /api/v1/order-histories/archive": {Summary: "Archive old order histories partitions", Tag: "order histories", Admin: true, Query: []queryParam{{Name: "older_than_months", Type: "integer"}}, Status: http.StatusOK, Response: []string{}},
+
+	"GET /api/v1/audit-log": {Summary: "List audit log entries", Tag: "audit log", Admin: true, Query: append([]queryParam{
+		{Name: "actor_id", Type: "integer"},
+		{Name: "entity_type", Type: "string"},
+		{Name: "entity_id", Type: "integer"},
+		{Name: "action", Type: "string"},
+		{Name: "from", Type: "date-time"},
+		{Name: "to", Type: "date-time"},
+	}, paginationParams...), Status: http.StatusOK, Response: []data.AuditLog{}},
+
+	"GET /api/v1/cache/stats": {Summary: "Cache hits and misses of this process", Tag: "cache", Admin: true, Status: http.StatusOK, Response: map[string]data.CacheStats{}},
+
+	"GET /api/v1/exports/:entity": {Summary: "Stream users, order_items or order_histories", Tag: "exports", Admin: true, Query: append([]queryParam{
+		{Name: "format", Type: "string", Description: "csv, ndjson or xlsx"},
+		{Name: "user_id", Type: "integer", Description: "order_histories only"},
+	}, paginationParams...), Status: http.StatusOK, Produces: []string{"text/csv", "application/x-ndjson", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"}},
+	"POST /api/v1/exports/:entity/jobs": {Summary: "Start a background export", Tag: "exports", Admin: true, Query: append([]queryParam{
+		{Name: "format", Type: "string", Description: "csv, ndjson or xlsx"},
+		{Name: "user_id", Type: "integer", Description: "order_histories only"},
+	}, paginationParams...), Status: http.StatusAccepted, Response: data.ExportJob{}},
+	"GET /api/v1/exports/jobs/:job_id":          {Summary: "Get a background export", Tag: "exports", Admin: true, Status: http.StatusOK, Response: data.ExportJob{}},
+	"GET /api/v1/exports/jobs/:job_id/download": {Summary: "Download a finished background export", Tag: "exports", Admin: true, Status: http.StatusOK, Produces: []string{"application/octet-stream"}},
+}
+
+// pathParamsOfTypeString are the path params that aren't ids.
+var pathParamsOfTypeString = map[string]bool{"your_name": true, "entity": true, "job_id": true}
+
+var pathParamPattern = regexp.MustCompile(`:(\w+)`)
+
+var notFoundHandlerName = runtime.FuncForPC(reflect.ValueOf(echo.NotFoundHandler).Pointer()).Name()
+
+// buildOpenAPISpec describes routes, every one of them needs an entry in
+// routeDocs or has to be a legacy alias of one.
+func buildOpenAPISpec(routes []*echo.Route) (map[string]interface{}, error) {
+	schemas := newSchemaRegistry()
+	paths := map[string]map[string]interface{}{}
+	undocumented := []string{}
+
+	for _, route := range routes {
+		// Groups with middlewares catch everything under them with NotFoundHandler.
+		if route.Method == echo.RouteNotFound || route.Name == notFoundHandlerName {
+			continue
+		}
+
+		doc, ok := routeDocFor(route.Method, route.Path)
+		_, deprecated := legacySuccessors[route.Method+" "+route.Path]
+		if !ok {
+			undocumented = append(undocumented, route.Method+" "+route.Path)
+			continue
+		}
+
+		path := pathParamPattern.ReplaceAllString(route.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(route.Method)] = schemas.operation(route, doc, deprecated)
+	}
+
+	if len(undocumented) > 0 {
+		sort.Strings(undocumented)
+		return nil, fmt.Errorf("routes missing from routeDocs: %s", strings.Join(undocumented, ", "))
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":   "go-saham",
+			"version": "v1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				"session": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": "session_token"},
+				"bearer":  map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKey":  map[string]interface{}{"type": "apiKey", "in": "header", "name": apiKeyHeader},
+			},
+		},
+	}, nil
+}
+
+// OpenAPIHandler serves the spec of every route registered on e, built on the
+// first request once all of them are.
+func OpenAPIHandler(e *echo.Echo) echo.HandlerFunc {
+	var once sync.Once
+	var spec []byte
+	var specErr error
+
+	return func(c echo.Context) error {
+		once.Do(func() {
+			var document map[string]interface{}
+			document, specErr = buildOpenAPISpec(e.Routes())
+			if specErr == nil {
+				spec, specErr = json.Marshal(document)
+			}
+		})
+		if specErr != nil {
+			return specErr
+		}
+
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, spec)
+	}
+}
+
+func DocsHandler(c echo.Context) error {
+	return c.HTMLBlob(http.StatusOK, docsPage)
+}
+
+// DocsAssetsHandler serves the vendored Swagger UI files.
+var DocsAssetsHandler = echo.StaticDirectoryHandler(echo.MustSubFS(docsAssets, "swagger-ui"), false)
+
+type schemaRegistry struct {
+	components map[string]interface{}
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	r := &schemaRegistry{components: map[string]interface{}{}}
+	r.components["Problem"] = r.object(reflect.TypeOf(problem{}), nil)
+	r.components["ResponseMeta"] = r.object(reflect.TypeOf(responseMeta{}), nil)
+	r.components["ResponseLinks"] = r.object(reflect.TypeOf(responseLinks{}), nil)
+	return r
+}
+
+func (r *schemaRegistry) operation(route *echo.Route, doc routeDoc, deprecated bool) map[string]interface{} {
+	operation := map[string]interface{}{
+		"summary":     doc.Summary,
+		"tags":        []string{doc.Tag},
+		"operationId": operationID(route),
+	}
+	if deprecated {
+		operation["deprecated"] = true
+	}
+	if doc.Admin {
+		operation["description"] = "Admins only."
+	}
+	if !doc.Public {
+		operation["security"] = []map[string][]string{{"session": {}}, {"bearer": {}}, {"apiKey": {}}}
+	}
+
+	parameters := []map[string]interface{}{}
+	for _, match := range pathParamPattern.FindAllStringSubmatch(route.Path, -1) {
+		schema := map[string]interface{}{"type": "integer"}
+		if pathParamsOfTypeString[match[1]] {
+			schema = map[string]interface{}{"type": "string"}
+		}
+		parameters = append(parameters, map[string]interface{}{"name": match[1], "in": "path", "required": true, "schema": schema})
+	}
+	for _, param := range doc.Query {
+		schema := map[string]interface{}{"type": param.Type}
+		if param.Type == "date-time" {
+			schema = map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		parameters = append(parameters, map[string]interface{}{"name": param.Name, "in": "query", "description": param.Description, "schema": schema})
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if doc.Body != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": r.object(reflect.TypeOf(doc.Body), doc.Omit)},
+			},
+		}
+	} else if len(doc.BodyTypes) > 0 {
+		content := map[string]interface{}{}
+		for _, contentType := range doc.BodyTypes {
+			content[contentType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		}
+		operation["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+
+	responses := map[string]interface{}{}
+	success := map[string]interface{}{"description": http.StatusText(doc.Status)}
+	switch {
+	case doc.Status == http.StatusNoContent:
+	case len(doc.Produces) > 0:
+		content := map[string]interface{}{}
+		for _, contentType := range doc.Produces {
+			content[contentType] = map[string]interface{}{}
+		}
+		success["content"] = content
+	default:
+		envelope := map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"error":   map[string]interface{}{"type": "boolean"},
+				"message": map[string]interface{}{"type": "string"},
+			},
+			"required": []string{"error", "message"},
+		}
+		if doc.Response != nil {
+			envelope["properties"].(map[string]interface{})["data"] = r.schema(reflect.TypeOf(doc.Response))
+		}
+
+		// The rich envelope is the same with meta and links.
+		rich := map[string]interface{}{"type": "object", "properties": map[string]interface{}{
+			"meta":  map[string]interface{}{"$ref": "#/components/schemas/ResponseMeta"},
+			"links": map[string]interface{}{"$ref": "#/components/schemas/ResponseLinks"},
+		}, "required": []string{"error", "message", "meta", "links"}}
+		for name, property := range envelope["properties"].(map[string]interface{}) {
+			rich["properties"].(map[string]interface{})[name] = property
+		}
+
+		content := map[string]interface{}{
+			"application/json":    map[string]interface{}{"schema": envelope},
+			richEnvelopeMediaType: map[string]interface{}{"schema": rich},
+		}
+		// The binary formats carry the same envelope, CSV only the rows.
+		for _, encoder := range responseEncoders {
+			if encoder.mediaTypes[0] != "application/json" && !encoder.rich && (!encoder.lists || isList(doc.Response)) {
+				content[encoder.mediaTypes[0]] = map[string]interface{}{}
+			}
+		}
+		success["content"] = content
+	}
+	responses[fmt.Sprint(doc.Status)] = success
+	responses["default"] = map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			problemContentType: map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Problem"}},
+		},
+	}
+	operation["responses"] = responses
+
+	return operation
+}
+
+// routeDocFor returns the doc of the route with method and path, legacy
+// aliases answer like their successor with the same method and params, when
+// there is one.
+func routeDocFor(method string, path string) (routeDoc, bool) {
+	successor, isLegacy := legacySuccessors[method+" "+path]
+	if !isLegacy {
+		doc, ok := routeDocs[method+" "+path]
+		return doc, ok
+	}
+
+	doc, ok := routeDocs[method+" "+successor]
+	if !ok || strings.Join(pathParamPattern.FindAllString(path, -1), "") != strings.Join(pathParamPattern.FindAllString(successor, -1), "") {
+		doc = routeDoc{Status: http.StatusOK}
+	}
+	doc.Summary, doc.Tag = "Deprecated, use "+successor, "legacy"
+	return doc, true
+}
+
+func operationID(route *echo.Route) string {
+	words := strings.FieldsFunc(strings.ToLower(route.Method)+"/"+route.Path, func(r rune) bool {
+		return r == '/' || r == ':' || r == '-' || r == '_' || r == '.'
+	})
+	for i := 1; i < len(words); i++ {
+		words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+	}
+	return strings.Join(words, "")
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+var enumValues = map[reflect.Type][]string{
+	reflect.TypeOf(data.UserRole("")):      {string(data.Admin), string(data.User), string(data.Retired)},
+	reflect.TypeOf(data.ActorType("")):     {string(data.ActorUser), string(data.ActorAPIKey), string(data.ActorSystem)},
+	reflect.TypeOf(data.AuditAction("")):   {string(data.AuditCreate), string(data.AuditUpdate), string(data.AuditDelete), string(data.AuditSignin), string(data.AuditErase)},
+	reflect.TypeOf(data.ErasureStatus("")): {string(data.ErasurePending), string(data.ErasureCompleted), string(data.ErasureRejected)},
+}
+
+// schema describes t, named structs go to the components and are referenced.
+func (r *schemaRegistry) schema(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if values, ok := enumValues[t]; ok {
+		return map[string]interface{}{"type": "string", "enum": values}
+	}
+	if t.Kind() != reflect.Ptr && t.Implements(jsonMarshalerType) {
+		// Encodes itself, anything goes.
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return nullable(r.schema(t.Elem()))
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.object(t, nil)
+		}
+		if _, ok := r.components[t.Name()]; !ok {
+			// Reserved first so a struct referring to itself stops here.
+			r.components[t.Name()] = nil
+			r.components[t.Name()] = r.object(t, nil)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": r.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": r.schema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+// object describes the JSON fields of struct t but omit, with the constraints
+// of their validate rules.
+func (r *schemaRegistry) object(t reflect.Type, omit []string) map[string]interface{} {
+	omitted := map[string]bool{}
+	for _, name := range omit {
+		omitted[name] = true
+	}
+
+	properties := map[string]interface{}{}
+	jsonNames := map[string]string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" || field.Tag.Get("sensitive") == "true" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		jsonNames[field.Name] = name
+		if !omitted[name] {
+			properties[name] = r.schema(field.Type)
+		}
+	}
+
+	required := []string{}
+	for _, field := range data.PayloadRules(reflect.New(t).Interface()) {
+		property, ok := properties[field.Field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		// Constraints go next to the type, not next to a $ref or a oneOf.
+		constrained := property
+		if options, ok := property["oneOf"].([]map[string]interface{}); ok {
+			constrained = options[0]
+		}
+
+		for _, rule := range field.Rules {
+			switch rule.Name {
+			case "required":
+				required = append(required, field.Field)
+			case "min", "max":
+				keyword := map[string]string{"min": "minimum", "max": "maximum"}[rule.Name]
+				if isStringSchema(constrained) {
+					keyword = map[string]string{"min": "minLength", "max": "maxLength"}[rule.Name]
+				}
+				constrained[keyword] = json.Number(rule.Param)
+			case "pattern":
+				constrained["pattern"] = rule.Param
+			case "future":
+				property["description"] = "has to be in the future"
+			case "gtfield":
+				property["description"] = "has to be after " + jsonNames[rule.Param]
+			case "gtefield":
+				property["description"] = "can't be before " + jsonNames[rule.Param]
+			}
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func isStringSchema(schema map[string]interface{}) bool {
+	switch t := schema["type"].(type) {
+	case string:
+		return t == "string"
+	case []string:
+		return len(t) > 0 && t[0] == "string"
+	}
+	return false
+}
+
+// nullable lets schema be null too, the OpenAPI 3.1 way.
+func nullable(schema map[string]interface{}) map[string]interface{} {
+	if t, ok := schema["type"].(string); ok {
+		nullableSchema := map[string]interface{}{}
+		for k, v := range schema {
+			nullableSchema[k] = v
+		}
+		nullableSchema["type"] = []string{t, "null"}
+		return nullableSchema
+	}
+
+	return map[string]interface{}{"oneOf": []map[string]interface{}{schema, {"type": "null"}}}
+}
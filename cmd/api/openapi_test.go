@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestOpenAPISpecCoversEveryRoute(t *testing.T) {
+	e := newTestServer(t, nil)
+
+	spec, err := buildOpenAPISpec(e.Routes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := spec["paths"].(map[string]map[string]interface{})
+
+	for _, route := range e.Routes() {
+		if route.Method == echo.RouteNotFound || route.Name == notFoundHandlerName {
+			continue
+		}
+
+		path := pathParamPattern.ReplaceAllString(route.Path, "{$1}")
+		if _, ok := paths[path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("%s %s is missing from the spec", route.Method, route.Path)
+		}
+	}
+}
+
+func TestDocsLoadVendoredSwaggerUI(t *testing.T) {
+	e := newTestServer(t, nil)
+
+	if strings.Contains(string(docsPage), "://") {
+		t.Errorf("docs.html loads assets from another host:\n%s", docsPage)
+	}
+
+	for path, contentType := range map[string]string{
+		"/docs/assets/swagger-ui-bundle.js": "javascript",
+		"/docs/assets/swagger-ui.css":       "text/css",
+	} {
+		if !strings.Contains(string(docsPage), path) {
+			t.Errorf("docs.html doesn't load %s", path)
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s answered %d", path, rec.Code)
+		}
+		if got := rec.Header().Get(echo.HeaderContentType); !strings.Contains(got, contentType) {
+			t.Errorf("GET %s has Content-Type %q, want %s", path, got, contentType)
+		}
+	}
+}
@@ -9,42 +9,162 @@ import (
 )
 
 func Routes(e *echo.Echo, rdb *config.Database) {
+	e.Use(middleware.RequestID())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"https://*", "http://*"},
 		AllowMethods: []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodOptions},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, apiKeyHeader, idempotencyHeader},
 	}))
+	e.Use(AcceptMiddleware)
 
 	e.GET("/ping/:your_name", heartbeat)
+	e.GET("/ready", Readiness(rdb))            //GET readiness, degraded while Redis is down
+	e.GET("/openapi.json", OpenAPIHandler(e))  //GET OpenAPI spec of every route
+	e.GET("/docs", DocsHandler)                //GET Swagger UI for the spec
+	e.GET("/docs/assets/*", DocsAssetsHandler) //GET Swagger UI scripts and styles
+
+	// Only authenticated writes are made idempotent, so a caller has to sign in,
+	// or send an API key, before the middleware buffers its body or keeps its answer.
+	idempotent := IdempotencyMiddleware(rdb)
+
+	api := e.Group("/api/v1")
 
 	// Auth Routes
-	authRoutes := e.Group("/auth")
-	authRoutes.POST("/si", SigninHandler) //SIGNIN user
-	authRoutes.POST("/so", UserSignout)   //SIGNOUT user
+	authRoutes := api.Group("/auth")
+	authRoutes.POST("/signin", SigninHandler) //SIGNIN user
+	authRoutes.POST("/signout", UserSignout)  //SIGNOUT user
 
 	// User Routes
-	userRoutes := e.Group("/users")
-	userRoutes.Use(AuthenticationMiddleware)
-	userRoutes.GET("/gl", RoleRequiredMiddleware(GetUsers(rdb), "admin"))          //GET user list
-	userRoutes.GET("/g/:user_id", GetAUser)                                        //GET a user by ID
-	userRoutes.POST("/c", RoleRequiredMiddleware(CreateAUser, "admin"))            //CREATE a new user
-	userRoutes.PUT("/u/:user_id", UpdateAUser)                                     //UPDATE a user
-	userRoutes.DELETE("/d/:user_id", RoleRequiredMiddleware(DeleteAUser, "admin")) //DELETE a user
-	userRoutes.GET("/goi/:order_item_id", UserGetOrderItem)                        //GET a user gets an order item
-	userRoutes.DELETE("/roi/:order_history_id", UserRemoveOrderItem)               //GET a user removes an order item
+	userRoutes := api.Group("/users")
+	userRoutes.Use(AuthenticationMiddleware, idempotent)
+	userRoutes.GET("", RoleRequiredMiddleware(GetUsers, "admin"))                                      //GET user list
+	userRoutes.POST("", RoleRequiredMiddleware(CreateAUser, "admin"))                                  //CREATE a new user
+	userRoutes.GET("/:user_id", GetAUser)                                                              //GET a user by ID
+	userRoutes.PUT("/:user_id", UpdateAUser)                                                           //UPDATE a user
+	userRoutes.DELETE("/:user_id", RoleRequiredMiddleware(DeleteAUser, "admin"))                       //DELETE a user
+	userRoutes.GET("/:user_id/data", RoleRequiredMiddleware(ExportUserData, "admin"))                  //GET all personal data of a user
+	userRoutes.POST("/:user_id/erasure-requests", RoleRequiredMiddleware(RequestUserErasure, "admin")) //REQUEST erasure of a user's personal data
 
 	// Order Item Routes
+	orderItemRoutes := api.Group("/order-items")
+	orderItemRoutes.Use(AuthenticationMiddleware, idempotent)
+	orderItemRoutes.GET("", GetOrderItemList)                                                     //GET order item list
+	orderItemRoutes.POST("", RoleRequiredMiddleware(CreateAnOrderItem, "admin"))                  //CREATE a new order item
+	orderItemRoutes.POST("/import", RoleRequiredMiddleware(ImportOrderItems, "admin"))            //IMPORT order items from CSV or NDJSON
+	orderItemRoutes.GET("/:order_item_id", GetAnOrderItem)                                        //GET an order item by ID
+	orderItemRoutes.PUT("/:order_item_id", RoleRequiredMiddleware(UpdateAnOrderItem, "admin"))    //UPDATE an order item
+	orderItemRoutes.DELETE("/:order_item_id", RoleRequiredMiddleware(DeleteAnOrderItem, "admin")) //DELETE an order item
+
+	// Order Routes, the signed in user's own order histories
+	orderRoutes := api.Group("/orders")
+	orderRoutes.Use(AuthenticationMiddleware, idempotent)
+	orderRoutes.GET("", GetAnUsersOrderHistories)                 //GET the user's order histories
+	orderRoutes.POST("", CreateAnOrder)                           //CREATE an order, the user buys an order item
+	orderRoutes.DELETE("/:order_history_id", UserRemoveOrderItem) //DELETE an order, the user removes an order item
+
+	// Order History Routes
+	orderHistoriesRoutes := api.Group("/order-histories")
+	orderHistoriesRoutes.Use(AuthenticationMiddleware, idempotent)
+	orderHistoriesRoutes.GET("", RoleRequiredMiddleware(GetOrderHistories, "admin"))                 //GET order histories list
+	orderHistoriesRoutes.GET("/archive", RoleRequiredMiddleware(GetArchivedOrderHistories, "admin")) //GET archived order histories
+	orderHistoriesRoutes.POST("/archive", RoleRequiredMiddleware(ArchiveOrderHistories, "admin"))    //ARCHIVE old order histories partitions
+
+	// Erasure Request Routes
+	erasureRoutes := api.Group("/erasure-requests")
+	erasureRoutes.Use(AuthenticationMiddleware, idempotent)
+	erasureRoutes.GET("", RoleRequiredMiddleware(GetErasureRequests, "admin"))                              //GET erasure requests
+	erasureRoutes.POST("/:erasure_request_id/approve", RoleRequiredMiddleware(ApproveUserErasure, "admin")) //APPROVE and run an erasure request
+	erasureRoutes.POST("/:erasure_request_id/reject", RoleRequiredMiddleware(RejectUserErasure, "admin"))   //REJECT an erasure request
+
+	// Audit Log Routes
+	auditLogRoutes := api.Group("/audit-log")
+	auditLogRoutes.Use(AuthenticationMiddleware)
+	auditLogRoutes.GET("", RoleRequiredMiddleware(GetAuditLogs, "admin")) //GET audit log entries
+
+	// Cache Routes
+	cacheRoutes := api.Group("/cache")
+	cacheRoutes.Use(AuthenticationMiddleware)
+	cacheRoutes.GET("/stats", RoleRequiredMiddleware(GetCacheStats, "admin")) //GET cache hit and miss counters
+
+	// Export Routes
+	exportRoutes := api.Group("/exports")
+	exportRoutes.Use(AuthenticationMiddleware, idempotent)
+	exportRoutes.GET("/:entity", RoleRequiredMiddleware(ExportTable, "admin"))                          //EXPORT users, order_items or order_histories
+	exportRoutes.POST("/:entity/jobs", RoleRequiredMiddleware(StartExportJob(rdb), "admin"))            //START a background export
+	exportRoutes.GET("/jobs/:job_id", RoleRequiredMiddleware(GetExportJob(rdb), "admin"))               //GET a background export status
+	exportRoutes.GET("/jobs/:job_id/download", RoleRequiredMiddleware(DownloadExportJob(rdb), "admin")) //DOWNLOAD a finished background export
+
+	// GraphQL Route, the roles are checked by the resolvers
+	api.POST("/graphql", GraphQLHandler(), AuthenticationMiddleware, idempotent) //QUERY users, order items and order histories with GraphQL
+
+	legacyRoutes(e, rdb)
+}
+
+// legacyRoutes are the paths from before /api/v1, kept until the
+// LEGACY_ROUTES_SUNSET date. They answer like their successors and say so in
+// the Deprecation, Sunset and Link headers.
+func legacyRoutes(e *echo.Echo, rdb *config.Database) {
+	idempotent := IdempotencyMiddleware(rdb)
+
+	authRoutes := e.Group("/auth")
+	legacy(authRoutes, http.MethodPost, "/si", SigninHandler, "/api/v1/auth/signin") //SIGNIN user
+	legacy(authRoutes, http.MethodPost, "/so", UserSignout, "/api/v1/auth/signout")  //SIGNOUT user
+
+	userRoutes := e.Group("/users")
+	userRoutes.Use(AuthenticationMiddleware, idempotent)
+	legacy(userRoutes, http.MethodGet, "/gl", RoleRequiredMiddleware(GetUsers, "admin"), "/api/v1/users")                                                  //GET user list
+	legacy(userRoutes, http.MethodGet, "/g/:user_id", GetAUser, "/api/v1/users/:user_id")                                                                  //GET a user by ID
+	legacy(userRoutes, http.MethodPost, "/c", RoleRequiredMiddleware(CreateAUser, "admin"), "/api/v1/users")                                               //CREATE a new user
+	legacy(userRoutes, http.MethodPut, "/u/:user_id", UpdateAUser, "/api/v1/users/:user_id")                                                               //UPDATE a user
+	legacy(userRoutes, http.MethodDelete, "/d/:user_id", RoleRequiredMiddleware(DeleteAUser, "admin"), "/api/v1/users/:user_id")                           //DELETE a user
+	legacy(userRoutes, http.MethodGet, "/goi/:order_item_id", UserGetOrderItem, "/api/v1/orders")                                                          //GET a user gets an order item
+	legacy(userRoutes, http.MethodDelete, "/roi/:order_history_id", UserRemoveOrderItem, "/api/v1/orders/:order_history_id")                               //GET a user removes an order item
+	legacy(userRoutes, http.MethodGet, "/export/:user_id", RoleRequiredMiddleware(ExportUserData, "admin"), "/api/v1/users/:user_id/data")                 //GET all personal data of a user
+	legacy(userRoutes, http.MethodPost, "/erase/:user_id", RoleRequiredMiddleware(RequestUserErasure, "admin"), "/api/v1/users/:user_id/erasure-requests") //REQUEST erasure of a user's personal data
+
 	orderItemRoutes := e.Group("/order_item")
-	orderItemRoutes.Use(AuthenticationMiddleware)
-	orderItemRoutes.GET("/gl", GetOrderItemList(rdb))                                               //GET order item list
-	orderItemRoutes.GET("/g/:order_item_id", GetAnOrderItem)                                        //GET an order item by ID
-	orderItemRoutes.POST("/c", RoleRequiredMiddleware(CreateAnOrderItem, "admin"))                  //CREATE a new order item
-	orderItemRoutes.PUT("/u/:order_item_id", RoleRequiredMiddleware(UpdateAnOrderItem, "admin"))    //UPDATE an order item
-	orderItemRoutes.DELETE("/d/:order_item_id", RoleRequiredMiddleware(DeleteAnOrderItem, "admin")) //DELETE an order item
+	orderItemRoutes.Use(AuthenticationMiddleware, idempotent)
+	legacy(orderItemRoutes, http.MethodGet, "/gl", GetOrderItemList, "/api/v1/order-items")                                                                   //GET order item list
+	legacy(orderItemRoutes, http.MethodGet, "/g/:order_item_id", GetAnOrderItem, "/api/v1/order-items/:order_item_id")                                        //GET an order item by ID
+	legacy(orderItemRoutes, http.MethodPost, "/c", RoleRequiredMiddleware(CreateAnOrderItem, "admin"), "/api/v1/order-items")                                 //CREATE a new order item
+	legacy(orderItemRoutes, http.MethodPut, "/u/:order_item_id", RoleRequiredMiddleware(UpdateAnOrderItem, "admin"), "/api/v1/order-items/:order_item_id")    //UPDATE an order item
+	legacy(orderItemRoutes, http.MethodDelete, "/d/:order_item_id", RoleRequiredMiddleware(DeleteAnOrderItem, "admin"), "/api/v1/order-items/:order_item_id") //DELETE an order item
+	legacy(orderItemRoutes, http.MethodPost, "/import", RoleRequiredMiddleware(ImportOrderItems, "admin"), "/api/v1/order-items/import")                      //IMPORT order items from CSV or NDJSON
 
-	// Order Item Routes
 	orderHistoriesRoutes := e.Group("/order_histories")
-	orderHistoriesRoutes.Use(AuthenticationMiddleware)
-	orderHistoriesRoutes.GET("/g", GetAnUsersOrderHistories(rdb))                            //GET an order histories by ID
-	orderHistoriesRoutes.GET("/gl", RoleRequiredMiddleware(GetOrderHistories(rdb), "admin")) //GET order histories list
+	orderHistoriesRoutes.Use(AuthenticationMiddleware, idempotent)
+	legacy(orderHistoriesRoutes, http.MethodGet, "/g", GetAnUsersOrderHistories, "/api/v1/orders")                                                          //GET an order histories by ID
+	legacy(orderHistoriesRoutes, http.MethodGet, "/gl", RoleRequiredMiddleware(GetOrderHistories, "admin"), "/api/v1/order-histories")                      //GET order histories list
+	legacy(orderHistoriesRoutes, http.MethodGet, "/archive", RoleRequiredMiddleware(GetArchivedOrderHistories, "admin"), "/api/v1/order-histories/archive") //GET archived order histories
+	legacy(orderHistoriesRoutes, http.MethodPost, "/archive", RoleRequiredMiddleware(ArchiveOrderHistories, "admin"), "/api/v1/order-histories/archive")    //ARCHIVE old order histories partitions
+
+	erasureRoutes := e.Group("/erasure_requests")
+	erasureRoutes.Use(AuthenticationMiddleware, idempotent)
+	legacy(erasureRoutes, http.MethodGet, "/gl", RoleRequiredMiddleware(GetErasureRequests, "admin"), "/api/v1/erasure-requests")                                                       //GET erasure requests
+	legacy(erasureRoutes, http.MethodPost, "/approve/:erasure_request_id", RoleRequiredMiddleware(ApproveUserErasure, "admin"), "/api/v1/erasure-requests/:erasure_request_id/approve") //APPROVE and run an erasure request
+	legacy(erasureRoutes, http.MethodPost, "/reject/:erasure_request_id", RoleRequiredMiddleware(RejectUserErasure, "admin"), "/api/v1/erasure-requests/:erasure_request_id/reject")    //REJECT an erasure request
+
+	auditLogRoutes := e.Group("/audit_log")
+	auditLogRoutes.Use(AuthenticationMiddleware)
+	legacy(auditLogRoutes, http.MethodGet, "/gl", RoleRequiredMiddleware(GetAuditLogs, "admin"), "/api/v1/audit-log") //GET audit log entries
+
+	cacheRoutes := e.Group("/cache")
+	cacheRoutes.Use(AuthenticationMiddleware)
+	legacy(cacheRoutes, http.MethodGet, "/stats", RoleRequiredMiddleware(GetCacheStats, "admin"), "/api/v1/cache/stats") //GET cache hit and miss counters
+
+	exportRoutes := e.Group("/exports")
+	exportRoutes.Use(AuthenticationMiddleware, idempotent)
+	legacy(exportRoutes, http.MethodGet, "/:entity", RoleRequiredMiddleware(ExportTable, "admin"), "/api/v1/exports/:entity")                                        //EXPORT users, order_items or order_histories
+	legacy(exportRoutes, http.MethodPost, "/:entity/jobs", RoleRequiredMiddleware(StartExportJob(rdb), "admin"), "/api/v1/exports/:entity/jobs")                     //START a background export
+	legacy(exportRoutes, http.MethodGet, "/jobs/:job_id", RoleRequiredMiddleware(GetExportJob(rdb), "admin"), "/api/v1/exports/jobs/:job_id")                        //GET a background export status
+	legacy(exportRoutes, http.MethodGet, "/jobs/:job_id/download", RoleRequiredMiddleware(DownloadExportJob(rdb), "admin"), "/api/v1/exports/jobs/:job_id/download") //DOWNLOAD a finished background export
+}
+
+// legacySuccessors maps the method and path of every legacy route to the path
+// replacing it.
+var legacySuccessors = map[string]string{}
+
+func legacy(g *echo.Group, method string, path string, h echo.HandlerFunc, successor string) {
+	route := g.Add(method, path, h, Deprecated(successor))
+	legacySuccessors[route.Method+" "+route.Path] = successor
 }
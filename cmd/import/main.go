@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joho/godotenv"
+	config "gitlab.com/nezaysr/go-saham.git/config"
+	data "gitlab.com/nezaysr/go-saham.git/data"
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+// Imports order items from a CSV or NDJSON file, e.g.
+//
+//	go run ./cmd/import -file items.csv -dry-run
+func main() {
+	file := flag.String("file", "", "path to the CSV or NDJSON file, - for stdin")
+	format := flag.String("format", "", "csv or ndjson (default: taken from the file extension)")
+	dryRun := flag.Bool("dry-run", false, "validate every row without writing anything")
+	upsert := flag.Bool("upsert", false, "update existing order items with the same name instead of rejecting them")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+		if *format == "jsonl" {
+			*format = data.ImportFormatNDJSON
+		}
+	}
+
+	input := os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatalf("Failed to open import file: %s", err.Error())
+		}
+		defer f.Close()
+		input = f
+	}
+
+	err := godotenv.Load()
+	if err != nil {
+		log.Fatal("Error loading .env file")
+	}
+
+	storage.NewDB()
+
+	// Writes invalidate the API's cached lists when Redis is reachable,
+	// otherwise the lists catch up once their cache entries expire.
+	if rdb, err := config.NewDatabase(os.Getenv("REDIS_PORT"), os.Getenv("REDIS_PASSWORD")); err != nil {
+		log.Printf("Failed to connect to redis, cached lists are not invalidated: %s", err.Error())
+	} else {
+		data.UseCache(rdb)
+	}
+
+	report, err := data.ImportOrderItems(data.SystemActor(), input, data.ImportOrderItemsOptions{
+		Format: *format,
+		DryRun: *dryRun,
+		Upsert: *upsert,
+	})
+	if err != nil {
+		log.Fatalf("Failed to import order items: %s", err.Error())
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"gitlab.com/nezaysr/go-saham.git/encryption"
+)
+
+// Creates or rotates the keyfile used for field encryption, e.g.
+//
+//	go run ./cmd/keygen -file project/dev-keys.json
+//	go run ./cmd/keygen -file project/dev-keys.json -rotate
+//
+// Rotating adds a new active master key and keeps the old ones, values are
+// moved to the new key as their rows get written. The blind index key is
+// never rotated since every stored index would have to be recomputed.
+func main() {
+	file := flag.String("file", "", "path of the keyfile")
+	rotate := flag.Bool("rotate", false, "add a new active master key to an existing keyfile")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var keyfile encryption.Keyfile
+
+	if *rotate {
+		raw, err := ioutil.ReadFile(*file)
+		if err != nil {
+			log.Fatalf("Failed to read keyfile: %s", err.Error())
+		}
+		if err := json.Unmarshal(raw, &keyfile); err != nil {
+			log.Fatalf("Failed to parse keyfile: %s", err.Error())
+		}
+	} else {
+		if _, err := os.Stat(*file); err == nil {
+			log.Fatalf("%s already exists, use -rotate to add a key to it", *file)
+		}
+
+		blindIndexKey, err := encryption.GenerateKey()
+		if err != nil {
+			log.Fatalf("Failed to generate key: %s", err.Error())
+		}
+		keyfile.BlindIndexKey = blindIndexKey
+		keyfile.Keys = map[string]string{}
+	}
+
+	key, err := encryption.GenerateKey()
+	if err != nil {
+		log.Fatalf("Failed to generate key: %s", err.Error())
+	}
+
+	keyID := time.Now().UTC().Format("20060102150405")
+	keyfile.Keys[keyID] = key
+	keyfile.Active = keyID
+
+	if _, err := encryption.NewKeyring(keyfile); err != nil {
+		log.Fatalf("Generated an invalid keyfile: %s", err.Error())
+	}
+
+	raw, err := json.MarshalIndent(keyfile, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode keyfile: %s", err.Error())
+	}
+
+	if err := ioutil.WriteFile(*file, append(raw, '\n'), 0600); err != nil {
+		log.Fatalf("Failed to write keyfile: %s", err.Error())
+	}
+
+	log.Printf("Active key is now %s", keyID)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"gitlab.com/nezaysr/go-saham.git/config"
+	data "gitlab.com/nezaysr/go-saham.git/data"
+	"gitlab.com/nezaysr/go-saham.git/encryption"
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+// Applies pending migrations, encrypts users written before encryption and
+// creates upcoming orders_histories partitions.
+// With -archive it also moves old partitions to the archive schema, e.g.
+//
+//	go run ./cmd/migrate -archive -archive-after 12
+func main() {
+	archive := flag.Bool("archive", false, "move old orders_histories partitions to the archive schema")
+	archiveAfter := flag.Int("archive-after", 0, "archive partitions older than this many months (default ORDER_HISTORY_ARCHIVE_AFTER_MONTHS)")
+	flag.Parse()
+
+	err := godotenv.Load()
+	if err != nil {
+		log.Fatal("Error loading .env file")
+	}
+
+	storage.NewDB()
+
+	if err := storage.Migrate(); err != nil {
+		log.Fatalf("Failed to migrate: %s", err.Error())
+	}
+
+	keyfile, err := config.GetEncryptionKeyfile()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if err := encryption.LoadKeyfile(keyfile); err != nil {
+		log.Fatalf("Failed to load encryption keyfile: %s", err.Error())
+	}
+
+	backfilled, err := data.BackfillEncryptedUsers()
+	if err != nil {
+		log.Fatalf("Failed to encrypt users: %s", err.Error())
+	}
+	if backfilled > 0 {
+		log.Printf("Encrypted %d users", backfilled)
+	}
+
+	if err := data.EnsureOrderHistoryPartitions(); err != nil {
+		log.Fatalf("Failed to create orders_histories partitions: %s", err.Error())
+	}
+
+	if !*archive {
+		return
+	}
+
+	if *archiveAfter == 0 {
+		*archiveAfter = config.GetOrderHistoryArchiveAfter()
+	}
+
+	if rdb, err := config.NewDatabase(os.Getenv("REDIS_PORT"), os.Getenv("REDIS_PASSWORD")); err != nil {
+		log.Printf("Failed to connect to redis, cached order histories are not invalidated: %s", err.Error())
+	} else {
+		data.UseCache(rdb)
+	}
+
+	archived, err := data.ArchiveOrderHistories(*archiveAfter)
+	if err != nil {
+		log.Fatalf("Failed to archive orders_histories: %s", err.Error())
+	}
+	log.Printf("Archived %d partitions", len(archived))
+}
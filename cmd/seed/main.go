@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	config "gitlab.com/nezaysr/go-saham.git/config"
+	data "gitlab.com/nezaysr/go-saham.git/data"
+	"gitlab.com/nezaysr/go-saham.git/encryption"
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+// Fills the database with generated order items, users and order histories, e.g.
+//
+//	go run ./cmd/seed -size demo -credentials demo-users.csv
+func main() {
+	size := flag.String("size", data.SeedSizeSmall, "small, demo or load")
+	seed := flag.Int64("seed", 1, "random seed, the same seed always generates the same rows")
+	anchor := flag.String("anchor", "2024-01-01", "date (YYYY-MM-DD) the generated timestamps are relative to")
+	cost := flag.Int("cost", 12, "bcrypt cost of the generated passwords")
+	credentials := flag.String("credentials", "", "write the generated usernames and passwords to this CSV file")
+	flag.Parse()
+
+	anchorDate, err := time.Parse("2006-01-02", *anchor)
+	if err != nil {
+		log.Fatalf("Invalid anchor date: %s", err.Error())
+	}
+
+	err = godotenv.Load()
+	if err != nil {
+		log.Fatal("Error loading .env file")
+	}
+
+	keyfile, err := config.GetEncryptionKeyfile()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if err := encryption.LoadKeyfile(keyfile); err != nil {
+		log.Fatalf("Failed to load encryption keys: %s", err.Error())
+	}
+
+	storage.NewDB()
+
+	if rdb, err := config.NewDatabase(os.Getenv("REDIS_PORT"), os.Getenv("REDIS_PASSWORD")); err != nil {
+		log.Printf("Failed to connect to redis, cached lists are not invalidated: %s", err.Error())
+	} else {
+		data.UseCache(rdb)
+	}
+
+	report, err := data.Seed(data.SystemActor(), data.SeedOptions{
+		Size:         *size,
+		Seed:         *seed,
+		Anchor:       anchorDate,
+		PasswordCost: *cost,
+	})
+	if err != nil {
+		log.Fatalf("Failed to seed: %s", err.Error())
+	}
+
+	if *credentials != "" {
+		if err := writeCredentials(*credentials, report.Credentials); err != nil {
+			log.Fatalf("Failed to write credentials: %s", err.Error())
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+}
+
+func writeCredentials(path string, credentials []data.SeedCredential) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"username", "password"})
+	for _, credential := range credentials {
+		w.Write([]string{credential.Username, credential.Password})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
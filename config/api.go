@@ -0,0 +1,27 @@
+package config
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// DefaultLegacyRoutesSunset is when the routes from before /api/v1 are removed.
+const DefaultLegacyRoutesSunset = "2027-06-30"
+
+// GetLegacyRoutesSunset returns the date sent in the Sunset header of the
+// legacy routes, read from LEGACY_ROUTES_SUNSET as YYYY-MM-DD.
+func GetLegacyRoutesSunset() time.Time {
+	raw := os.Getenv("LEGACY_ROUTES_SUNSET")
+	if raw == "" {
+		raw = DefaultLegacyRoutesSunset
+	}
+
+	sunset, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		log.Printf("Invalid LEGACY_ROUTES_SUNSET %q, using %s", raw, DefaultLegacyRoutesSunset)
+		sunset, _ = time.Parse("2006-01-02", DefaultLegacyRoutesSunset)
+	}
+
+	return sunset
+}
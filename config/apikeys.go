@@ -0,0 +1,45 @@
+package config
+
+import (
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+)
+
+// APIKey lets a service call the API as itself rather than as a signed in
+// user. Only the SHA-256 of the key is configured, Hash is its raw bytes.
+type APIKey struct {
+	Name string
+	Role string
+	Hash []byte
+}
+
+// GetAPIKeys returns the keys of API_KEYS, a comma separated list of
+// name:role:sha256, e.g. "risk:admin:9f86d0...". The hash is the hex SHA-256
+// of the key, so the key itself is never stored. Malformed entries are
+// logged and skipped.
+func GetAPIKeys() []APIKey {
+	keys := []APIKey{}
+	for i, entry := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			log.Printf("Invalid API_KEYS entry %d, want name:role:sha256", i+1)
+			continue
+		}
+
+		hash, err := hex.DecodeString(parts[2])
+		if err != nil || len(hash) != 32 {
+			log.Printf("Invalid API_KEYS entry %s, its hash isn't a hex SHA-256", parts[0])
+			continue
+		}
+
+		keys = append(keys, APIKey{Name: parts[0], Role: parts[1], Hash: hash})
+	}
+	return keys
+}
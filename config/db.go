@@ -4,16 +4,55 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 const (
-	DBType = "postgres"
+	DBTypePostgres = "postgres"
+	DBTypeSQLite   = "sqlite3"
+
+	DefaultSQLitePath = "go-saham.db"
+
+	DefaultReplicaMaxLag        = 10 * time.Second
+	DefaultReadAfterWriteWindow = 5 * time.Second
+
+	DefaultOrderHistoryPartitionsAhead = 3
+	DefaultOrderHistoryArchiveAfter    = 12
 )
 
+// GetDBType returns the database driver from DBType, "postgres" (the default)
+// or "sqlite3".
 func GetDBType() string {
-	return DBType
+	if dbType := os.Getenv("DBType"); dbType != "" {
+		return dbType
+	}
+	return DBTypePostgres
+}
+
+// GetDBConnString returns the connection string for the configured driver.
+func GetDBConnString() string {
+	if GetDBType() == DBTypeSQLite {
+		return GetSQLiteConnString()
+	}
+	return GetPostgresConnString()
+}
+
+// GetSQLiteConnString returns the SQLite DSN for DBPath, a file path or
+// ":memory:" for a database that only lives as long as the process.
+func GetSQLiteConnString() string {
+	path := os.Getenv("DBPath")
+	if path == "" {
+		path = DefaultSQLitePath
+	}
+
+	if path == ":memory:" {
+		return "file::memory:?_foreign_keys=1"
+	}
+	return "file:" + path + "?_foreign_keys=1&_busy_timeout=5000"
 }
 
 func GetPostgresConnString() string {
@@ -37,3 +76,70 @@ func GetPostgresConnString() string {
 	)
 	return dataBase
 }
+
+// GetPostgresReplicaConnStrings returns the read replica DSNs from DBReplicas,
+// a comma separated list. It is empty when no replicas are configured.
+func GetPostgresReplicaConnStrings() []string {
+	var dsns []string
+	for _, dsn := range strings.Split(os.Getenv("DBReplicas"), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			dsns = append(dsns, dsn)
+		}
+	}
+	return dsns
+}
+
+// GetReplicaMaxLag returns how far behind the primary a replica may be before
+// reads stop going to it, read from DBReplicaMaxLag.
+func GetReplicaMaxLag() time.Duration {
+	return getDurationEnv("DBReplicaMaxLag", DefaultReplicaMaxLag)
+}
+
+// GetReadAfterWriteWindow returns how long a user's reads stay on the primary
+// after they wrote something, read from DBReadAfterWriteWindow.
+func GetReadAfterWriteWindow() time.Duration {
+	return getDurationEnv("DBReadAfterWriteWindow", DefaultReadAfterWriteWindow)
+}
+
+// GetOrderHistoryPartitionsAhead returns how many monthly orders_histories
+// partitions are created ahead of the current month, read from
+// ORDER_HISTORY_PARTITIONS_AHEAD.
+func GetOrderHistoryPartitionsAhead() int {
+	return getIntEnv("ORDER_HISTORY_PARTITIONS_AHEAD", DefaultOrderHistoryPartitionsAhead)
+}
+
+// GetOrderHistoryArchiveAfter returns after how many months orders_histories
+// partitions are archived, read from ORDER_HISTORY_ARCHIVE_AFTER_MONTHS.
+func GetOrderHistoryArchiveAfter() int {
+	return getIntEnv("ORDER_HISTORY_ARCHIVE_AFTER_MONTHS", DefaultOrderHistoryArchiveAfter)
+}
+
+func getIntEnv(key string, fallback int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("Invalid %s %q, using %d", key, raw, fallback)
+		return fallback
+	}
+
+	return n
+}
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		log.Printf("Invalid %s %q, using %s", key, raw, fallback)
+		return fallback
+	}
+
+	return d
+}
@@ -0,0 +1,19 @@
+package config
+
+import (
+	"errors"
+	"os"
+)
+
+var ErrNoEncryptionKeyfile = errors.New("ENCRYPTION_KEYFILE is not set, create a keyfile with cmd/keygen and mount it at deploy time")
+
+// GetEncryptionKeyfile returns the path of the keyfile holding the master and
+// blind index keys, read from ENCRYPTION_KEYFILE. There is no default, the
+// keys never live in the repository or the image.
+func GetEncryptionKeyfile() (string, error) {
+	path := os.Getenv("ENCRYPTION_KEYFILE")
+	if path == "" {
+		return "", ErrNoEncryptionKeyfile
+	}
+	return path, nil
+}
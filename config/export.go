@@ -0,0 +1,16 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// GetExportDir returns where background export jobs write their files, read
+// from EXPORT_DIR and defaulting to a directory under the system temp dir.
+func GetExportDir() string {
+	if dir := os.Getenv("EXPORT_DIR"); dir != "" {
+		return dir
+	}
+
+	return filepath.Join(os.TempDir(), "go-saham-exports")
+}
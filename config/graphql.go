@@ -0,0 +1,19 @@
+package config
+
+const (
+	DefaultGraphQLMaxDepth      = 8
+	DefaultGraphQLMaxComplexity = 1000
+)
+
+// GetGraphQLMaxDepth returns how deeply a GraphQL query may nest fields, read
+// from GRAPHQL_MAX_DEPTH.
+func GetGraphQLMaxDepth() int {
+	return getIntEnv("GRAPHQL_MAX_DEPTH", DefaultGraphQLMaxDepth)
+}
+
+// GetGraphQLMaxComplexity returns the highest cost of a GraphQL query, read
+// from GRAPHQL_MAX_COMPLEXITY. Every field costs 1 and the fields under a
+// list cost once per row of a page.
+func GetGraphQLMaxComplexity() int {
+	return getIntEnv("GRAPHQL_MAX_COMPLEXITY", DefaultGraphQLMaxComplexity)
+}
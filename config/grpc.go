@@ -0,0 +1,24 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+// GetGRPCPort returns the port the gRPC server listens on, read from
+// GRPC_PORT. 0, when it isn't set, leaves the gRPC server off.
+func GetGRPCPort() int {
+	raw := os.Getenv("GRPC_PORT")
+	if raw == "" {
+		return 0
+	}
+
+	port, err := strconv.Atoi(raw)
+	if err != nil || port < 0 {
+		log.Printf("Invalid GRPC_PORT %q, the gRPC server stays off", raw)
+		return 0
+	}
+
+	return port
+}
@@ -3,12 +3,15 @@ package config
 import (
 	"context"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 type Database struct {
-	Client *redis.Client
+	Client  *redis.Client
+	breaker *circuitBreaker
 }
 
 var (
@@ -16,18 +19,101 @@ var (
 	Ctx    = context.TODO()
 )
 
+const (
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// DefaultIdempotencyLockTTL is well over the time the slowest request, a
+	// 32 MiB import, takes.
+	DefaultIdempotencyLockTTL = 2 * time.Minute
+	DefaultCacheTTL           = 1 * time.Minute
+	DefaultLocalCacheTTL      = 5 * time.Second
+	DefaultLocalCacheSize     = 1000
+	DefaultNegativeCacheTTL   = 10 * time.Second
+	DefaultRedisRetryAfter    = 5 * time.Second
+	redisFailuresBeforeOpen   = 5
+)
+
+// NewDatabase connects to Redis. The Database is returned even when Redis
+// can't be reached, together with the error: commands then fail fast until
+// Redis answers again, see Healthy.
 func NewDatabase(address string, password string) (*Database, error) {
 	client := redis.NewClient(&redis.Options{
-		Addr:     address,
-		Password: password,
-		DB:       0,
+		Addr:        address,
+		Password:    password,
+		DB:          0,
+		DialTimeout: 2 * time.Second,
 	})
 
+	breaker := newCircuitBreaker(redisFailuresBeforeOpen, getDurationEnv("REDIS_RETRY_AFTER", DefaultRedisRetryAfter))
+	client.AddHook(breaker)
+
+	database := &Database{
+		Client:  client,
+		breaker: breaker,
+	}
+
 	if err := client.Ping(Ctx).Err(); err != nil {
-		return nil, err
+		breaker.trip()
+		return database, err
+	}
+
+	return database, nil
+}
+
+// Healthy reports whether commands are sent to Redis, it is false while
+// Redis is being bypassed after failing.
+func (d *Database) Healthy() bool {
+	return d.breaker.closed()
+}
+
+// GetIdempotencyTTL returns how long responses stored for an Idempotency-Key
+// are kept, read from IDEMPOTENCY_TTL (e.g. "24h", "30m").
+func GetIdempotencyTTL() time.Duration {
+	ttl := getDurationEnv("IDEMPOTENCY_TTL", DefaultIdempotencyTTL)
+	if ttl == 0 {
+		return DefaultIdempotencyTTL
 	}
+	return ttl
+}
 
-	return &Database{
-		Client: client,
-	}, nil
+// GetIdempotencyLockTTL returns how long an Idempotency-Key stays locked while
+// its first request runs, read from IDEMPOTENCY_LOCK_TTL. A request that
+// crashes leaves the key locked that long at most.
+func GetIdempotencyLockTTL() time.Duration {
+	ttl := getDurationEnv("IDEMPOTENCY_LOCK_TTL", DefaultIdempotencyLockTTL)
+	if ttl == 0 {
+		return DefaultIdempotencyLockTTL
+	}
+	return ttl
+}
+
+// GetCacheTTL returns how long cached reads of namespace are kept, read from
+// CACHE_TTL_<NAMESPACE> (e.g. CACHE_TTL_ORDER_ITEMS=30s).
+func GetCacheTTL(namespace string) time.Duration {
+	ttl := getDurationEnv("CACHE_TTL_"+strings.ToUpper(namespace), DefaultCacheTTL)
+	if ttl == 0 {
+		return DefaultCacheTTL
+	}
+	return ttl
+}
+
+// GetLocalCacheTTL returns how long reads are kept in the in-process cache in
+// front of Redis, read from LOCAL_CACHE_TTL.
+func GetLocalCacheTTL() time.Duration {
+	return getDurationEnv("LOCAL_CACHE_TTL", DefaultLocalCacheTTL)
+}
+
+// GetLocalCacheSize returns how many entries the in-process cache holds, read
+// from LOCAL_CACHE_SIZE.
+func GetLocalCacheSize() int {
+	return getIntEnv("LOCAL_CACHE_SIZE", DefaultLocalCacheSize)
+}
+
+// GetNegativeCacheTTL returns how long an id that wasn't found stays cached as
+// missing, read from NEGATIVE_CACHE_TTL.
+func GetNegativeCacheTTL() time.Duration {
+	ttl := getDurationEnv("NEGATIVE_CACHE_TTL", DefaultNegativeCacheTTL)
+	if ttl == 0 {
+		return DefaultNegativeCacheTTL
+	}
+	return ttl
 }
@@ -0,0 +1,171 @@
+package data
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"gitlab.com/nezaysr/go-saham.git/config"
+	"gitlab.com/nezaysr/go-saham.git/model"
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+const (
+	orderHistoryPartitionPrefix = "orders_histories_"
+	orderHistoryPartitionLayout = "2006_01"
+)
+
+var ErrArchiveNotSupported = model.ErrArchiveNotSupported
+
+// EnsureOrderHistoryPartitions creates the monthly orders_histories partitions
+// from the current month up to the configured number of months ahead.
+func EnsureOrderHistoryPartitions() error {
+	if config.GetDBType() != config.DBTypePostgres {
+		return nil
+	}
+
+	return storage.GetDBInstance().
+		Exec("SELECT ensure_orders_histories_partitions(?)", config.GetOrderHistoryPartitionsAhead()).Error
+}
+
+// MaintainOrderHistoryPartitions keeps future partitions in place for as long
+// as the process runs, so inserts never fall through to the default partition.
+func MaintainOrderHistoryPartitions() {
+	if config.GetDBType() != config.DBTypePostgres {
+		return
+	}
+
+	for {
+		if err := EnsureOrderHistoryPartitions(); err != nil {
+			log.Printf("Failed to create orders_histories partitions: %v", err)
+		}
+		time.Sleep(24 * time.Hour)
+	}
+}
+
+// ArchiveOrderHistories moves every monthly orders_histories partition that
+// ended more than olderThanMonths months ago into the archive schema, where it
+// is attached to archive.orders_histories. It returns the archived partitions.
+func ArchiveOrderHistories(olderThanMonths int) ([]string, error) {
+	if config.GetDBType() != config.DBTypePostgres {
+		return nil, ErrArchiveNotSupported
+	}
+
+	if olderThanMonths < 1 {
+		return nil, Validation("invalid_older_than_months", fmt.Sprintf("older than months must be at least 1, got %d", olderThanMonths))
+	}
+
+	now := time.Now()
+	cutoff := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -olderThanMonths, 0)
+
+	db := storage.GetDBInstance()
+	rows, err := db.Raw(`SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		JOIN pg_namespace n ON n.oid = p.relnamespace
+		WHERE n.nspname = 'public' AND p.relname = 'orders_histories'
+		ORDER BY c.relname`).Rows()
+	if err != nil {
+		return nil, err
+	}
+
+	var partitions []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		partitions = append(partitions, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	archived := []string{}
+	defer func() {
+		if len(archived) > 0 {
+			invalidateCache(cacheNamespaceOrderHistories)
+		}
+	}()
+
+	for _, name := range partitions {
+		month, err := time.Parse(orderHistoryPartitionLayout, strings.TrimPrefix(name, orderHistoryPartitionPrefix))
+		if err != nil || !strings.HasPrefix(name, orderHistoryPartitionPrefix) {
+			continue // the default partition
+		}
+		if !month.Before(cutoff) {
+			continue
+		}
+
+		if err := archiveOrderHistoryPartition(db, name, month); err != nil {
+			return archived, fmt.Errorf("archiving %s: %v", name, err)
+		}
+		log.Printf("Archived partition %s", name)
+		archived = append(archived, name)
+	}
+
+	return archived, nil
+}
+
+func archiveOrderHistoryPartition(db *gorm.DB, name string, month time.Time) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	// Moving partitions doesn't fire the cache invalidation triggers.
+	statements := []string{
+		fmt.Sprintf(`SELECT pg_notify('%s', 'orders_histories')`, cacheInvalidationChannel),
+		fmt.Sprintf(`ALTER TABLE public.orders_histories DETACH PARTITION public.%q`, name),
+		fmt.Sprintf(`ALTER TABLE public.%q SET SCHEMA archive`, name),
+		fmt.Sprintf(`ALTER TABLE archive.orders_histories ATTACH PARTITION archive.%q FOR VALUES FROM ('%s') TO ('%s')`,
+			name, month.Format("2006-01-02"), month.AddDate(0, 1, 0).Format("2006-01-02")),
+	}
+
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// GetArchivedOrderHistories reads from the archived partitions, pass From and
+// To so only the matching months are scanned.
+func GetArchivedOrderHistories(actor Actor, filter ArchivedOrderHistoryFilter, page int, limit int) ([]OrdersHistories, error) {
+	if err := Validate(filter); err != nil {
+		return nil, err
+	}
+
+	if config.GetDBType() != config.DBTypePostgres {
+		return nil, ErrArchiveNotSupported
+	}
+
+	db := readDB(actor)
+	offset := (page - 1) * limit
+
+	query := db.Table("archive.orders_histories")
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	order_histories := []OrdersHistories{}
+	if err := query.Offset(offset).Limit(limit).Order("created_at DESC, id DESC").Find(&order_histories).Error; err != nil {
+		return nil, err
+	}
+
+	return order_histories, nil
+}
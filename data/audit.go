@@ -0,0 +1,182 @@
+package data
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"gitlab.com/nezaysr/go-saham.git/encryption"
+)
+
+const (
+	AuditEntityUser         = "users"
+	AuditEntityOrderItem    = "orders_items"
+	AuditEntityOrderHistory = "orders_histories"
+
+	AuditEntityErasureRequest = "erasure_requests"
+)
+
+// Fields whose values must never be copied into the audit log, on top of
+// the encrypted ones. A change to them is still recorded, just without the
+// values.
+var auditRedactedFields = map[string]bool{
+	"password": true,
+}
+
+const auditRedacted = "[redacted]"
+
+type auditFieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// SystemActor is used for changes that aren't made through an API request,
+// like the import command.
+func SystemActor() Actor {
+	return Actor{Type: ActorSystem}
+}
+
+// recordAudit stores an audit entry for one entity. before is nil for a
+// create and after is nil for a delete.
+func recordAudit(tx *gorm.DB, actor Actor, action AuditAction, entityType string, entityID int, before interface{}, after interface{}) error {
+	changes, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+
+	entry := &AuditLog{
+		ActorID:    actor.ID,
+		ActorType:  actor.Type,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Changes:    changes,
+		RequestID:  actor.RequestID,
+		IP:         actor.IP,
+		CreatedAt:  time.Now(),
+	}
+
+	return tx.Create(entry).Error
+}
+
+// auditDiff returns the fields that differ between before and after as
+// {"field": {"before": ..., "after": ...}}.
+func auditDiff(before interface{}, after interface{}) (JSONText, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := map[string]auditFieldChange{}
+	for field, value := range beforeFields {
+		if !reflect.DeepEqual(value, afterFields[field]) {
+			diff[field] = auditFieldChange{Before: value, After: afterFields[field]}
+		}
+	}
+	for field, value := range afterFields {
+		if _, ok := beforeFields[field]; !ok && value != nil {
+			diff[field] = auditFieldChange{Before: nil, After: value}
+		}
+	}
+
+	redacted := map[string]bool{}
+	for field := range auditRedactedFields {
+		redacted[field] = true
+	}
+	for _, entity := range []interface{}{before, after} {
+		if entity == nil {
+			continue
+		}
+		for _, field := range encryption.TaggedFields(entity) {
+			redacted[field.JSONName] = true
+		}
+	}
+
+	for field, change := range diff {
+		if redacted[field] {
+			if change.Before != nil {
+				change.Before = auditRedacted
+			}
+			if change.After != nil {
+				change.After = auditRedacted
+			}
+			diff[field] = change
+		}
+	}
+
+	return json.Marshal(diff)
+}
+
+func auditFields(entity interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if entity == nil || reflect.ValueOf(entity).IsNil() {
+		return fields, nil
+	}
+
+	raw, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+func GetAuditLogs(actor Actor, filter AuditLogFilter, page int, limit int) ([]AuditLog, error) {
+	if err := Validate(filter); err != nil {
+		return nil, err
+	}
+
+	offset := (page - 1) * limit
+
+	audit_logs := []AuditLog{}
+	if err := auditLogQuery(readDB(actor), filter).Offset(offset).Limit(limit).Order("id DESC").Find(&audit_logs).Error; err != nil {
+		return nil, err
+	}
+
+	return audit_logs, nil
+}
+
+// CountAuditLogs is the number of entries GetAuditLogs pages through.
+func CountAuditLogs(actor Actor, filter AuditLogFilter) (int, error) {
+	if err := Validate(filter); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	if err := auditLogQuery(readDB(actor), filter).Count(&total).Error; err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func auditLogQuery(db *gorm.DB, filter AuditLogFilter) *gorm.DB {
+	query := db.Model(&AuditLog{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != nil {
+		query = query.Where("entity_id = ?", *filter.EntityID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	return query
+}
@@ -0,0 +1,57 @@
+package data
+
+// Batched lookups for callers resolving the relations of many rows at once,
+// one query per relation instead of one per row. Missing ids are left out.
+
+// GetUsersByIDs returns the users with the given ids, without their password.
+func GetUsersByIDs(actor Actor, ids []int) ([]Users, error) {
+	users := []Users{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	db := readDB(actor)
+	if err := db.Select("id, username, fullname,first_order_id,role,created_at, updated_at, deleted_at").Where("id IN (?)", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func GetOrderItemsByIDs(actor Actor, ids []int) ([]OrdersItem, error) {
+	order_items := []OrdersItem{}
+	if len(ids) == 0 {
+		return order_items, nil
+	}
+
+	db := readDB(actor)
+	if err := db.Where("id IN (?)", ids).Find(&order_items).Error; err != nil {
+		return nil, err
+	}
+
+	return order_items, nil
+}
+
+// GetOrderHistoriesByUserIDs returns the page of every user's order histories,
+// newest first, as GetOrderHistoriesByUserID would for each of them.
+func GetOrderHistoriesByUserIDs(actor Actor, userIDs []int, page int, limit int) ([]OrdersHistories, error) {
+	order_histories := []OrdersHistories{}
+	if len(userIDs) == 0 {
+		return order_histories, nil
+	}
+
+	offset := (page - 1) * limit
+	db := readDB(actor)
+	err := db.Raw(`SELECT id, user_id, order_item_id, descriptions, created_at, updated_at, deleted_at FROM (
+			SELECT orders_histories.*, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY id DESC) AS position
+			FROM orders_histories
+			WHERE user_id IN (?) AND deleted_at IS NULL
+		) ranked
+		WHERE position > ? AND position <= ?
+		ORDER BY user_id, id DESC`, userIDs, offset, offset+limit).Scan(&order_histories).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return order_histories, nil
+}
@@ -0,0 +1,398 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/redis/go-redis/v9"
+	"gitlab.com/nezaysr/go-saham.git/config"
+	"golang.org/x/sync/singleflight"
+)
+
+// Cached reads are grouped in namespaces. Every cache key embeds the current
+// version of its namespace, so bumping the version after a write makes all
+// the older keys unreachable at once and they expire on their own.
+const (
+	cacheNamespaceUsers          = "users"
+	cacheNamespaceOrderItems     = "order_items"
+	cacheNamespaceOrderHistories = "order_histories"
+)
+
+var (
+	cache      *config.Database
+	cacheLoads singleflight.Group
+
+	local          *lruCache
+	localCacheOnce sync.Once
+
+	// localVersions are the namespace versions of the in-process cache,
+	// they are bumped together with the ones in Redis.
+	localVersionsMu sync.Mutex
+	localVersions   = map[string]int64{}
+)
+
+// UseCache sets the Redis database every cached read goes through and the
+// data functions that write invalidate. Without it reads are only cached in
+// process.
+func UseCache(rdb *config.Database) {
+	cache = rdb
+}
+
+// cacheQuery is a cached read. Params has to hold every input that changes
+// the result, like filters and pagination, as plain values rather than
+// pointers. The role of the actor is always added.
+type cacheQuery struct {
+	Namespace string
+	Name      string
+	Params    map[string]interface{}
+}
+
+func (q cacheQuery) key(actor Actor, version int64) string {
+	params := map[string]interface{}{"role": actor.Role}
+	for name, value := range q.Params {
+		params[name] = value
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	fmt.Fprintf(&key, "%s:v%d:%s", q.Namespace, version, q.Name)
+	for _, name := range names {
+		fmt.Fprintf(&key, ":%s=%v", name, params[name])
+	}
+	return key.String()
+}
+
+// cacheAside fills dest, a pointer, with the cached result of q, looking in
+// the in-process cache first and in Redis next. On a miss it calls load and
+// caches what it returns, concurrent misses of the same key share one call to
+// load. Entries that can't be decoded count as misses. Encrypted fields are
+// cached encrypted and only decrypted into dest.
+//
+// Writes of other processes reach the in-process cache through
+// ListenForCacheInvalidation, without it those entries stay until
+// LOCAL_CACHE_TTL runs out.
+func cacheAside(actor Actor, q cacheQuery, dest interface{}, load func() (interface{}, error)) error {
+	local := localCache()
+	localKey := q.key(actor, localCacheVersion(q.Namespace))
+	if cached, ok := local.Get(localKey); ok {
+		countCacheRead(q.Namespace, cacheLocalHit)
+		return decodeCached(cached, dest)
+	}
+
+	key := ""
+	if version, err := cacheVersion(q.Namespace); err != nil {
+		logCacheError("Failed to get %s cache version: %v", q.Namespace, err)
+	} else if cache != nil {
+		key = q.key(actor, version)
+
+		cached, err := cache.Client.Get(context.Background(), key).Bytes()
+		if err == nil {
+			decodeErr := decodeCached(cached, dest)
+			if decodeErr == nil {
+				countCacheRead(q.Namespace, cacheRedisHit)
+				local.Set(localKey, cached)
+				return nil
+			}
+			log.Printf("Failed to unmarshal cached %s, loading it again: %v", key, decodeErr)
+		} else if err != redis.Nil {
+			logCacheError("Failed to get cached %s: %v", key, err)
+		}
+	}
+
+	countCacheRead(q.Namespace, cacheMiss)
+	encoded, err, _ := cacheLoads.Do(localKey, func() (interface{}, error) {
+		result, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		if result, err = sealCachedRows(result); err != nil {
+			return nil, err
+		}
+
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+
+		if key != "" {
+			if err := cache.Client.Set(context.Background(), key, encoded, cacheTTL(q.Namespace)).Err(); err != nil {
+				logCacheError("Failed to store %s in cache: %v", key, err)
+			}
+		}
+		local.Set(localKey, encoded)
+		return encoded, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return decodeCached(encoded.([]byte), dest)
+}
+
+// decodeCached decodes a cached value into dest and decrypts the fields
+// sealCachedRows encrypted before caching it.
+func decodeCached(cached []byte, dest interface{}) error {
+	if err := json.Unmarshal(cached, dest); err != nil {
+		return err
+	}
+	return openCachedRows(dest)
+}
+
+// entityCacheKey is the key of the row of namespace with id. Like list keys it
+// embeds a version, the one of the row, see entityVersion.
+func entityCacheKey(namespace string, id int, version int64) string {
+	return fmt.Sprintf("%s:entity:%d:v%d", namespace, id, version)
+}
+
+// entityVersion names the version of a single row, its key is built by
+// cacheVersionKey like the one of a namespace.
+func entityVersion(namespace string, id int) string {
+	return namespace + ":" + strconv.Itoa(id)
+}
+
+// cacheEntity is cacheAside for a single row looked up by id. Rows that
+// don't exist are cached too, for NEGATIVE_CACHE_TTL, and come back as
+// gorm.ErrRecordNotFound. Every row has its own version, read before the row
+// is loaded, so a load racing a write stores the old row under a key that
+// evictCachedEntity already made unreachable. Like in cacheAside encrypted
+// fields stay encrypted.
+func cacheEntity(namespace string, id int, dest interface{}, load func() (interface{}, error)) error {
+	local := localCache()
+	localKey := entityCacheKey(namespace, id, localCacheVersion(namespace))
+	if cached, ok := local.Get(localKey); ok {
+		countCacheRead(namespace, cacheLocalHit)
+		return decodeCachedEntity(cached, dest)
+	}
+
+	key := ""
+	if version, err := cacheVersion(entityVersion(namespace, id)); err != nil {
+		logCacheError("Failed to get %s cache version: %v", namespace, err)
+	} else if cache != nil {
+		key = entityCacheKey(namespace, id, version)
+
+		cached, err := cache.Client.Get(context.Background(), key).Bytes()
+		if err == nil {
+			decodeErr := decodeCachedEntity(cached, dest)
+			if decodeErr == nil || decodeErr == gorm.ErrRecordNotFound {
+				countCacheRead(namespace, cacheRedisHit)
+				local.Set(localKey, cached)
+				return decodeErr
+			}
+			log.Printf("Failed to unmarshal cached %s, loading it again: %v", key, decodeErr)
+		} else if err != redis.Nil {
+			logCacheError("Failed to get cached %s: %v", key, err)
+		}
+	}
+
+	countCacheRead(namespace, cacheMiss)
+	encoded, err, _ := cacheLoads.Do(localKey, func() (interface{}, error) {
+		ttl := cacheTTL(namespace)
+
+		var encoded []byte
+		result, err := load()
+		if gorm.IsRecordNotFoundError(err) {
+			encoded, ttl = []byte(cacheNotFound), config.GetNegativeCacheTTL()
+		} else if err != nil {
+			return nil, err
+		} else if result, err = sealCachedRows(result); err != nil {
+			return nil, err
+		} else if encoded, err = json.Marshal(result); err != nil {
+			return nil, err
+		}
+
+		if key != "" {
+			if err := cache.Client.Set(context.Background(), key, encoded, ttl).Err(); err != nil {
+				logCacheError("Failed to store %s in cache: %v", key, err)
+			}
+		}
+		local.Set(localKey, encoded)
+		return encoded, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return decodeCachedEntity(encoded.([]byte), dest)
+}
+
+// cacheNotFound is what is cached for a row that doesn't exist, it can't be
+// mistaken for JSON.
+const cacheNotFound = "!not_found"
+
+func decodeCachedEntity(cached []byte, dest interface{}) error {
+	if string(cached) == cacheNotFound {
+		return gorm.ErrRecordNotFound
+	}
+	return decodeCached(cached, dest)
+}
+
+// evictCachedEntity bumps the versions of the rows of namespace with ids,
+// in Redis in a single MULTI, call it once the write is committed. Creates
+// have to call it as well, the new id may be cached as missing.
+func evictCachedEntity(namespace string, ids ...int) {
+	if len(ids) == 0 {
+		return
+	}
+
+	evictLocalCache(namespace)
+
+	if cache == nil {
+		return
+	}
+
+	// The versions outlive every row cached under them, so a version that
+	// expired and starts over at 0 can't hit an old row.
+	ttl := 2 * config.GetCacheTTL(namespace)
+	if negativeTTL := 2 * config.GetNegativeCacheTTL(); negativeTTL > ttl {
+		ttl = negativeTTL
+	}
+
+	_, err := cache.Client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Incr(context.Background(), cacheVersionKey(entityVersion(namespace, id)))
+			pipe.Expire(context.Background(), cacheVersionKey(entityVersion(namespace, id)), ttl)
+		}
+		return nil
+	})
+	if err != nil && err != config.ErrRedisUnavailable {
+		log.Printf("Failed to evict cached %s %v: %v", namespace, ids, err)
+	}
+}
+
+type cacheRead int
+
+const (
+	cacheLocalHit cacheRead = iota
+	cacheRedisHit
+	cacheMiss
+)
+
+var (
+	cacheStatsMu sync.Mutex
+	cacheStats   = map[string]*CacheStats{}
+)
+
+func countCacheRead(namespace string, read cacheRead) {
+	cacheStatsMu.Lock()
+	defer cacheStatsMu.Unlock()
+
+	stats, ok := cacheStats[namespace]
+	if !ok {
+		stats = &CacheStats{}
+		cacheStats[namespace] = stats
+	}
+
+	switch read {
+	case cacheLocalHit:
+		stats.LocalHits++
+	case cacheRedisHit:
+		stats.RedisHits++
+	case cacheMiss:
+		stats.Misses++
+	}
+}
+
+// GetCacheStats returns how cached reads of this process were served since it
+// started, per namespace.
+func GetCacheStats() map[string]CacheStats {
+	cacheStatsMu.Lock()
+	defer cacheStatsMu.Unlock()
+
+	stats := map[string]CacheStats{}
+	for namespace, namespaceStats := range cacheStats {
+		stats[namespace] = *namespaceStats
+	}
+	return stats
+}
+
+// logCacheError logs failed Redis calls, except the ones skipped while Redis
+// is bypassed so an outage isn't logged on every request.
+func logCacheError(format string, key string, err error) {
+	if err != config.ErrRedisUnavailable {
+		log.Printf(format, key, err)
+	}
+}
+
+func localCache() *lruCache {
+	localCacheOnce.Do(func() {
+		local = newLRUCache(config.GetLocalCacheSize(), config.GetLocalCacheTTL())
+	})
+	return local
+}
+
+func localCacheVersion(namespace string) int64 {
+	localVersionsMu.Lock()
+	defer localVersionsMu.Unlock()
+
+	return localVersions[namespace]
+}
+
+// cacheTTL adds up to 10% to the namespace TTL so entries filled together
+// don't all expire together.
+func cacheTTL(namespace string) time.Duration {
+	ttl := config.GetCacheTTL(namespace)
+	return ttl + time.Duration(rand.Int63n(int64(ttl)/10+1))
+}
+
+func cacheVersionKey(namespace string) string {
+	return "cache_version:" + namespace
+}
+
+// cacheVersion returns the version stored at the version key of name, 0 when
+// there is none or without Redis.
+func cacheVersion(name string) (int64, error) {
+	if cache == nil {
+		return 0, nil
+	}
+
+	version, err := cache.Client.Get(context.Background(), cacheVersionKey(name)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return version, err
+}
+
+// invalidateCache bumps the versions of namespaces, in Redis in a single
+// MULTI, call it once the write is committed.
+func invalidateCache(namespaces ...string) {
+	evictLocalCache(namespaces...)
+
+	if cache == nil {
+		return
+	}
+
+	_, err := cache.Client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		for _, namespace := range namespaces {
+			pipe.Incr(context.Background(), cacheVersionKey(namespace))
+		}
+		return nil
+	})
+	if err != nil && err != config.ErrRedisUnavailable {
+		log.Printf("Failed to invalidate cached %v: %v", namespaces, err)
+	}
+}
+
+// evictLocalCache bumps the in-process versions of namespaces only.
+func evictLocalCache(namespaces ...string) {
+	localVersionsMu.Lock()
+	defer localVersionsMu.Unlock()
+
+	for _, namespace := range namespaces {
+		localVersions[namespace]++
+	}
+}
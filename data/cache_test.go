@@ -0,0 +1,249 @@
+package data
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+func TestCachedUserListIsFreshAfterCreate(t *testing.T) {
+	before, err := GetUserList(testAdmin, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := testRedis.Keys(); !hasKeyWithPrefix(keys, cacheNamespaceUsers+":") {
+		t.Fatalf("user list wasn't cached in Redis, keys %v", keys)
+	}
+
+	if _, err := PostNewUser(testAdmin, InsertUserPayload{Username: "cached.list", Fullname: "Cached List", Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := GetUserList(testAdmin, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before)+1 {
+		t.Fatalf("got %d users after create, want %d", len(after), len(before)+1)
+	}
+	if !hasUsername(after, "cached.list") {
+		t.Errorf("new user missing from %v", after)
+	}
+}
+
+func TestCachedOrderItemListIsFreshAfterUpdate(t *testing.T) {
+	id, err := PostNewOrderItem(testAdmin, InsertOrderItemPayload{Name: "CACHE", Price: 100, ExpiredAt: time.Now().Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetOrderItemList(testAdmin, 1, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read once more from Redis only, to know the list really is cached
+	// there and not just in this process.
+	resetLocalCache()
+	redisHits := GetCacheStats()[cacheNamespaceOrderItems].RedisHits
+	if _, err := GetOrderItemList(testAdmin, 1, 100); err != nil {
+		t.Fatal(err)
+	}
+	if got := GetCacheStats()[cacheNamespaceOrderItems].RedisHits; got != redisHits+1 {
+		t.Fatalf("order item list wasn't read from Redis, hits went from %d to %d", redisHits, got)
+	}
+
+	if err := UpdateOrderItemByID(testAdmin, UpdateOrderItemPayload{ID: id, Name: "CACHE2", Price: 200, ExpiredAt: time.Now().Add(24 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The in-process cache and Redis both have to miss after the write.
+	for _, source := range []string{"local cache", "Redis"} {
+		if source == "Redis" {
+			resetLocalCache()
+		}
+
+		orderItems, err := GetOrderItemList(testAdmin, 1, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := false
+		for _, orderItem := range orderItems {
+			if orderItem.ID == id {
+				found = true
+				if orderItem.Name != "CACHE2" || orderItem.Price != 200 {
+					t.Errorf("read from %s after update got %s at %d, want CACHE2 at 200", source, orderItem.Name, orderItem.Price)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("read from %s after update is missing order item %d", source, id)
+		}
+	}
+}
+
+func TestCachedOrderItemListIsFreshAfterDelete(t *testing.T) {
+	id, err := PostNewOrderItem(testAdmin, InsertOrderItemPayload{Name: "GONE", Price: 100, ExpiredAt: time.Now().Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := CountOrderItems(testAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteOrderItemByID(testAdmin, id); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := CountOrderItems(testAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before-1 {
+		t.Errorf("got %d order items after delete, want %d", after, before-1)
+	}
+}
+
+func hasKeyWithPrefix(keys []string, prefix string) bool {
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasUsername(users []Users, username string) bool {
+	for _, user := range users {
+		if user.Username == username {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCachedUserListHoldsCiphertext(t *testing.T) {
+	if _, err := PostNewUser(testAdmin, InsertUserPayload{Username: "sealed.list", Fullname: "Sealed Fullname", Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := GetUserList(testAdmin, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasUsername(users, "sealed.list") {
+		t.Fatalf("new user missing from %v", users)
+	}
+
+	cached := 0
+	for _, key := range testRedis.Keys() {
+		if !strings.HasPrefix(key, cacheNamespaceUsers+":") {
+			continue
+		}
+		value, _ := testRedis.Get(key)
+		if strings.Contains(value, "sealed.list") || strings.Contains(value, "Sealed Fullname") {
+			t.Errorf("%s holds plaintext personal data: %s", key, value)
+		}
+		cached++
+	}
+	if cached == 0 {
+		t.Fatal("user list wasn't cached in Redis")
+	}
+
+	// A hit decrypts what was cached.
+	resetLocalCache()
+	users, err = GetUserList(testAdmin, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasUsername(users, "sealed.list") {
+		t.Errorf("user read from Redis isn't decrypted: %v", users)
+	}
+}
+
+func TestCachedUserHoldsCiphertext(t *testing.T) {
+	id, err := PostNewUser(testAdmin, InsertUserPayload{Username: "sealed.entity", Fullname: "Sealed Entity", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetUserByID(testAdmin, id); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := cacheVersion(entityVersion(cacheNamespaceUsers, id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := testRedis.Get(entityCacheKey(cacheNamespaceUsers, id, version))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(value, "sealed.entity") || strings.Contains(value, "Sealed Entity") {
+		t.Errorf("cached user holds plaintext personal data: %s", value)
+	}
+
+	localKey := entityCacheKey(cacheNamespaceUsers, id, localCacheVersion(cacheNamespaceUsers))
+	if local, ok := localCache().Get(localKey); !ok {
+		t.Errorf("user wasn't cached in process")
+	} else if strings.Contains(string(local), "sealed.entity") {
+		t.Errorf("user cached in process holds plaintext personal data: %s", local)
+	}
+
+	for _, source := range []string{"local cache", "Redis"} {
+		if source == "Redis" {
+			resetLocalCache()
+		}
+
+		user, err := GetUserByID(testAdmin, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Username != "sealed.entity" || user.Fullname != "Sealed Entity" {
+			t.Errorf("user read from %s got %q %q, want it decrypted", source, user.Username, user.Fullname)
+		}
+	}
+}
+
+func TestCachedUserLoadedDuringAWriteIsntServed(t *testing.T) {
+	id, err := PostNewUser(testAdmin, InsertUserPayload{Username: "racing.load", Fullname: "Before Update", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The load reads the row, then the update commits and evicts it before
+	// the load gets to store what it read.
+	stale := &Users{}
+	err = cacheEntity(cacheNamespaceUsers, id, stale, func() (interface{}, error) {
+		user := &Users{}
+		if err := storage.GetDBInstance().Where("id = ?", id).First(user).Error; err != nil {
+			return nil, err
+		}
+		fullname := "After Update"
+		if err := UpdateAUserByID(testAdmin, UpdateUserPayload{ID: id, Fullname: &fullname}); err != nil {
+			return nil, err
+		}
+		return user, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{"local cache", "Redis"} {
+		if source == "Redis" {
+			resetLocalCache()
+		}
+
+		user, err := GetUserByID(testAdmin, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Fullname != "After Update" {
+			t.Errorf("user read through %s got %q, want the updated row", source, user.Fullname)
+		}
+	}
+}
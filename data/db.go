@@ -0,0 +1,64 @@
+package data
+
+import (
+	"strconv"
+
+	"github.com/jinzhu/gorm"
+	"gitlab.com/nezaysr/go-saham.git/config"
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+// pinKey identifies the actor for read-after-write pinning, it is empty for
+// actors that aren't a user.
+func (a Actor) pinKey() string {
+	if a.ID == nil {
+		return ""
+	}
+	return "user:" + strconv.Itoa(*a.ID)
+}
+
+// readDB returns the connection reads on behalf of actor should use, a replica
+// unless actor wrote something very recently.
+func readDB(actor Actor) *gorm.DB {
+	return storage.GetReadDBInstance(actor.pinKey())
+}
+
+// cacheFillDB returns the connection cached reads are loaded from, the
+// primary. A cached result is served to every actor, loaded from a lagging
+// replica right after a write it would put back the rows the write
+// invalidated, or cache an id that was just created as missing.
+func cacheFillDB() *gorm.DB {
+	return storage.GetDBInstance()
+}
+
+// runInTransaction runs fn in a transaction on the primary that is rolled back
+// when fn returns an error, so a change and its audit entry are stored
+// together. Once committed, actor's reads are pinned to the primary for a
+// short while so they see their own write.
+func runInTransaction(actor Actor, fn func(tx *gorm.DB) error) error {
+	tx := storage.GetDBInstance().Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	storage.MarkWrite(actor.pinKey())
+	return nil
+}
+
+// forUpdate locks the rows read by tx until it ends. SQLite has no row locks,
+// its single writer already serializes transactions.
+func forUpdate(tx *gorm.DB) *gorm.DB {
+	if config.GetDBType() == config.DBTypeSQLite {
+		return tx
+	}
+	return tx.Set("gorm:query_option", "FOR UPDATE")
+}
@@ -0,0 +1,149 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jinzhu/gorm"
+	"gitlab.com/nezaysr/go-saham.git/encryption"
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+// encryptedRow is a model with encrypted fields. Their ciphertexts are bound
+// to its table and id, so they can't be moved to another row or column.
+type encryptedRow interface {
+	encryptionRow() (table string, id int)
+}
+
+// rowAAD returns the AAD of the fields of the row id of table.
+func rowAAD(table string, id int) func(field encryption.Field) []byte {
+	return func(field encryption.Field) []byte {
+		return encryption.AAD(table, gorm.ToColumnName(field.Name), id)
+	}
+}
+
+func encryptRow(row interface{}) error {
+	r, ok := row.(encryptedRow)
+	if !ok {
+		return fmt.Errorf("%T has encrypted fields but no table and id to bind them to", row)
+	}
+	return encryption.EncryptFields(row, rowAAD(r.encryptionRow()))
+}
+
+func decryptRow(row interface{}) error {
+	r, ok := row.(encryptedRow)
+	if !ok {
+		return fmt.Errorf("%T has encrypted fields but no table and id to bind them to", row)
+	}
+	return encryption.DecryptFields(row, rowAAD(r.encryptionRow()))
+}
+
+// encryptedColumns returns the encrypted columns of entity, and their blind
+// indexes, keyed by column name for UpdateColumns. Values are always sealed
+// with the active key, so every write also rotates the row's older values.
+func encryptedColumns(entity interface{}) (map[string]interface{}, error) {
+	copied := reflect.New(reflect.TypeOf(entity).Elem())
+	copied.Elem().Set(reflect.ValueOf(entity).Elem())
+
+	if err := encryptRow(copied.Interface()); err != nil {
+		return nil, err
+	}
+	return sealedColumns(copied.Interface()), nil
+}
+
+// sealedColumns returns the encrypted columns of entity, whose fields are
+// already sealed, and their blind indexes.
+func sealedColumns(entity interface{}) map[string]interface{} {
+	rv := reflect.ValueOf(entity).Elem()
+
+	columns := map[string]interface{}{}
+	for _, field := range encryption.TaggedFields(entity) {
+		columns[gorm.ToColumnName(field.Name)] = rv.FieldByName(field.Name).Interface()
+		if field.BlindIndex != "" {
+			columns[gorm.ToColumnName(field.BlindIndex)] = rv.FieldByName(field.BlindIndex).Interface()
+		}
+	}
+	return columns
+}
+
+// BackfillEncryptedUsers encrypts the users written before encryption and
+// fills in their blind index, so Signin can find them. It returns how many
+// users it updated.
+func BackfillEncryptedUsers() (int, error) {
+	users := []Users{}
+	if err := storage.GetDBInstance().Unscoped().Where("username_bidx IS NULL").Find(&users).Error; err != nil {
+		return 0, err
+	}
+
+	for i := range users {
+		columns, err := encryptedColumns(&users[i])
+		if err != nil {
+			return i, err
+		}
+
+		if err := storage.GetDBInstance().Model(&Users{}).Where("id = ?", users[i].ID).UpdateColumns(columns).Error; err != nil {
+			return i, err
+		}
+	}
+
+	return len(users), nil
+}
+
+// sealCachedRows encrypts the tagged fields of value, a row or a slice of rows
+// as returned by the load function of cacheAside, so the cache only ever
+// holds personal data as ciphertext, like the database. Rows are changed in
+// place, a row passed by value is copied.
+func sealCachedRows(value interface{}) (interface{}, error) {
+	if len(encryption.TaggedFields(value)) == 0 {
+		return value, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Struct {
+		copied := reflect.New(rv.Type())
+		copied.Elem().Set(rv)
+		return copied.Interface(), encryptRow(copied.Interface())
+	}
+
+	return value, eachRow(rv, encryptRow)
+}
+
+// openCachedRows decrypts the tagged fields of dest once a cached value has
+// been decoded into it.
+func openCachedRows(dest interface{}) error {
+	if len(encryption.TaggedFields(dest)) == 0 {
+		return nil
+	}
+
+	return eachRow(reflect.ValueOf(dest), decryptRow)
+}
+
+// eachRow calls fn with a pointer to every struct in v, a pointer to a struct
+// or a slice of structs or of pointers to them.
+func eachRow(v reflect.Value, fn func(row interface{}) error) error {
+	for v.Kind() == reflect.Ptr && v.Elem().Kind() != reflect.Struct {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return fn(v.Interface())
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			row := v.Index(i)
+			if row.Kind() != reflect.Ptr {
+				row = row.Addr()
+			}
+			if err := eachRow(row, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+func TestPlaintextWithTheCiphertextPrefixIsStored(t *testing.T) {
+	const fullname = "enc:a:b:c"
+	id, err := PostNewUser(testAdmin, InsertUserPayload{Username: "enc.prefix", Fullname: fullname, Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renamed := "enc:x:y:z"
+	if err := UpdateAUserByID(testAdmin, UpdateUserPayload{ID: id, Fullname: &renamed}); err != nil {
+		t.Fatal(err)
+	}
+
+	resetLocalCache()
+	user, err := GetUserByID(testAdmin, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Fullname != renamed {
+		t.Errorf("got fullname %q, want %q", user.Fullname, renamed)
+	}
+}
+
+func TestCiphertextsCantBeMovedBetweenRows(t *testing.T) {
+	first, err := PostNewUser(testAdmin, InsertUserPayload{Username: "aad.first", Fullname: "First Row", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := PostNewUser(testAdmin, InsertUserPayload{Username: "aad.second", Fullname: "Second Row", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		storage.GetDBInstance().Unscoped().Where("id IN (?)", []int{first, second}).Delete(&Users{})
+	})
+
+	var stored struct{ Username, Fullname string }
+	if err := storage.GetDBInstance().Table("users").Select("username, fullname").Where("id = ?", first).Scan(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored.Fullname, "First Row") {
+		t.Fatalf("fullname is stored in plaintext: %q", stored.Fullname)
+	}
+
+	// Another row, and another column of the same row, reject the ciphertext.
+	if err := storage.GetDBInstance().Table("users").Where("id = ?", second).UpdateColumn("fullname", stored.Fullname).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.GetDBInstance().Table("users").Where("id = ?", first).UpdateColumn("username", stored.Fullname).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []int{first, second} {
+		if err := storage.GetDBInstance().Where("id = ?", id).First(&Users{}).Error; err == nil {
+			t.Errorf("user %d decrypted a ciphertext moved from another row or column", id)
+		}
+	}
+}
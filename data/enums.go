@@ -1,9 +1,29 @@
 package data
 
-type UserRole string
+import "gitlab.com/nezaysr/go-saham.git/model"
+
+// The enums are declared in package model, shared with the client, and
+// aliased here.
+type (
+	UserRole      = model.UserRole
+	ActorType     = model.ActorType
+	AuditAction   = model.AuditAction
+	ErasureStatus = model.ErasureStatus
+)
 
 const (
-	Admin   UserRole = "admin"
-	User    UserRole = "user"
-	Retired UserRole = "retired"
+	Admin            = model.Admin
+	User             = model.User
+	Retired          = model.Retired
+	ActorUser        = model.ActorUser
+	ActorAPIKey      = model.ActorAPIKey
+	ActorSystem      = model.ActorSystem
+	AuditCreate      = model.AuditCreate
+	AuditUpdate      = model.AuditUpdate
+	AuditDelete      = model.AuditDelete
+	AuditSignin      = model.AuditSignin
+	AuditErase       = model.AuditErase
+	ErasurePending   = model.ErasurePending
+	ErasureCompleted = model.ErasureCompleted
+	ErasureRejected  = model.ErasureRejected
 )
@@ -0,0 +1,80 @@
+package data
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"gitlab.com/nezaysr/go-saham.git/model"
+)
+
+// The errors are declared in package model, shared with the client, and
+// aliased here.
+type (
+	ErrorKind  = model.ErrorKind
+	Error      = model.Error
+	FieldError = model.FieldError
+)
+
+const (
+	KindInternal       = model.KindInternal
+	KindBadRequest     = model.KindBadRequest
+	KindValidation     = model.KindValidation
+	KindUnauthorized   = model.KindUnauthorized
+	KindForbidden      = model.KindForbidden
+	KindNotFound       = model.KindNotFound
+	KindConflict       = model.KindConflict
+	KindUnavailable    = model.KindUnavailable
+	KindNotImplemented = model.KindNotImplemented
+)
+
+var (
+	BadRequest     = model.BadRequest
+	Validation     = model.Validation
+	Unauthorized   = model.Unauthorized
+	Forbidden      = model.Forbidden
+	NotFound       = model.NotFound
+	Conflict       = model.Conflict
+	Unavailable    = model.Unavailable
+	NotImplemented = model.NotImplemented
+	ErrorKindOf    = model.ErrorKindOf
+)
+
+// dbError turns the database errors callers can do something about into an
+// *Error about entity, a missing row or a duplicate one. Anything else is
+// returned as it is.
+func dbError(entity string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	if gorm.IsRecordNotFoundError(err) {
+		return NotFound(entity+"_not_found", entity+" not found").Wrap(err)
+	}
+
+	if isUniqueViolation(err) {
+		return Conflict(entity+"_exists", entity+" already exists").Wrap(err)
+	}
+
+	return err
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+
+	return false
+}
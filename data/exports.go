@@ -0,0 +1,476 @@
+package data
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/redis/go-redis/v9"
+	"gitlab.com/nezaysr/go-saham.git/config"
+	"gitlab.com/nezaysr/go-saham.git/encryption"
+	"gitlab.com/nezaysr/go-saham.git/model"
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+const (
+	ExportFormatCSV            = model.ExportFormatCSV
+	ExportFormatNDJSON         = model.ExportFormatNDJSON
+	ExportFormatXLSX           = model.ExportFormatXLSX
+	ExportEntityUsers          = model.ExportEntityUsers
+	ExportEntityOrderItems     = model.ExportEntityOrderItems
+	ExportEntityOrderHistories = model.ExportEntityOrderHistories
+	ExportJobPending           = model.ExportJobPending
+	ExportJobRunning           = model.ExportJobRunning
+	ExportJobDone              = model.ExportJobDone
+	ExportJobFailed            = model.ExportJobFailed
+)
+
+var (
+	ErrUnknownExportEntity   = model.ErrUnknownExportEntity
+	ErrUnknownExportFormat   = model.ErrUnknownExportFormat
+	ErrExportJobNotFound     = model.ErrExportJobNotFound
+	ErrExportJobsUnavailable = model.ErrExportJobsUnavailable
+)
+
+const exportJobTTL = 24 * time.Hour
+
+type exportTable struct {
+	columns []string
+	// encrypted are the columns of users written in plaintext, with the
+	// column holding the id of their user.
+	encrypted map[string]string
+	query     func(filter ExportFilter) (*sql.Rows, error)
+}
+
+var exportTables = map[string]exportTable{
+	ExportEntityUsers: {
+		columns:   []string{"id", "username", "fullname", "first_order_id", "role", "created_at", "updated_at", "deleted_at"},
+		encrypted: map[string]string{"username": "id", "fullname": "id"},
+		query: func(filter ExportFilter) (*sql.Rows, error) {
+			db := storage.GetReadDBInstance("").Table("users").
+				Select("id, username, fullname, first_order_id, role, created_at, updated_at, deleted_at").
+				Where("deleted_at IS NULL")
+			return paginateExport(db, filter).Order("id DESC").Rows()
+		},
+	},
+	ExportEntityOrderItems: {
+		columns: []string{"id", "name", "price", "expired_at", "created_at", "updated_at", "deleted_at"},
+		query: func(filter ExportFilter) (*sql.Rows, error) {
+			db := storage.GetReadDBInstance("").Table("orders_items").
+				Select("id, name, price, expired_at, created_at, updated_at, deleted_at").
+				Where("deleted_at IS NULL")
+			return paginateExport(db, filter).Order("id DESC").Rows()
+		},
+	},
+	ExportEntityOrderHistories: {
+		columns:   []string{"id", "user_id", "username", "fullname", "order_item_id", "order_item_name", "price", "descriptions", "created_at"},
+		encrypted: map[string]string{"username": "user_id", "fullname": "user_id"},
+		query: func(filter ExportFilter) (*sql.Rows, error) {
+			db := storage.GetReadDBInstance("").Table("orders_histories AS oh").
+				Select("oh.id, oh.user_id, u.username, u.fullname, oh.order_item_id, oi.name, oi.price, oh.descriptions, oh.created_at").
+				Joins("LEFT JOIN users AS u ON u.id = oh.user_id AND u.deleted_at IS NULL").
+				Joins("LEFT JOIN orders_items AS oi ON oi.id = oh.order_item_id").
+				Where("oh.deleted_at IS NULL")
+			if filter.UserID != nil {
+				db = db.Where("oh.user_id = ?", *filter.UserID)
+			}
+			return paginateExport(db, filter).Order("oh.id DESC").Rows()
+		},
+	},
+}
+
+// ExportTable streams every row of entity matching filter into w, reading them
+// one at a time from a database cursor.
+func ExportTable(w io.Writer, entity string, format string, filter ExportFilter) error {
+	table, ok := exportTables[entity]
+	if !ok {
+		return ErrUnknownExportEntity
+	}
+
+	out, err := newExportWriter(w, format, entity)
+	if err != nil {
+		return err
+	}
+
+	rows, err := table.query(filter)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	header := make([]interface{}, len(table.columns))
+	for i, column := range table.columns {
+		header[i] = column
+	}
+	if format != ExportFormatNDJSON {
+		if err := out.WriteRow(header); err != nil {
+			return err
+		}
+	}
+
+	values := make([]interface{}, len(table.columns))
+	pointers := make([]interface{}, len(table.columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+
+		row := make([]interface{}, len(values))
+		for i, value := range values {
+			row[i] = normalizeExportValue(value)
+		}
+		table.decrypt(row)
+
+		if ndjson, ok := out.(*ndjsonExportWriter); ok {
+			err = ndjson.WriteObject(table.columns, row)
+		} else {
+			err = out.WriteRow(row)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+func ExportContentType(format string) string {
+	switch format {
+	case ExportFormatCSV:
+		return "text/csv"
+	case ExportFormatNDJSON:
+		return "application/x-ndjson"
+	case ExportFormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+func ExportFileName(entity string, format string) string {
+	return fmt.Sprintf("%s-%s.%s", entity, time.Now().Format("20060102-150405"), format)
+}
+
+func IsExportFormat(format string) bool {
+	return format == ExportFormatCSV || format == ExportFormatNDJSON || format == ExportFormatXLSX
+}
+
+func IsExportEntity(entity string) bool {
+	_, ok := exportTables[entity]
+	return ok
+}
+
+// StartExportJob runs the export in the background into a file under the
+// export directory. Its progress is kept in redis so it can be polled.
+func StartExportJob(rdb *config.Database, entity string, format string, filter ExportFilter) (*ExportJob, error) {
+	if !IsExportEntity(entity) {
+		return nil, ErrUnknownExportEntity
+	}
+	if !IsExportFormat(format) {
+		return nil, ErrUnknownExportFormat
+	}
+
+	dir := config.GetExportDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	job := &ExportJob{
+		ID:        uuid.New().String(),
+		Entity:    entity,
+		Format:    format,
+		Status:    ExportJobPending,
+		FileName:  ExportFileName(entity, format),
+		CreatedAt: time.Now(),
+	}
+
+	if err := saveExportJob(rdb, job); err != nil {
+		return nil, ErrExportJobsUnavailable.Wrap(err)
+	}
+
+	go runExportJob(rdb, *job, filter)
+
+	return job, nil
+}
+
+func GetExportJob(rdb *config.Database, jobID string) (*ExportJob, error) {
+	cachedData, err := rdb.Client.Get(config.Ctx, exportJobKey(jobID)).Result()
+	if err == redis.Nil {
+		return nil, ErrExportJobNotFound
+	} else if err != nil {
+		return nil, ErrExportJobsUnavailable.Wrap(err)
+	}
+
+	job := &ExportJob{}
+	if err := json.Unmarshal([]byte(cachedData), job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// ExportJobFilePath returns where the file of a finished job is stored.
+func ExportJobFilePath(job *ExportJob) string {
+	return filepath.Join(config.GetExportDir(), job.ID+"."+job.Format)
+}
+
+func runExportJob(rdb *config.Database, job ExportJob, filter ExportFilter) {
+	job.Status = ExportJobRunning
+	if err := saveExportJob(rdb, &job); err != nil {
+		log.Printf("Failed to update export job %s: %v", job.ID, err)
+	}
+
+	err := writeExportFile(ExportJobFilePath(&job), job.Entity, job.Format, filter)
+
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	if err != nil {
+		log.Printf("Export job %s failed: %v", job.ID, err)
+		job.Status = ExportJobFailed
+		job.Error = err.Error()
+		os.Remove(ExportJobFilePath(&job))
+	} else {
+		job.Status = ExportJobDone
+	}
+
+	if err := saveExportJob(rdb, &job); err != nil {
+		log.Printf("Failed to update export job %s: %v", job.ID, err)
+	}
+}
+
+// MaintainExportFiles removes the files of background exports once their job
+// has expired from Redis, checking every hour.
+func MaintainExportFiles() {
+	for {
+		if err := SweepExportFiles(time.Now().Add(-exportJobTTL)); err != nil {
+			log.Printf("Failed to sweep export files: %v", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// SweepExportFiles removes the export files last written before cutoff.
+func SweepExportFiles(cutoff time.Time) error {
+	entries, err := os.ReadDir(config.GetExportDir())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !IsExportFormat(strings.TrimPrefix(filepath.Ext(entry.Name()), ".")) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(config.GetExportDir(), entry.Name())); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove export file %s: %v", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+func writeExportFile(path string, entity string, format string, filter ExportFilter) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	if err := ExportTable(w, entity, format, filter); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func saveExportJob(rdb *config.Database, job *ExportJob) error {
+	value, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return rdb.Client.Set(config.Ctx, exportJobKey(job.ID), value, exportJobTTL).Err()
+}
+
+func exportJobKey(jobID string) string {
+	return "export_job:" + jobID
+}
+
+func paginateExport(db *gorm.DB, filter ExportFilter) *gorm.DB {
+	if filter.Limit > 0 {
+		page := filter.Page
+		if page < 1 {
+			page = 1
+		}
+		db = db.Offset((page - 1) * filter.Limit).Limit(filter.Limit)
+	}
+	return db
+}
+
+// decrypt writes the encrypted columns of row in plaintext, a value that can't
+// be decrypted is left as is rather than failing the whole export.
+func (t exportTable) decrypt(row []interface{}) {
+	for i, column := range t.columns {
+		idColumn, ok := t.encrypted[column]
+		if !ok {
+			continue
+		}
+
+		value, _ := row[i].(string)
+		id, _ := strconv.Atoi(exportCellString(row[t.columnIndex(idColumn)]))
+		if plaintext, err := encryption.Decrypt(value, encryption.AAD("users", column, id)); err == nil {
+			row[i] = plaintext
+		}
+	}
+}
+
+func (t exportTable) columnIndex(column string) int {
+	for i, c := range t.columns {
+		if c == column {
+			return i
+		}
+	}
+	return -1
+}
+
+func normalizeExportValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return normalizeExportValue(string(v))
+	case string:
+		return v
+	case int32:
+		return int(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return value
+}
+
+func exportCellString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return fmt.Sprint(value)
+}
+
+type exportWriter interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+func newExportWriter(w io.Writer, format string, entity string) (exportWriter, error) {
+	switch format {
+	case ExportFormatCSV:
+		return &csvExportWriter{w: csv.NewWriter(w)}, nil
+	case ExportFormatNDJSON:
+		return &ndjsonExportWriter{w: w}, nil
+	case ExportFormatXLSX:
+		return newXLSXWriter(w, entity)
+	}
+	return nil, ErrUnknownExportFormat
+}
+
+// EscapeCSVCell quotes text that spreadsheets would run as a formula, cells
+// starting with =, +, -, @, a tab or a carriage return.
+func EscapeCSVCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvExportWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = exportCellString(value)
+		if _, isString := value.(string); isString {
+			record[i] = EscapeCSVCell(record[i])
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvExportWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonExportWriter struct {
+	w io.Writer
+}
+
+func (n *ndjsonExportWriter) WriteRow(values []interface{}) error {
+	line, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	_, err = n.w.Write(append(line, '\n'))
+	return err
+}
+
+// WriteObject writes the row as a JSON object keeping the column order.
+func (n *ndjsonExportWriter) WriteObject(columns []string, values []interface{}) error {
+	line := []byte{'{'}
+	for i, column := range columns {
+		if i > 0 {
+			line = append(line, ',')
+		}
+		key, _ := json.Marshal(column)
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			return err
+		}
+		line = append(line, key...)
+		line = append(line, ':')
+		line = append(line, value...)
+	}
+	line = append(line, '}', '\n')
+
+	_, err := n.w.Write(line)
+	return err
+}
+
+func (n *ndjsonExportWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,65 @@
+package data
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVExportEscapesFormulas(t *testing.T) {
+	var o bytes.Buffer
+	w, err := newExportWriter(&o, ExportFormatCSV, ExportEntityOrderItems)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WriteRow([]interface{}{"=HYPERLINK(\"x\")", "@A1", "+1", "-1", "\t=1", "\r=1", -1, "ANTM"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "\"'=HYPERLINK(\"\"x\"\")\",'@A1,'+1,'-1,'\t=1,\"'\r=1\",-1,ANTM\n"
+	if o.String() != want {
+		t.Fatalf("got %q, want %q", o.String(), want)
+	}
+}
+
+func TestExportsLeaveSoftDeletedRowsOut(t *testing.T) {
+	itemID, err := PostNewOrderItem(testAdmin, InsertOrderItemPayload{Name: "EXPORT_DELETED", Price: 100, ExpiredAt: time.Now().Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keptID, err := PostNewOrderItem(testAdmin, InsertOrderItemPayload{Name: "EXPORT_KEPT", Price: 100, ExpiredAt: time.Now().Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, err := PostNewUser(testAdmin, InsertUserPayload{Username: "export.deleted", Fullname: "Export Deleted", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := BuyOrderItem(testAdmin, userID, keptID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteOrderItemByID(testAdmin, itemID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteAUserByID(testAdmin, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entity := range []string{ExportEntityUsers, ExportEntityOrderItems, ExportEntityOrderHistories} {
+		var o bytes.Buffer
+		if err := ExportTable(&o, entity, ExportFormatCSV, ExportFilter{}); err != nil {
+			t.Fatal(err)
+		}
+		for _, deleted := range []string{"EXPORT_DELETED", "export.deleted", "Export Deleted"} {
+			if strings.Contains(o.String(), deleted) {
+				t.Errorf("%s export has the soft deleted %q:\n%s", entity, deleted, o.String())
+			}
+		}
+	}
+}
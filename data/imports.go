@@ -0,0 +1,370 @@
+package data
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"gitlab.com/nezaysr/go-saham.git/model"
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+const (
+	ImportFormatCSV    = model.ImportFormatCSV
+	ImportFormatNDJSON = model.ImportFormatNDJSON
+)
+
+type orderItemImportRow struct {
+	Row       int
+	Name      string
+	Price     string
+	ExpiredAt string
+	ParseErr  error
+}
+
+// importLookupBatch is how many names are looked up per query.
+const importLookupBatch = 500
+
+// ImportOrderItems reads order item rows from r and validates every one of
+// them, then applies them inside a single transaction. The transaction is only
+// opened once the whole file has been read, so a slow upload holds no locks.
+// Nothing is committed when the run is a dry run or when any row fails, so
+// the returned report always describes the whole file.
+func ImportOrderItems(actor Actor, r io.Reader, opts ImportOrderItemsOptions) (*ImportReport, error) {
+	next, err := newOrderItemRowReader(r, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{DryRun: opts.DryRun, Errors: []ImportRowError{}}
+	seen := map[string]int{}
+	rows := []orderItemImportRow{}
+	items := []InsertOrderItemPayload{}
+
+	for {
+		raw, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		report.Total++
+
+		if raw.ParseErr != nil {
+			report.Errors = append(report.Errors, ImportRowError{Row: raw.Row, Message: raw.ParseErr.Error()})
+			continue
+		}
+
+		item, rowErrors := validateOrderItemRow(raw)
+		if firstRow, ok := seen[item.Name]; ok && item.Name != "" {
+			rowErrors = append(rowErrors, ImportRowError{
+				Row:     raw.Row,
+				Field:   "name",
+				Message: fmt.Sprintf("duplicate name, first seen on row %d", firstRow),
+			})
+		} else {
+			seen[item.Name] = raw.Row
+		}
+
+		if len(rowErrors) > 0 {
+			report.Errors = append(report.Errors, rowErrors...)
+			continue
+		}
+
+		rows = append(rows, raw)
+		items = append(items, item)
+	}
+
+	existing, err := existingOrderItemIDs(storage.GetDBInstance(), items)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, item := range items {
+		if _, found := existing[item.Name]; found && !opts.Upsert {
+			report.Errors = append(report.Errors, ImportRowError{Row: rows[i].Row, Field: "name", Message: "order item with this name already exists"})
+			continue
+		}
+
+		report.Valid++
+		if _, found := existing[item.Name]; found {
+			report.Updated++
+		} else {
+			report.Inserted++
+		}
+	}
+	sort.SliceStable(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Row < report.Errors[j].Row
+	})
+
+	if opts.DryRun || len(report.Errors) > 0 {
+		return report, nil
+	}
+
+	written, err := applyOrderItemImport(actor, items, existing)
+	if err != nil {
+		return nil, err
+	}
+
+	storage.MarkWrite(actor.pinKey())
+	invalidateCache(cacheNamespaceOrderItems)
+	evictCachedEntity(cacheNamespaceOrderItems, written...)
+	report.Applied = true
+
+	return report, nil
+}
+
+// existingOrderItemIDs returns the ids of the order items named like items,
+// keyed by name.
+func existingOrderItemIDs(db *gorm.DB, items []InsertOrderItemPayload) (map[string]int, error) {
+	existing := map[string]int{}
+	for start := 0; start < len(items); start += importLookupBatch {
+		end := start + importLookupBatch
+		if end > len(items) {
+			end = len(items)
+		}
+
+		names := make([]string, 0, end-start)
+		for _, item := range items[start:end] {
+			names = append(names, item.Name)
+		}
+
+		found := []OrdersItem{}
+		if err := db.Select("id, name").Where("name IN (?)", names).Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, item := range found {
+			existing[item.Name] = item.ID
+		}
+	}
+	return existing, nil
+}
+
+// applyOrderItemImport writes validated items in one transaction, updating the
+// ones in existing and inserting the others. It returns the written ids.
+func applyOrderItemImport(actor Actor, items []InsertOrderItemPayload, existing map[string]int) ([]int, error) {
+	tx := storage.GetDBInstance().Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	written := make([]int, 0, len(items))
+	for _, item := range items {
+		if id, found := existing[item.Name]; found {
+			before := &OrdersItem{}
+			if err := tx.Where("id = ?", id).First(before).Error; err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+
+			if err := tx.Model(&OrdersItem{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+				"price":      item.Price,
+				"expired_at": item.ExpiredAt,
+				"updated_at": &NullableTime{Time: time.Now(), Valid: true},
+			}).Error; err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+
+			after := &OrdersItem{}
+			if err := tx.Where("id = ?", id).First(after).Error; err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			if err := recordAudit(tx, actor, AuditUpdate, AuditEntityOrderItem, id, before, after); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			written = append(written, id)
+			continue
+		}
+
+		order_item := &OrdersItem{
+			Name:      item.Name,
+			Price:     item.Price,
+			ExpiredAt: item.ExpiredAt,
+			CreatedAt: time.Now(),
+		}
+		if err := tx.Create(order_item).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := recordAudit(tx, actor, AuditCreate, AuditEntityOrderItem, order_item.ID, nil, order_item); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		written = append(written, order_item.ID)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return written, nil
+}
+
+func validateOrderItemRow(raw orderItemImportRow) (InsertOrderItemPayload, []ImportRowError) {
+	var item InsertOrderItemPayload
+	var rowErrors []ImportRowError
+
+	item.Name = strings.TrimSpace(raw.Name)
+
+	price, err := strconv.Atoi(strings.TrimSpace(raw.Price))
+	if err != nil {
+		rowErrors = append(rowErrors, ImportRowError{Row: raw.Row, Field: "price", Message: "price must be a whole number"})
+	}
+	item.Price = price
+
+	expiredAt, err := parseImportTime(strings.TrimSpace(raw.ExpiredAt))
+	if err != nil {
+		rowErrors = append(rowErrors, ImportRowError{Row: raw.Row, Field: "expired_at", Message: err.Error()})
+	}
+	item.ExpiredAt = expiredAt
+
+	// The rest is checked like an order item created through the API, fields
+	// that couldn't be parsed are already reported.
+	for _, fieldErr := range validateFields(item) {
+		if hasImportRowError(rowErrors, fieldErr.Field) {
+			continue
+		}
+		rowErrors = append(rowErrors, ImportRowError{Row: raw.Row, Field: fieldErr.Field, Message: fieldErr.Message})
+	}
+
+	return item, rowErrors
+}
+
+func hasImportRowError(rowErrors []ImportRowError, field string) bool {
+	for _, rowErr := range rowErrors {
+		if rowErr.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func parseImportTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("expired_at is required")
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, errors.New("expired_at must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+}
+
+func newOrderItemRowReader(r io.Reader, format string) (func() (orderItemImportRow, error), error) {
+	switch format {
+	case ImportFormatCSV:
+		return newCSVOrderItemRowReader(r)
+	case ImportFormatNDJSON:
+		return newNDJSONOrderItemRowReader(r), nil
+	}
+
+	return nil, Validation("unknown_import_format", fmt.Sprintf("unsupported import format %q, use csv or ndjson", format))
+}
+
+func newCSVOrderItemRowReader(r io.Reader) (func() (orderItemImportRow, error), error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, Validation("empty_import", "csv file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "price", "expired_at"} {
+		if _, ok := columns[required]; !ok {
+			return nil, Validation("missing_import_column", fmt.Sprintf("csv header is missing the %q column", required))
+		}
+	}
+
+	row := 0
+	return func() (orderItemImportRow, error) {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return orderItemImportRow{}, io.EOF
+		}
+		row++
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return orderItemImportRow{Row: row, ParseErr: parseErr.Err}, nil
+		}
+		if err != nil {
+			return orderItemImportRow{}, err
+		}
+
+		field := func(name string) string {
+			if i := columns[name]; i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+
+		return orderItemImportRow{
+			Row:       row,
+			Name:      field("name"),
+			Price:     field("price"),
+			ExpiredAt: field("expired_at"),
+		}, nil
+	}, nil
+}
+
+func newNDJSONOrderItemRowReader(r io.Reader) func() (orderItemImportRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1048576)
+
+	row := 0
+	return func() (orderItemImportRow, error) {
+		for scanner.Scan() {
+			row++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			var record struct {
+				Name      string      `json:"name"`
+				Price     json.Number `json:"price"`
+				ExpiredAt string      `json:"expired_at"`
+			}
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				return orderItemImportRow{Row: row, ParseErr: fmt.Errorf("invalid json: %v", err)}, nil
+			}
+
+			return orderItemImportRow{
+				Row:       row,
+				Name:      record.Name,
+				Price:     record.Price.String(),
+				ExpiredAt: record.ExpiredAt,
+			}, nil
+		}
+
+		if err := scanner.Err(); err != nil {
+			return orderItemImportRow{}, err
+		}
+		return orderItemImportRow{}, io.EOF
+	}
+}
@@ -0,0 +1,57 @@
+package data
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+func TestImportDoesntHoldTheDatabaseWhileReading(t *testing.T) {
+	r, w := io.Pipe()
+
+	type result struct {
+		report *ImportReport
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		report, err := ImportOrderItems(testAdmin, r, ImportOrderItemsOptions{Format: ImportFormatCSV})
+		done <- result{report, err}
+	}()
+
+	expiredAt := time.Now().Add(24 * time.Hour).Format("2006-01-02")
+	// Each write returns once the import has read the one before it.
+	for _, chunk := range []string{"name,price,expired_at\n", "SLOW_UPLOAD_1,100," + expiredAt + "\n", "SLOW_UPLOAD_2,200," + expiredAt + "\n"} {
+		if _, err := io.WriteString(w, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The upload is still going, SQLite only has the one connection.
+	queried := make(chan error, 1)
+	go func() {
+		var count int
+		queried <- storage.GetDBInstance().Model(&OrdersItem{}).Count(&count).Error
+	}()
+	select {
+	case err := <-queried:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		w.Close()
+		t.Fatal("a query waited on an import that is still reading its file")
+	}
+
+	w.Close()
+
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if !res.report.Applied || res.report.Inserted != 2 {
+		t.Fatalf("got report %+v, want 2 rows inserted", res.report)
+	}
+}
@@ -0,0 +1,90 @@
+package data
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"gitlab.com/nezaysr/go-saham.git/config"
+	"gitlab.com/nezaysr/go-saham.git/encryption"
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+var (
+	testRedis *miniredis.Miniredis
+	testRDB   *config.Database
+
+	testAdminID = 1
+	testAdmin   = Actor{ID: &testAdminID, Type: ActorUser, Role: Admin}
+)
+
+// The tests run against a migrated ":memory:" SQLite database and an in
+// process Redis.
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "go-saham-data")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Setenv("DBType", config.DBTypeSQLite)
+	os.Setenv("DBPath", ":memory:")
+
+	if err := loadTestKeyfile(filepath.Join(dir, "keys.json")); err != nil {
+		log.Fatal(err)
+	}
+
+	storage.NewDB()
+	if err := storage.Migrate(); err != nil {
+		log.Fatalf("Failed to migrate: %s", err.Error())
+	}
+
+	testRedis, err = miniredis.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if testRDB, err = config.NewDatabase(testRedis.Addr(), ""); err != nil {
+		log.Fatal(err)
+	}
+	UseCache(testRDB)
+
+	code := m.Run()
+	testRedis.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func loadTestKeyfile(path string) error {
+	masterKey, err := encryption.GenerateKey()
+	if err != nil {
+		return err
+	}
+	blindIndexKey, err := encryption.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(encryption.Keyfile{
+		Active:        "test",
+		Keys:          map[string]string{"test": masterKey},
+		BlindIndexKey: blindIndexKey,
+	})
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+		return err
+	}
+
+	return encryption.LoadKeyfile(path)
+}
+
+// resetLocalCache empties the in-process cache, so the next reads come from
+// Redis like they would in another process.
+func resetLocalCache() {
+	localCache()
+	local = newLRUCache(config.GetLocalCacheSize(), config.GetLocalCacheTTL())
+}
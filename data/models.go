@@ -2,7 +2,12 @@ package data
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/jinzhu/gorm"
 	"time"
+
+	"gitlab.com/nezaysr/go-saham.git/encryption"
 )
 
 var Db *sql.DB
@@ -19,18 +24,102 @@ type NullableTime struct {
 	Valid bool
 }
 
+func (nt *NullableTime) Scan(value interface{}) error {
+	if value == nil {
+		nt.Time, nt.Valid = time.Time{}, false
+		return nil
+	}
+
+	t, ok := value.(time.Time)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into NullableTime", value)
+	}
+	nt.Time, nt.Valid = t, true
+	return nil
+}
+
+func (nt NullableTime) Value() (driver.Value, error) {
+	if !nt.Valid {
+		return nil, nil
+	}
+	return nt.Time, nil
+}
+
+// JSONText holds raw JSON stored in a jsonb column and is written out as is.
+type JSONText []byte
+
+func (j *JSONText) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*j = nil
+	case []byte:
+		*j = append((*j)[0:0], v...)
+	case string:
+		*j = JSONText(v)
+	default:
+		return fmt.Errorf("cannot scan %T into JSONText", value)
+	}
+	return nil
+}
+
+func (j JSONText) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+func (j JSONText) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
 type Users struct {
 	ID           int           `gorm:"primary_key;auto_increment" json:"id"`
-	Username     string        `gorm:"size:255;not null;unique" json:"username"`
-	Fullname     string        `gorm:"size:255;not null" json:"fullname"`
+	Username     string        `gorm:"type:text;not null" json:"username" encrypted:"true" blind_index:"UsernameBidx"`
+	UsernameBidx string        `gorm:"size:64;unique" json:"-"`
+	Fullname     string        `gorm:"type:text;not null" json:"fullname" encrypted:"true"`
 	FirstOrderId *int          `json:"first_order_id,omitempty"`
-	Password     string        `gorm:"password" json:"password"`
+	Password     string        `gorm:"password" json:"password,omitempty" sensitive:"true"`
 	Role         UserRole      `gorm:"size:100;not null;" json:"role"`
 	CreatedAt    time.Time     `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt    *NullableTime `json:"updated_at,omitempty"`
 	DeletedAt    *NullableTime `json:"deleted_at,omitempty"`
 }
 
+// Fields tagged `encrypted` are stored encrypted and only ever plaintext in
+// memory, these hooks convert them on the way in and out of the database.
+func (u *Users) BeforeSave() error {
+	return encryptRow(u)
+}
+
+// AfterCreate seals the fields again for the id the row got, BeforeSave only
+// had the zero id of a new row.
+func (u *Users) AfterCreate(tx *gorm.DB) error {
+	if err := encryption.DecryptFields(u, rowAAD("users", 0)); err != nil {
+		return err
+	}
+	if err := encryptRow(u); err != nil {
+		return err
+	}
+
+	return tx.Model(&Users{}).Where("id = ?", u.ID).UpdateColumns(sealedColumns(u)).Error
+}
+
+func (u *Users) AfterSave() error {
+	return decryptRow(u)
+}
+
+func (u *Users) AfterFind() error {
+	return decryptRow(u)
+}
+
+func (u *Users) encryptionRow() (string, int) {
+	return "users", u.ID
+}
+
 type OrdersItem struct {
 	ID        int           `gorm:"primary_key;auto_increment" json:"id"`
 	Name      string        `gorm:"size:255;not null;unique" json:"name"`
@@ -50,3 +139,32 @@ type OrdersHistories struct {
 	UpdatedAt    *NullableTime `json:"updated_at,omitempty"`
 	DeletedAt    *NullableTime `json:"deleted_at,omitempty"`
 }
+
+type AuditLog struct {
+	ID         int         `gorm:"primary_key;auto_increment" json:"id"`
+	ActorID    *int        `json:"actor_id"`
+	ActorType  ActorType   `gorm:"size:20;not null" json:"actor_type"`
+	Action     AuditAction `gorm:"size:20;not null" json:"action"`
+	EntityType string      `gorm:"size:50;not null" json:"entity_type"`
+	EntityID   int         `json:"entity_id"`
+	Changes    JSONText    `gorm:"type:jsonb" json:"changes"`
+	RequestID  string      `gorm:"size:64" json:"request_id"`
+	IP         string      `gorm:"size:64" json:"ip"`
+	CreatedAt  time.Time   `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_log"
+}
+
+type ErasureRequest struct {
+	ID          int           `gorm:"primary_key;auto_increment" json:"id"`
+	UserId      int           `json:"user_id"`
+	RequestedBy *int          `json:"requested_by"`
+	Reason      string        `gorm:"size:255" json:"reason"`
+	Status      ErasureStatus `gorm:"size:20;not null" json:"status"`
+	ApprovedBy  *int          `json:"approved_by,omitempty"`
+	ApprovedAt  *NullableTime `json:"approved_at,omitempty"`
+	CompletedAt *NullableTime `json:"completed_at,omitempty"`
+	CreatedAt   time.Time     `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"gitlab.com/nezaysr/go-saham.git/config"
+)
+
+const cacheInvalidationChannel = "cache_invalidation"
+
+// cacheNamespacesByTable maps the tables sent on cacheInvalidationChannel to
+// the cache namespaces built from them.
+var cacheNamespacesByTable = map[string]string{
+	"users":            cacheNamespaceUsers,
+	"orders_items":     cacheNamespaceOrderItems,
+	"orders_histories": cacheNamespaceOrderHistories,
+}
+
+// ListenForCacheInvalidation evicts this process's cached reads whenever
+// another process changes the tables they come from, the database triggers
+// announce every change. After losing the connection it can't know what it
+// missed, so it drops everything cached locally.
+func ListenForCacheInvalidation() {
+	if config.GetDBType() != config.DBTypePostgres {
+		return
+	}
+
+	listener := pq.NewListener(config.GetPostgresConnString(), 10*time.Second, time.Minute,
+		func(event pq.ListenerEventType, err error) {
+			switch event {
+			case pq.ListenerEventConnectionAttemptFailed:
+				log.Printf("Failed to connect the cache invalidation listener: %v", err)
+			case pq.ListenerEventDisconnected:
+				log.Printf("Cache invalidation listener disconnected: %v", err)
+			case pq.ListenerEventReconnected:
+				log.Printf("Cache invalidation listener reconnected, dropping the local cache")
+				evictLocalCache(allCacheNamespaces()...)
+			}
+		})
+
+	if err := listener.Listen(cacheInvalidationChannel); err != nil {
+		log.Printf("Failed to listen for cache invalidations: %v", err)
+	}
+
+	for {
+		select {
+		case notification := <-listener.Notify:
+			// A nil notification follows a reconnect, which is handled above.
+			if notification == nil {
+				continue
+			}
+
+			namespace, ok := cacheNamespacesByTable[notification.Extra]
+			if !ok {
+				continue
+			}
+			evictLocalCache(namespace)
+		case <-time.After(90 * time.Second):
+			// Notice a dead connection even when nothing is being written.
+			go listener.Ping()
+		}
+	}
+}
+
+func allCacheNamespaces() []string {
+	namespaces := make([]string, 0, len(cacheNamespacesByTable))
+	for _, namespace := range cacheNamespacesByTable {
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces
+}
@@ -0,0 +1,303 @@
+package data
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"gitlab.com/nezaysr/go-saham.git/config"
+	"gitlab.com/nezaysr/go-saham.git/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUserRetired           = model.ErrUserRetired
+	ErrErasureNotPending     = model.ErrErasureNotPending
+	ErrErasureSelfApproval   = model.ErrErasureSelfApproval
+	ErrErasureAlreadyPending = model.ErrErasureAlreadyPending
+)
+
+const erasedFullname = "Erased User"
+
+// GetUserDataBundle collects everything stored about a user: the profile, the
+// order histories, archived ones included, the audit entries about or by them,
+// and their sign-ins.
+func GetUserDataBundle(actor Actor, userID int) (*UserDataBundle, error) {
+	db := readDB(actor)
+
+	user := &Users{}
+	if err := db.Where("id = ?", userID).First(user).Error; err != nil {
+		return nil, dbError("user", err)
+	}
+
+	bundle := &UserDataBundle{
+		GeneratedAt: time.Now(),
+		Profile: UserDataProfile{
+			ID:           user.ID,
+			Username:     user.Username,
+			Fullname:     user.Fullname,
+			FirstOrderId: user.FirstOrderId,
+			Role:         user.Role,
+			CreatedAt:    user.CreatedAt,
+			UpdatedAt:    user.UpdatedAt,
+			DeletedAt:    user.DeletedAt,
+		},
+		OrdersHistories: []OrdersHistories{},
+		AuditLog:        []AuditLog{},
+		Sessions:        []AuditLog{},
+	}
+
+	// Archived partitions only hold months older than the live ones, so they
+	// come first.
+	if config.GetDBType() == config.DBTypePostgres {
+		if err := db.Table("archive.orders_histories").Where("user_id = ?", userID).Order("id").Find(&bundle.OrdersHistories).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	live := []OrdersHistories{}
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&live).Error; err != nil {
+		return nil, err
+	}
+	bundle.OrdersHistories = append(bundle.OrdersHistories, live...)
+
+	if err := db.Where("action <> ?", AuditSignin).
+		Where("(entity_type = ? AND entity_id = ?) OR actor_id = ?", AuditEntityUser, userID, userID).
+		Order("id").Find(&bundle.AuditLog).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Where("action = ? AND actor_id = ?", AuditSignin, userID).
+		Order("id").Find(&bundle.Sessions).Error; err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+// WriteUserDataZip writes bundle as a ZIP with one JSON file per section.
+func WriteUserDataZip(w io.Writer, bundle *UserDataBundle) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", bundle.Profile},
+		{"orders_histories.json", bundle.OrdersHistories},
+		{"audit_log.json", bundle.AuditLog},
+		{"sessions.json", bundle.Sessions},
+	}
+
+	for _, file := range files {
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: bundle.GeneratedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.content); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// RequestErasure records that a user's personal data should be erased. Nothing
+// is changed until another admin approves it with ApproveErasure.
+func RequestErasure(actor Actor, erasurePayload InsertErasureRequestPayload) (*ErasureRequest, error) {
+	if err := Validate(erasurePayload); err != nil {
+		return nil, err
+	}
+
+	erasure_request := &ErasureRequest{
+		UserId:      erasurePayload.UserId,
+		RequestedBy: actor.ID,
+		Reason:      erasurePayload.Reason,
+		Status:      ErasurePending,
+		CreatedAt:   time.Now(),
+	}
+
+	err := runInTransaction(actor, func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", erasurePayload.UserId).First(&Users{}).Error; err != nil {
+			return dbError("user", err)
+		}
+
+		var pending int
+		if err := tx.Model(&ErasureRequest{}).Where("user_id = ? AND status = ?", erasurePayload.UserId, ErasurePending).Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrErasureAlreadyPending
+		}
+
+		if err := tx.Create(erasure_request).Error; err != nil {
+			return dbError("erasure_request", err)
+		}
+		return recordAudit(tx, actor, AuditCreate, AuditEntityErasureRequest, erasure_request.ID, nil, erasure_request)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return erasure_request, nil
+}
+
+// ApproveErasure records the approval of a pending request and pseudonymizes
+// the user in the same transaction. The user row and everything referencing
+// it, like order histories, stay in place so financial records add up; only
+// the personal data on the row is replaced, the IPs of the user's audit
+// entries are dropped and the account is retired.
+func ApproveErasure(actor Actor, erasureRequestID int) (*ErasureRequest, error) {
+	erasure_request := &ErasureRequest{}
+
+	err := runInTransaction(actor, func(tx *gorm.DB) error {
+		if err := forUpdate(tx).Where("id = ?", erasureRequestID).First(erasure_request).Error; err != nil {
+			return dbError("erasure_request", err)
+		}
+		if erasure_request.Status != ErasurePending {
+			return ErrErasureNotPending
+		}
+		if actor.ID == nil || (erasure_request.RequestedBy != nil && *erasure_request.RequestedBy == *actor.ID) {
+			return ErrErasureSelfApproval
+		}
+
+		before := &Users{}
+		if err := tx.Where("id = ?", erasure_request.UserId).First(before).Error; err != nil {
+			return dbError("user", err)
+		}
+
+		unusablePassword, err := randomPasswordHash()
+		if err != nil {
+			return err
+		}
+
+		erased := *before
+		erased.Username = "erased-user-" + strconv.Itoa(before.ID)
+		erased.Fullname = erasedFullname
+
+		columns, err := encryptedColumns(&erased)
+		if err != nil {
+			return err
+		}
+		columns["password"] = unusablePassword
+		columns["role"] = Retired
+		columns["updated_at"] = &NullableTime{Time: time.Now(), Valid: true}
+
+		if err := tx.Model(&Users{}).Where("id = ?", before.ID).UpdateColumns(columns).Error; err != nil {
+			return err
+		}
+
+		// The user's sign-ins and changes keep their audit entries, but not the
+		// addresses they were made from.
+		if err := tx.Model(&AuditLog{}).Where("actor_id = ?", before.ID).UpdateColumn("ip", "").Error; err != nil {
+			return err
+		}
+
+		after := &Users{}
+		if err := tx.Where("id = ?", before.ID).First(after).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, actor, AuditErase, AuditEntityUser, before.ID, before, after); err != nil {
+			return err
+		}
+
+		now := &NullableTime{Time: time.Now(), Valid: true}
+		requestBefore := *erasure_request
+		if err := tx.Model(erasure_request).UpdateColumns(map[string]interface{}{
+			"status":       ErasureCompleted,
+			"approved_by":  *actor.ID,
+			"approved_at":  now,
+			"completed_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(tx, actor, AuditUpdate, AuditEntityErasureRequest, erasure_request.ID, &requestBefore, erasure_request)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invalidateCache(cacheNamespaceUsers)
+	evictCachedEntity(cacheNamespaceUsers, erasure_request.UserId)
+
+	return erasure_request, nil
+}
+
+func RejectErasure(actor Actor, erasureRequestID int) (*ErasureRequest, error) {
+	erasure_request := &ErasureRequest{}
+
+	err := runInTransaction(actor, func(tx *gorm.DB) error {
+		if err := forUpdate(tx).Where("id = ?", erasureRequestID).First(erasure_request).Error; err != nil {
+			return dbError("erasure_request", err)
+		}
+		if erasure_request.Status != ErasurePending {
+			return ErrErasureNotPending
+		}
+
+		requestBefore := *erasure_request
+		if err := tx.Model(erasure_request).UpdateColumns(map[string]interface{}{
+			"status":      ErasureRejected,
+			"approved_by": actor.ID,
+			"approved_at": &NullableTime{Time: time.Now(), Valid: true},
+		}).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(tx, actor, AuditUpdate, AuditEntityErasureRequest, erasure_request.ID, &requestBefore, erasure_request)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return erasure_request, nil
+}
+
+func GetErasureRequests(actor Actor, page int, limit int) ([]ErasureRequest, error) {
+	db := readDB(actor)
+	offset := (page - 1) * limit
+
+	erasure_requests := []ErasureRequest{}
+	if err := db.Offset(offset).Limit(limit).Order("id DESC").Find(&erasure_requests).Error; err != nil {
+		return nil, err
+	}
+
+	return erasure_requests, nil
+}
+
+func CountErasureRequests(actor Actor) (int, error) {
+	total := 0
+	if err := readDB(actor).Model(&ErasureRequest{}).Count(&total).Error; err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// randomPasswordHash returns the hash of a random password nobody knows, so
+// the erased account can't be signed into anymore.
+func randomPasswordHash() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(secret)), 12)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hashedPassword), nil
+}
@@ -0,0 +1,52 @@
+package data
+
+import (
+	"testing"
+
+	"gitlab.com/nezaysr/go-saham.git/storage"
+)
+
+func TestApprovedErasureDropsTheUsersIPs(t *testing.T) {
+	id, err := PostNewUser(testAdmin, InsertUserPayload{Username: "erased.ips", Fullname: "Erased IPs", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	approverID, err := PostNewUser(testAdmin, InsertUserPayload{Username: "erasure.approver", Fullname: "Erasure Approver", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Signin(Actor{Type: ActorSystem, IP: "203.0.113.7"}, SigninPayload{Username: "erased.ips", Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	erasure_request, err := RequestErasure(testAdmin, InsertErasureRequestPayload{UserId: id, Reason: "testing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	approver := Actor{ID: &approverID, Type: ActorUser, Role: Admin, IP: "198.51.100.1"}
+	if _, err := ApproveErasure(approver, erasure_request.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []AuditLog{}
+	if err := storage.GetDBInstance().Where("actor_id = ?", id).Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 {
+		t.Fatal("the sign-in wasn't recorded")
+	}
+	for _, entry := range entries {
+		if entry.IP != "" {
+			t.Errorf("%s entry %d of the erased user kept IP %q", entry.Action, entry.ID, entry.IP)
+		}
+	}
+
+	erase := &AuditLog{}
+	if err := storage.GetDBInstance().Where("action = ? AND entity_id = ?", AuditErase, id).First(erase).Error; err != nil {
+		t.Fatal(err)
+	}
+	if erase.IP != approver.IP {
+		t.Errorf("the approver's erase entry has IP %q, want %q", erase.IP, approver.IP)
+	}
+}
@@ -0,0 +1,273 @@
+package data
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"gitlab.com/nezaysr/go-saham.git/encryption"
+	"gitlab.com/nezaysr/go-saham.git/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	SeedSizeSmall = "small"
+	SeedSizeDemo  = "demo"
+	SeedSizeLoad  = "load"
+)
+
+type seedPreset struct {
+	Users                 int
+	OrderItems            int
+	MaxHistoriesPerUser   int
+	HistoryWindowInDays   int
+	MaxExpiryWindowInDays int
+}
+
+var seedPresets = map[string]seedPreset{
+	SeedSizeSmall: {Users: 10, OrderItems: 20, MaxHistoriesPerUser: 5, HistoryWindowInDays: 30, MaxExpiryWindowInDays: 90},
+	SeedSizeDemo:  {Users: 100, OrderItems: 60, MaxHistoriesPerUser: 20, HistoryWindowInDays: 180, MaxExpiryWindowInDays: 365},
+	SeedSizeLoad:  {Users: 10000, OrderItems: 500, MaxHistoriesPerUser: 50, HistoryWindowInDays: 365, MaxExpiryWindowInDays: 365},
+}
+
+var (
+	seedFirstNames = []string{
+		"Adi", "Ayu", "Bagus", "Budi", "Citra", "Dewi", "Dimas", "Eka", "Fajar", "Fitri",
+		"Gilang", "Hendra", "Indah", "Joko", "Kartika", "Lestari", "Made", "Nanda", "Putri", "Rizky",
+		"Sari", "Taufik", "Wahyu", "Wulan", "Yoga",
+	}
+	seedLastNames = []string{
+		"Hidayat", "Kusuma", "Lubis", "Nasution", "Pratama", "Purnomo", "Saputra", "Santoso", "Setiawan", "Siregar",
+		"Sitompul", "Wibowo", "Wijaya", "Gunawan", "Halim", "Tanjung", "Harahap", "Utami", "Rahman", "Susanto",
+	}
+	seedTickers = []string{
+		"AALI", "ADRO", "AMRT", "ANTM", "ASII", "BBCA", "BBNI", "BBRI", "BBTN", "BMRI",
+		"BRPT", "BUKA", "CPIN", "EMTK", "EXCL", "GOTO", "ICBP", "INCO", "INDF", "INKP",
+		"INTP", "ITMG", "JPFA", "KLBF", "MDKA", "MEDC", "MIKA", "PGAS", "PTBA", "SMGR",
+		"TBIG", "TINS", "TLKM", "TOWR", "UNTR", "UNVR", "ACES", "AKRA", "ERAA", "HRUM",
+	}
+)
+
+const seedPasswordAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+type SeedOptions struct {
+	Size string `json:"size"`
+	Seed int64  `json:"seed"`
+	// Anchor is the date the generated timestamps are relative to, keep it
+	// fixed to get the same rows on every machine.
+	Anchor time.Time `json:"anchor"`
+	// PasswordCost is the bcrypt cost of the generated passwords, lower it to
+	// seed the load preset faster.
+	PasswordCost int `json:"password_cost"`
+}
+
+type SeedCredential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type SeedReport struct {
+	Size                  string           `json:"size"`
+	Seed                  int64            `json:"seed"`
+	OrderItemsCreated     int              `json:"order_items_created"`
+	OrderItemsExisting    int              `json:"order_items_existing"`
+	UsersCreated          int              `json:"users_created"`
+	UsersExisting         int              `json:"users_existing"`
+	OrderHistoriesCreated int              `json:"order_histories_created"`
+	Credentials           []SeedCredential `json:"-"`
+}
+
+// Seed generates order items, users and their order histories from
+// opts.Seed. Every row is derived from the seed and its own index only, so a
+// rerun with the same options skips what is already there and fills in what
+// is missing, and a bigger preset extends a smaller one.
+func Seed(actor Actor, opts SeedOptions) (*SeedReport, error) {
+	preset, ok := seedPresets[opts.Size]
+	if !ok {
+		return nil, fmt.Errorf("unknown seed size %q, use small, demo or load", opts.Size)
+	}
+	if opts.PasswordCost == 0 {
+		opts.PasswordCost = 12
+	}
+
+	report := &SeedReport{Size: opts.Size, Seed: opts.Seed, Credentials: []SeedCredential{}}
+
+	order_items := make([]OrdersItem, 0, preset.OrderItems)
+	for i := 0; i < preset.OrderItems; i++ {
+		order_item, created, err := seedOrderItem(actor, opts, preset, i)
+		if err != nil {
+			return report, err
+		}
+		if created {
+			report.OrderItemsCreated++
+		} else {
+			report.OrderItemsExisting++
+		}
+		order_items = append(order_items, *order_item)
+	}
+
+	for i := 0; i < preset.Users; i++ {
+		credential, histories, err := seedUser(actor, opts, preset, i, order_items)
+		if err != nil {
+			return report, err
+		}
+		if histories < 0 {
+			report.UsersExisting++
+		} else {
+			report.UsersCreated++
+			report.OrderHistoriesCreated += histories
+		}
+		report.Credentials = append(report.Credentials, *credential)
+	}
+
+	invalidateCache(cacheNamespaceUsers, cacheNamespaceOrderItems, cacheNamespaceOrderHistories)
+
+	return report, nil
+}
+
+// seedRand returns the generator for one row, kind keeps the streams of users
+// and order items apart.
+func seedRand(seed int64, kind int64, index int) *rand.Rand {
+	return rand.New(rand.NewSource(seed*1000003 + kind*7919 + int64(index)))
+}
+
+func seedOrderItem(actor Actor, opts SeedOptions, preset seedPreset, index int) (*OrdersItem, bool, error) {
+	r := seedRand(opts.Seed, 1, index)
+
+	name := seedTickers[index%len(seedTickers)]
+	if series := index / len(seedTickers); series > 0 {
+		name = fmt.Sprintf("%s-%d", name, series+1)
+	}
+
+	db := storage.GetDBInstance()
+	existing := &OrdersItem{}
+	err := db.Where("name = ?", name).First(existing).Error
+	if err == nil {
+		return existing, false, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return nil, false, err
+	}
+
+	// IDX prices move in ticks of 5 rupiah below 5000 and 25 above it.
+	price := 50 + r.Intn(4990)
+	price -= price % 5
+	if r.Intn(3) == 0 {
+		price = 5000 + r.Intn(45000)
+		price -= price % 25
+	}
+
+	order_item := &OrdersItem{
+		Name:      name,
+		Price:     price,
+		ExpiredAt: opts.Anchor.AddDate(0, 0, 30+r.Intn(preset.MaxExpiryWindowInDays)),
+		CreatedAt: opts.Anchor.AddDate(0, 0, -preset.HistoryWindowInDays),
+	}
+
+	err = runInTransaction(actor, func(tx *gorm.DB) error {
+		if err := tx.Create(order_item).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditCreate, AuditEntityOrderItem, order_item.ID, nil, order_item)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	evictCachedEntity(cacheNamespaceOrderItems, order_item.ID)
+
+	return order_item, true, nil
+}
+
+// seedUser creates the user at index together with its order histories and
+// returns how many histories were written, or -1 when the user already exists.
+func seedUser(actor Actor, opts SeedOptions, preset seedPreset, index int, order_items []OrdersItem) (*SeedCredential, int, error) {
+	r := seedRand(opts.Seed, 2, index)
+
+	firstName := seedFirstNames[r.Intn(len(seedFirstNames))]
+	lastName := seedLastNames[r.Intn(len(seedLastNames))]
+
+	password := make([]byte, 12)
+	for i := range password {
+		password[i] = seedPasswordAlphabet[r.Intn(len(seedPasswordAlphabet))]
+	}
+
+	credential := &SeedCredential{
+		Username: fmt.Sprintf("%s.%s%d", strings.ToLower(firstName), strings.ToLower(lastName), index+1),
+		Password: string(password),
+	}
+
+	usernameBidx, err := encryption.BlindIndex(credential.Username)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var existing int
+	if err := storage.GetDBInstance().Model(&Users{}).Where("username_bidx = ?", usernameBidx).Count(&existing).Error; err != nil {
+		return nil, 0, err
+	}
+	if existing > 0 {
+		return credential, -1, nil
+	}
+
+	createdAt := opts.Anchor.AddDate(0, 0, -preset.HistoryWindowInDays).Add(time.Duration(r.Intn(24*60)) * time.Minute)
+
+	order_histories := make([]OrdersHistories, r.Intn(preset.MaxHistoriesPerUser+1))
+	for i := range order_histories {
+		order_item := order_items[r.Intn(len(order_items))]
+		descriptions := fmt.Sprintf("Bought %d lot of %s at %d", 1+r.Intn(100), order_item.Name, order_item.Price)
+		order_histories[i] = OrdersHistories{
+			OrderItemId:  order_item.ID,
+			Descriptions: &descriptions,
+			CreatedAt:    createdAt.Add(time.Duration(r.Int63n(int64(preset.HistoryWindowInDays) * int64(24*time.Hour)))),
+		}
+	}
+
+	sort.Slice(order_histories, func(i, j int) bool {
+		return order_histories[i].CreatedAt.Before(order_histories[j].CreatedAt)
+	})
+
+	hashedPassword, err := bcrypt.GenerateFromPassword(password, opts.PasswordCost)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	user := &Users{
+		Username:  credential.Username,
+		Fullname:  firstName + " " + lastName,
+		Password:  string(hashedPassword),
+		Role:      User,
+		CreatedAt: createdAt,
+	}
+	if len(order_histories) > 0 {
+		user.FirstOrderId = &order_histories[0].OrderItemId
+	}
+
+	err = runInTransaction(actor, func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, actor, AuditCreate, AuditEntityUser, user.ID, nil, user); err != nil {
+			return err
+		}
+
+		for i := range order_histories {
+			order_histories[i].UserId = user.ID
+			if err := tx.Create(&order_histories[i]).Error; err != nil {
+				return err
+			}
+			if err := recordAudit(tx, actor, AuditCreate, AuditEntityOrderHistory, order_histories[i].ID, nil, &order_histories[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	evictCachedEntity(cacheNamespaceUsers, user.ID)
+
+	return credential, len(order_histories), nil
+}
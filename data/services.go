@@ -1,33 +1,53 @@
 package data
 
 import (
-	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
-	"github.com/redis/go-redis/v9"
-	"gitlab.com/nezaysr/go-saham.git/config"
+	"github.com/jinzhu/gorm"
+	"gitlab.com/nezaysr/go-saham.git/encryption"
+	"gitlab.com/nezaysr/go-saham.git/model"
 	"gitlab.com/nezaysr/go-saham.git/storage"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func Signin(signinPayload SigninPayload) (string, error) {
+var ErrInvalidCredentials = model.ErrInvalidCredentials
+
+func Signin(actor Actor, signinPayload SigninPayload) (string, error) {
+	if err := Validate(signinPayload); err != nil {
+		return "", err
+	}
+
 	db := storage.GetDBInstance()
 	user := &Users{}
-	if err := db.Where("username = ?", signinPayload.Username).First(&user).Error; err != nil {
+
+	usernameBidx, err := encryption.BlindIndex(signinPayload.Username)
+	if err != nil {
+		return "", err
+	}
+
+	// Rows written before encryption was enabled have no blind index yet and
+	// keep their plaintext username until they are next updated.
+	if err := db.Where("username_bidx = ?", usernameBidx).
+		Or("username_bidx IS NULL AND username = ?", signinPayload.Username).
+		First(&user).Error; gorm.IsRecordNotFoundError(err) {
+		return "", ErrInvalidCredentials.Wrap(err)
+	} else if err != nil {
 		return "", err
 	}
 
 	// Verify the password
-	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(signinPayload.Password))
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(signinPayload.Password))
 	if err != nil {
-		return "", err
+		return "", ErrInvalidCredentials.Wrap(err)
+	}
+
+	if user.Role == Retired {
+		return "", ErrUserRetired
 	}
 
 	var jwtTokenPayload JWTTokenPayload
@@ -41,6 +61,14 @@ func Signin(signinPayload SigninPayload) (string, error) {
 		return "", errors.New("failed to sign JWT token")
 	}
 
+	// Sign-ins are kept in the audit log, they are the sessions listed in a
+	// user's data export.
+	actor.ID = &user.ID
+	actor.Type = ActorUser
+	if err := recordAudit(db, actor, AuditSignin, AuditEntityUser, user.ID, nil, nil); err != nil {
+		log.Printf("Failed to record sign-in of user %d: %v", user.ID, err)
+	}
+
 	return tokenString, nil
 }
 
@@ -61,55 +89,70 @@ func signJWTToken(jwtTokenPayload JWTTokenPayload) string {
 	return tokenString
 }
 
-func GetUserList(rdb *config.Database, page int, limit int) ([]Users, error) {
-	cacheKey := fmt.Sprintf("user_list:%d:%d", page, limit)
-	cachedData, err := rdb.Client.Get(context.Background(), cacheKey).Result()
-	if err == nil {
-		var users []Users
-
-		err = json.Unmarshal([]byte(cachedData), &users)
-		if err != nil {
-			log.Printf("Failed to unmarshal cached user data: %v", err)
+func GetUserList(actor Actor, page int, limit int) ([]Users, error) {
+	users := []Users{}
+	err := cacheAside(actor, cacheQuery{
+		Namespace: cacheNamespaceUsers,
+		Name:      "user_list",
+		Params:    map[string]interface{}{"page": page, "limit": limit},
+	}, &users, func() (interface{}, error) {
+		db := cacheFillDB()
+		offset := (page - 1) * limit
+
+		users := []Users{}
+		if err := db.Select("id, username, fullname,first_order_id,role,created_at, updated_at, deleted_at").Offset(offset).Limit(limit).Order("id DESC").Find(&users).Error; err != nil {
+			return nil, err
 		}
 		return users, nil
-	} else if err != redis.Nil {
-		log.Printf("Failed to get cached user data: %v", err)
-	}
-
-	// User list not found in cache
-	db := storage.GetDBInstance()
-	offset := (page - 1) * limit
-
-	users := []Users{}
-	if err := db.Offset(offset).Limit(limit).Order("id DESC").Find(&users).Error; err != nil {
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	cacheValue, err := json.Marshal(users)
-	if err != nil {
-		log.Printf("Failed to marshal user data for caching: %v", err)
-	}
-	cacheTTL := 1 * time.Minute
-	err = rdb.Client.Set(context.Background(), cacheKey, cacheValue, cacheTTL).Err()
+	return users, nil
+}
+
+// CountUsers is the number of users GetUserList pages through.
+func CountUsers(actor Actor) (int, error) {
+	total := 0
+	err := cacheAside(actor, cacheQuery{
+		Namespace: cacheNamespaceUsers,
+		Name:      "user_count",
+	}, &total, func() (interface{}, error) {
+		total := 0
+		if err := cacheFillDB().Model(&Users{}).Count(&total).Error; err != nil {
+			return nil, err
+		}
+		return total, nil
+	})
 	if err != nil {
-		log.Printf("Failed to store user data in cache: %v", err)
+		return 0, err
 	}
 
-	return users, nil
+	return total, nil
 }
 
-func GetUserByID(user_id int) (*Users, error) {
-	db := storage.GetDBInstance()
+func GetUserByID(actor Actor, user_id int) (*Users, error) {
 	user := &Users{}
-	if err := db.Select("id, username, fullname,first_order_id,role,created_at, updated_at, deleted_at").Where("id=?", user_id).First(user).Error; err != nil {
-		return nil, err
+	err := cacheEntity(cacheNamespaceUsers, user_id, user, func() (interface{}, error) {
+		db := cacheFillDB()
+		user := &Users{}
+		if err := db.Select("id, username, fullname,first_order_id,role,created_at, updated_at, deleted_at").Where("id=?", user_id).First(user).Error; err != nil {
+			return nil, err
+		}
+		return user, nil
+	})
+	if err != nil {
+		return nil, dbError("user", err)
 	}
 
 	return user, nil
 }
 
-func PostNewUser(userPayload InsertUserPayload) (int, error) {
-	db := storage.GetDBInstance()
+func PostNewUser(actor Actor, userPayload InsertUserPayload) (int, error) {
+	if err := Validate(userPayload); err != nil {
+		return 0, err
+	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(userPayload.Password), 12)
 	if err != nil {
@@ -124,90 +167,163 @@ func PostNewUser(userPayload InsertUserPayload) (int, error) {
 		CreatedAt: time.Now(),
 	}
 
-	if err := db.Create(user).Error; err != nil {
+	err = runInTransaction(actor, func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return dbError("user", err)
+		}
+		return recordAudit(tx, actor, AuditCreate, AuditEntityUser, user.ID, nil, user)
+	})
+	if err != nil {
 		return 0, err
 	}
+
+	invalidateCache(cacheNamespaceUsers)
+	evictCachedEntity(cacheNamespaceUsers, user.ID)
 	return user.ID, nil
 }
 
-func UpdateAUserByID(userPayload UpdateUserPayload) error {
-	db := storage.GetDBInstance()
-	user := &Users{}
+func UpdateAUserByID(actor Actor, userPayload UpdateUserPayload) error {
+	if err := Validate(userPayload); err != nil {
+		return err
+	}
 
-	if err := db.Model(user).Where("id = ?", userPayload.ID).UpdateColumns(
-		map[string]interface{}{
-			"fullname":       userPayload.Fullname,
-			"first_order_id": userPayload.FirstOrderId,
+	err := runInTransaction(actor, func(tx *gorm.DB) error {
+		before := &Users{}
+		if err := tx.Where("id = ?", userPayload.ID).First(before).Error; err != nil {
+			return dbError("user", err)
+		}
+
+		// Only the fields sent by the caller are touched.
+		columns := map[string]interface{}{
 			"updated_at": &NullableTime{
 				Time:  time.Now(),
 				Valid: true,
 			},
-		},
-	).Error; err != nil {
-		return err
-	}
-	return nil
-}
+		}
+		if userPayload.FirstOrderId != nil {
+			columns["first_order_id"] = *userPayload.FirstOrderId
+		}
 
-func DeleteAUserByID(user_id int) error {
-	db := storage.GetDBInstance()
-	user := &Users{}
+		// Encrypted fields are rewritten on every update, which moves them to
+		// the active key.
+		updated := *before
+		if userPayload.Fullname != nil {
+			updated.Fullname = *userPayload.Fullname
+		}
+		encrypted, err := encryptedColumns(&updated)
+		if err != nil {
+			return err
+		}
+		for column, value := range encrypted {
+			columns[column] = value
+		}
+
+		if err := tx.Model(&Users{}).Where("id = ?", userPayload.ID).UpdateColumns(columns).Error; err != nil {
+			return err
+		}
+
+		after := &Users{}
+		if err := tx.Where("id = ?", userPayload.ID).First(after).Error; err != nil {
+			return err
+		}
 
-	if err := db.Model(user).Where("id = ?", user_id).Delete(user).Error; err != nil {
+		return recordAudit(tx, actor, AuditUpdate, AuditEntityUser, userPayload.ID, before, after)
+	})
+	if err != nil {
 		return err
 	}
 
+	invalidateCache(cacheNamespaceUsers)
+	evictCachedEntity(cacheNamespaceUsers, userPayload.ID)
 	return nil
 }
 
-func GetOrderItemList(rdb *config.Database, page int, limit int) ([]OrdersItem, error) {
-	cacheKey := fmt.Sprintf("order_item:%d:%d", page, limit)
-	cachedData, err := rdb.Client.Get(context.Background(), cacheKey).Result()
-	if err == nil {
-		var order_item []OrdersItem
+func DeleteAUserByID(actor Actor, user_id int) error {
+	err := runInTransaction(actor, func(tx *gorm.DB) error {
+		user := &Users{}
+		if err := tx.Where("id = ?", user_id).First(user).Error; err != nil {
+			return dbError("user", err)
+		}
 
-		err = json.Unmarshal([]byte(cachedData), &order_item)
-		if err != nil {
-			log.Printf("Failed to unmarshal cached order_item data: %v", err)
+		if err := tx.Model(user).Where("id = ?", user_id).Delete(user).Error; err != nil {
+			return err
 		}
-		return order_item, nil
-	} else if err != redis.Nil {
-		log.Printf("Failed to get cached order_item data: %v", err)
+
+		return recordAudit(tx, actor, AuditDelete, AuditEntityUser, user_id, user, nil)
+	})
+	if err != nil {
+		return err
 	}
 
-	db := storage.GetDBInstance()
-	offset := (page - 1) * limit
+	invalidateCache(cacheNamespaceUsers, cacheNamespaceOrderHistories)
+	evictCachedEntity(cacheNamespaceUsers, user_id)
+	return nil
+}
 
+func GetOrderItemList(actor Actor, page int, limit int) ([]OrdersItem, error) {
 	order_item := []OrdersItem{}
-	if err := db.Offset(offset).Limit(limit).Order("id DESC").Find(&order_item).Error; err != nil {
+	err := cacheAside(actor, cacheQuery{
+		Namespace: cacheNamespaceOrderItems,
+		Name:      "order_item_list",
+		Params:    map[string]interface{}{"page": page, "limit": limit},
+	}, &order_item, func() (interface{}, error) {
+		db := cacheFillDB()
+		offset := (page - 1) * limit
+
+		order_item := []OrdersItem{}
+		if err := db.Offset(offset).Limit(limit).Order("id DESC").Find(&order_item).Error; err != nil {
+			return nil, err
+		}
+		return order_item, nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	cacheValue, err := json.Marshal(order_item)
-	if err != nil {
-		log.Printf("Failed to marshal order_item data for caching: %v", err)
-	}
-	cacheTTL := 1 * time.Minute
-	err = rdb.Client.Set(context.Background(), cacheKey, cacheValue, cacheTTL).Err()
+	return order_item, nil
+}
+
+// CountOrderItems is the number of order items GetOrderItemList pages through.
+func CountOrderItems(actor Actor) (int, error) {
+	total := 0
+	err := cacheAside(actor, cacheQuery{
+		Namespace: cacheNamespaceOrderItems,
+		Name:      "order_item_count",
+	}, &total, func() (interface{}, error) {
+		total := 0
+		if err := cacheFillDB().Model(&OrdersItem{}).Count(&total).Error; err != nil {
+			return nil, err
+		}
+		return total, nil
+	})
 	if err != nil {
-		log.Printf("Failed to store order_item data in cache: %v", err)
+		return 0, err
 	}
 
-	return order_item, nil
+	return total, nil
 }
 
-func GetOrderItemByID(orderItemID int) (*OrdersItem, error) {
-	db := storage.GetDBInstance()
+func GetOrderItemByID(actor Actor, orderItemID int) (*OrdersItem, error) {
 	order_item := &OrdersItem{}
-	if err := db.Where("id=?", orderItemID).First(order_item).Error; err != nil {
-		return nil, err
+	err := cacheEntity(cacheNamespaceOrderItems, orderItemID, order_item, func() (interface{}, error) {
+		db := cacheFillDB()
+		order_item := &OrdersItem{}
+		if err := db.Where("id=?", orderItemID).First(order_item).Error; err != nil {
+			return nil, err
+		}
+		return order_item, nil
+	})
+	if err != nil {
+		return nil, dbError("order_item", err)
 	}
 
 	return order_item, nil
 }
 
-func PostNewOrderItem(orderItemPayload InsertOrderItemPayload) (int, error) {
-	db := storage.GetDBInstance()
+func PostNewOrderItem(actor Actor, orderItemPayload InsertOrderItemPayload) (int, error) {
+	if err := Validate(orderItemPayload); err != nil {
+		return 0, err
+	}
 
 	order_item := &OrdersItem{
 		Name:      orderItemPayload.Name,
@@ -216,45 +332,88 @@ func PostNewOrderItem(orderItemPayload InsertOrderItemPayload) (int, error) {
 		CreatedAt: time.Now(),
 	}
 
-	if err := db.Create(order_item).Error; err != nil {
+	err := runInTransaction(actor, func(tx *gorm.DB) error {
+		if err := tx.Create(order_item).Error; err != nil {
+			return dbError("order_item", err)
+		}
+		return recordAudit(tx, actor, AuditCreate, AuditEntityOrderItem, order_item.ID, nil, order_item)
+	})
+	if err != nil {
 		return 0, err
 	}
+
+	invalidateCache(cacheNamespaceOrderItems)
+	evictCachedEntity(cacheNamespaceOrderItems, order_item.ID)
 	return order_item.ID, nil
 }
 
-func UpdateOrderItemByID(orderItemPayload UpdateOrderItemPayload) error {
-	db := storage.GetDBInstance()
-	order_item := &OrdersItem{}
+func UpdateOrderItemByID(actor Actor, orderItemPayload UpdateOrderItemPayload) error {
+	if err := Validate(orderItemPayload); err != nil {
+		return err
+	}
 
-	if err := db.Model(order_item).Where("id = ?", orderItemPayload.ID).UpdateColumns(
-		map[string]interface{}{
-			"name":       orderItemPayload.Name,
-			"price":      orderItemPayload.Price,
-			"expired_at": orderItemPayload.ExpiredAt,
-			"updated_at": &NullableTime{
-				Time:  time.Now(),
-				Valid: true,
+	err := runInTransaction(actor, func(tx *gorm.DB) error {
+		before := &OrdersItem{}
+		if err := tx.Where("id = ?", orderItemPayload.ID).First(before).Error; err != nil {
+			return dbError("order_item", err)
+		}
+
+		if err := tx.Model(&OrdersItem{}).Where("id = ?", orderItemPayload.ID).UpdateColumns(
+			map[string]interface{}{
+				"name":       orderItemPayload.Name,
+				"price":      orderItemPayload.Price,
+				"expired_at": orderItemPayload.ExpiredAt,
+				"updated_at": &NullableTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
 			},
-		},
-	).Error; err != nil {
+		).Error; err != nil {
+			return err
+		}
+
+		after := &OrdersItem{}
+		if err := tx.Where("id = ?", orderItemPayload.ID).First(after).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(tx, actor, AuditUpdate, AuditEntityOrderItem, orderItemPayload.ID, before, after)
+	})
+	if err != nil {
 		return err
 	}
+
+	invalidateCache(cacheNamespaceOrderItems)
+	evictCachedEntity(cacheNamespaceOrderItems, orderItemPayload.ID)
 	return nil
 }
 
-func DeleteOrderItemByID(orderItemID int) error {
-	db := storage.GetDBInstance()
-	order_item := &OrdersItem{}
+func DeleteOrderItemByID(actor Actor, orderItemID int) error {
+	err := runInTransaction(actor, func(tx *gorm.DB) error {
+		order_item := &OrdersItem{}
+		if err := tx.Where("id = ?", orderItemID).First(order_item).Error; err != nil {
+			return dbError("order_item", err)
+		}
 
-	if err := db.Model(order_item).Where("id = ?", orderItemID).Delete(order_item).Error; err != nil {
+		if err := tx.Model(order_item).Where("id = ?", orderItemID).Delete(order_item).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(tx, actor, AuditDelete, AuditEntityOrderItem, orderItemID, order_item, nil)
+	})
+	if err != nil {
 		return err
 	}
 
+	invalidateCache(cacheNamespaceOrderItems, cacheNamespaceOrderHistories)
+	evictCachedEntity(cacheNamespaceOrderItems, orderItemID)
 	return nil
 }
 
-func PostAnOrderHistory(orderHistoryPayload InsertOrderHistoryPayload) (int, error) {
-	db := storage.GetDBInstance()
+func PostAnOrderHistory(actor Actor, orderHistoryPayload InsertOrderHistoryPayload) (int, error) {
+	if err := Validate(orderHistoryPayload); err != nil {
+		return 0, err
+	}
 
 	order_histories := &OrdersHistories{
 		UserId:       orderHistoryPayload.UserId,
@@ -263,98 +422,176 @@ func PostAnOrderHistory(orderHistoryPayload InsertOrderHistoryPayload) (int, err
 		CreatedAt:    time.Now(),
 	}
 
-	if err := db.Create(order_histories).Error; err != nil {
+	err := runInTransaction(actor, func(tx *gorm.DB) error {
+		if err := tx.Create(order_histories).Error; err != nil {
+			return dbError("order_history", err)
+		}
+		return recordAudit(tx, actor, AuditCreate, AuditEntityOrderHistory, order_histories.ID, nil, order_histories)
+	})
+	if err != nil {
 		return 0, err
 	}
+
+	invalidateCache(cacheNamespaceOrderHistories)
 	return order_histories.ID, nil
 }
 
-func RemoveAnOrderHistory(orderHistoryID int) error {
-	db := storage.GetDBInstance()
-	order_history := &OrdersHistories{}
+// BuyOrderItem records a user buying an order item, the first one they buy
+// becomes their first order.
+func BuyOrderItem(actor Actor, userID int, orderItemID int, descriptions *string) (*Users, *OrdersItem, int, error) {
+	user, err := GetUserByID(actor, userID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
 
-	if err := db.Model(order_history).Where("id = ?", orderHistoryID).Delete(order_history).Error; err != nil {
-		return err
+	orderItem, err := GetOrderItemByID(actor, orderItemID)
+	if err != nil {
+		return nil, nil, 0, err
 	}
 
-	return nil
-}
+	if user.FirstOrderId == nil {
+		err = UpdateAUserByID(actor, UpdateUserPayload{
+			ID:           userID,
+			FirstOrderId: &orderItem.ID,
+		})
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
 
-func GetOrderHistoriesByUserID(rdb *config.Database, page int, limit int, idRaw string) ([]OrdersHistories, error) {
-	id, err := strconv.Atoi(idRaw)
+	orderHistoryID, err := PostAnOrderHistory(actor, InsertOrderHistoryPayload{
+		UserId:       userID,
+		OrderItemId:  orderItemID,
+		Descriptions: descriptions,
+	})
 	if err != nil {
-		return nil, err
+		return nil, nil, 0, err
 	}
 
-	cacheKey := fmt.Sprintf("order_histories:%d:%d", page, limit)
-	cachedData, err := rdb.Client.Get(context.Background(), cacheKey).Result()
-	if err == nil {
-		var order_histories []OrdersHistories
+	return user, orderItem, orderHistoryID, nil
+}
 
-		err = json.Unmarshal([]byte(cachedData), &order_histories)
-		if err != nil {
-			log.Printf("Failed to unmarshal cached order_histories data: %v", err)
+func RemoveAnOrderHistory(actor Actor, orderHistoryID int) error {
+	err := runInTransaction(actor, func(tx *gorm.DB) error {
+		order_history := &OrdersHistories{}
+		if err := tx.Where("id = ?", orderHistoryID).First(order_history).Error; err != nil {
+			return dbError("order_history", err)
 		}
-		return order_histories, nil
 
-	} else if err != redis.Nil {
-		log.Printf("Failed to get cached order_histories data: %v", err)
+		if err := tx.Model(order_history).Where("id = ?", orderHistoryID).Delete(order_history).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(tx, actor, AuditDelete, AuditEntityOrderHistory, orderHistoryID, order_history, nil)
+	})
+	if err != nil {
+		return err
 	}
 
-	db := storage.GetDBInstance()
-	offset := (page - 1) * limit
+	invalidateCache(cacheNamespaceOrderHistories)
+	return nil
+}
 
-	order_histories := []OrdersHistories{}
-	if err := db.Where("user_id = ?", id).Offset(offset).Limit(limit).Order("id DESC").Find(&order_histories).Error; err != nil {
+func GetOrderHistoriesByUserID(actor Actor, page int, limit int, idRaw string) ([]OrdersHistories, error) {
+	id, err := strconv.Atoi(idRaw)
+	if err != nil {
 		return nil, err
 	}
 
-	cacheValue, err := json.Marshal(order_histories)
-	if err != nil {
-		log.Printf("Failed to marshal order_histories data for caching: %v", err)
-	}
-	cacheTTL := 1 * time.Minute
-	err = rdb.Client.Set(context.Background(), cacheKey, cacheValue, cacheTTL).Err()
+	order_histories := []OrdersHistories{}
+	err = cacheAside(actor, cacheQuery{
+		Namespace: cacheNamespaceOrderHistories,
+		Name:      "user_order_histories",
+		Params:    map[string]interface{}{"user_id": id, "page": page, "limit": limit},
+	}, &order_histories, func() (interface{}, error) {
+		db := cacheFillDB()
+		offset := (page - 1) * limit
+
+		order_histories := []OrdersHistories{}
+		if err := db.Where("user_id = ?", id).Offset(offset).Limit(limit).Order("id DESC").Find(&order_histories).Error; err != nil {
+			return nil, err
+		}
+		return order_histories, nil
+	})
 	if err != nil {
-		log.Printf("Failed to store order_histories data in cache: %v", err)
+		return nil, err
 	}
 
 	return order_histories, nil
 }
 
-func GetAllOrderHistories(rdb *config.Database, page int, limit int) ([]OrdersHistories, error) {
-	cacheKey := fmt.Sprintf("order_histories:%d:%d", page, limit)
-	cachedData, err := rdb.Client.Get(context.Background(), cacheKey).Result()
-	if err == nil {
-		var order_histories []OrdersHistories
-
-		err = json.Unmarshal([]byte(cachedData), &order_histories)
-		if err != nil {
-			log.Printf("Failed to unmarshal cached order_histories data: %v", err)
+func GetAllOrderHistories(actor Actor, page int, limit int) ([]OrdersHistories, error) {
+	order_histories := []OrdersHistories{}
+	err := cacheAside(actor, cacheQuery{
+		Namespace: cacheNamespaceOrderHistories,
+		Name:      "order_histories_list",
+		Params:    map[string]interface{}{"page": page, "limit": limit},
+	}, &order_histories, func() (interface{}, error) {
+		db := cacheFillDB()
+		offset := (page - 1) * limit
+
+		order_histories := []OrdersHistories{}
+		if err := db.Offset(offset).Limit(limit).Order("id DESC").Find(&order_histories).Error; err != nil {
+			return nil, err
 		}
 		return order_histories, nil
-
-	} else if err != redis.Nil {
-		log.Printf("Failed to get cached order_histories data: %v", err)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	db := storage.GetDBInstance()
-	offset := (page - 1) * limit
+	return order_histories, nil
+}
+
+// GetOrderHistoriesBefore returns up to limit order histories with an id below
+// beforeID, newest first, of the user with userID or of everyone's when userID
+// is nil. A beforeID of 0 starts from the newest. It is meant for walking the
+// whole list, so it seeks by id instead of using an offset and isn't cached.
+func GetOrderHistoriesBefore(actor Actor, userID *int, beforeID int, limit int) ([]OrdersHistories, error) {
+	query := readDB(actor)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
 
 	order_histories := []OrdersHistories{}
-	if err := db.Offset(offset).Limit(limit).Order("id DESC").Find(&order_histories).Error; err != nil {
+	if err := query.Order("id DESC").Limit(limit).Find(&order_histories).Error; err != nil {
 		return nil, err
 	}
 
-	cacheValue, err := json.Marshal(order_histories)
-	if err != nil {
-		log.Printf("Failed to marshal order_histories data for caching: %v", err)
-	}
-	cacheTTL := 1 * time.Minute
-	err = rdb.Client.Set(context.Background(), cacheKey, cacheValue, cacheTTL).Err()
+	return order_histories, nil
+}
+
+// CountOrderHistories is the number of order histories of the user with
+// userID, or everyone's when userID is nil.
+func CountOrderHistories(actor Actor, userID *int) (int, error) {
+	params := map[string]interface{}{}
+	if userID != nil {
+		params["user_id"] = *userID
+	}
+
+	total := 0
+	err := cacheAside(actor, cacheQuery{
+		Namespace: cacheNamespaceOrderHistories,
+		Name:      "order_history_count",
+		Params:    params,
+	}, &total, func() (interface{}, error) {
+		query := cacheFillDB().Model(&OrdersHistories{})
+		if userID != nil {
+			query = query.Where("user_id = ?", *userID)
+		}
+
+		total := 0
+		if err := query.Count(&total).Error; err != nil {
+			return nil, err
+		}
+		return total, nil
+	})
 	if err != nil {
-		log.Printf("Failed to store order_histories data in cache: %v", err)
+		return 0, err
 	}
 
-	return order_histories, nil
+	return total, nil
 }
@@ -3,33 +3,33 @@ package data
 import "time"
 
 type InsertUserPayload struct {
-	Username string `gorm:"size:255;not null;unique" json:"username"`
-	Fullname string `gorm:"size:255;not null" json:"fullname"`
-	Password string `json:"password"`
+	Username string `gorm:"size:255;not null;unique" json:"username" validate:"required,min=3,max=64,pattern=^[A-Za-z0-9._-]+$"`
+	Fullname string `gorm:"size:255;not null" json:"fullname" validate:"required,max=255"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
 }
 
 type UpdateUserPayload struct {
 	ID           int     `json:"id"`
-	Fullname     *string `gorm:"size:255;not null" json:"fullname"`
-	FirstOrderId *int    `json:"first_order_id,omitempty"`
+	Fullname     *string `gorm:"size:255;not null" json:"fullname" validate:"min=1,max=255"`
+	FirstOrderId *int    `json:"first_order_id,omitempty" validate:"min=1"`
 }
 
 type InsertOrderItemPayload struct {
-	Name      string    `gorm:"size:255;not null;unique" json:"name"`
-	Price     int       `json:"price"`
-	ExpiredAt time.Time `json:"expired_at,omitempty"`
+	Name      string    `gorm:"size:255;not null;unique" json:"name" validate:"required,max=255"`
+	Price     int       `json:"price" validate:"required,min=1"`
+	ExpiredAt time.Time `json:"expired_at,omitempty" validate:"required,future"`
 }
 
 type UpdateOrderItemPayload struct {
 	ID        int       `json:"id"`
-	Name      string    `gorm:"size:255;not null;unique" json:"name"`
-	Price     int       `json:"price"`
-	ExpiredAt time.Time `json:"expired_at,omitempty"`
+	Name      string    `gorm:"size:255;not null;unique" json:"name" validate:"required,max=255"`
+	Price     int       `json:"price" validate:"required,min=1"`
+	ExpiredAt time.Time `json:"expired_at,omitempty" validate:"required,future"`
 }
 
 type SigninPayload struct {
-	Username string `gorm:"size:255;not null;unique" json:"username"`
-	Password string `gorm:"size:255" json:"password"`
+	Username string `gorm:"size:255;not null;unique" json:"username" validate:"required"`
+	Password string `gorm:"size:255" json:"password" validate:"required"`
 }
 
 type JWTTokenPayload struct {
@@ -39,7 +39,105 @@ type JWTTokenPayload struct {
 }
 
 type InsertOrderHistoryPayload struct {
-	UserId       int     `json:"user_id"`
-	OrderItemId  int     `json:"order_item_id"`
-	Descriptions *string `json:"descriptions,omitempty"`
+	UserId       int     `json:"user_id" validate:"required"`
+	OrderItemId  int     `json:"order_item_id" validate:"required,min=1"`
+	Descriptions *string `json:"descriptions,omitempty" validate:"max=1000"`
+}
+
+type ImportOrderItemsOptions struct {
+	Format string `json:"format"`
+	DryRun bool   `json:"dry_run"`
+	Upsert bool   `json:"upsert"`
+}
+
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type ImportReport struct {
+	DryRun   bool             `json:"dry_run"`
+	Applied  bool             `json:"applied"`
+	Total    int              `json:"total"`
+	Valid    int              `json:"valid"`
+	Inserted int              `json:"inserted"`
+	Updated  int              `json:"updated"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+type ExportFilter struct {
+	UserID *int `json:"user_id,omitempty"`
+	Page   int  `json:"page,omitempty"`
+	Limit  int  `json:"limit,omitempty"`
+}
+
+type ExportJob struct {
+	ID         string     `json:"id"`
+	Entity     string     `json:"entity"`
+	Format     string     `json:"format"`
+	Status     string     `json:"status"`
+	FileName   string     `json:"file_name"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Actor is who a data mutation is made on behalf of, it ends up in the audit log.
+type Actor struct {
+	ID        *int      `json:"id,omitempty"`
+	Type      ActorType `json:"type"`
+	Role      UserRole  `json:"role,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+}
+
+type AuditLogFilter struct {
+	ActorID    *int        `json:"actor_id,omitempty"`
+	EntityType string      `json:"entity_type,omitempty"`
+	EntityID   *int        `json:"entity_id,omitempty"`
+	Action     AuditAction `json:"action,omitempty"`
+	From       *time.Time  `json:"from,omitempty"`
+	To         *time.Time  `json:"to,omitempty" validate:"gtefield=From"`
+}
+
+// UserDataProfile is the part of Users handed out in a personal data export,
+// the password hash is left out on purpose.
+type UserDataProfile struct {
+	ID           int           `json:"id"`
+	Username     string        `json:"username"`
+	Fullname     string        `json:"fullname"`
+	FirstOrderId *int          `json:"first_order_id,omitempty"`
+	Role         UserRole      `json:"role"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    *NullableTime `json:"updated_at,omitempty"`
+	DeletedAt    *NullableTime `json:"deleted_at,omitempty"`
+}
+
+type UserDataBundle struct {
+	GeneratedAt     time.Time         `json:"generated_at"`
+	Profile         UserDataProfile   `json:"profile"`
+	OrdersHistories []OrdersHistories `json:"orders_histories"`
+	AuditLog        []AuditLog        `json:"audit_log"`
+	Sessions        []AuditLog        `json:"sessions"`
+}
+
+type InsertErasureRequestPayload struct {
+	UserId int    `json:"user_id" validate:"required"`
+	Reason string `json:"reason" validate:"max=1000"`
+}
+
+type ArchivedOrderHistoryFilter struct {
+	UserID *int       `json:"user_id,omitempty"`
+	From   *time.Time `json:"from,omitempty"`
+	To     *time.Time `json:"to,omitempty" validate:"gtefield=From"`
+}
+
+// CacheStats counts how cached reads were served: from the in-process cache,
+// from Redis or, on a miss, from the database. Not found rows cached for
+// entity lookups count as hits.
+type CacheStats struct {
+	LocalHits int64 `json:"local_hits"`
+	RedisHits int64 `json:"redis_hits"`
+	Misses    int64 `json:"misses"`
 }
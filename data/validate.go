@@ -0,0 +1,238 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Payloads declare their rules in a validate tag, separated by commas:
+//
+//	required      the field can't be missing, zero or blank
+//	min=N, max=N  bounds of a number, or of the length of a string
+//	pattern=RE    a string has to match RE, which can't contain a comma
+//	future        a time has to be after now
+//	gtfield=F     has to be after, or greater than, the field F
+//	gtefield=F    same as gtfield but equal is fine too
+//
+// Fields that aren't required are only checked when they are set.
+
+// ValidationRule is one rule from a validate tag, Param is what follows "=".
+type ValidationRule struct {
+	Name  string
+	Param string
+}
+
+// FieldRules are the rules of one field, for describing a payload in the API
+// schema.
+type FieldRules struct {
+	Field  string
+	GoName string
+	Rules  []ValidationRule
+}
+
+// Validate checks v, a struct or a pointer to one, and returns a Validation
+// error listing every field that breaks a rule.
+func Validate(v interface{}) error {
+	fieldErrors := validateFields(v)
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+
+	err := Validation("validation_failed", "request has invalid fields")
+	err.Fields = fieldErrors
+	return err
+}
+
+// PayloadRules returns the rules of every field of v's type that has any.
+func PayloadRules(v interface{}) []FieldRules {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	rules := []FieldRules{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		rules = append(rules, FieldRules{Field: jsonFieldName(field), GoName: field.Name, Rules: parseValidationTag(tag)})
+	}
+	return rules
+}
+
+func validateFields(v interface{}) []FieldError {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+
+	fieldErrors := []FieldError{}
+	for _, field := range PayloadRules(v) {
+		fieldValue, set := fieldValueOf(value.FieldByName(field.GoName))
+
+		for _, rule := range field.Rules {
+			if rule.Name != "required" && !set {
+				continue
+			}
+
+			if message := checkRule(value, field.Field, fieldValue, set, rule); message != "" {
+				fieldErrors = append(fieldErrors, FieldError{Field: field.Field, Rule: rule.Name, Message: message})
+				// One reason per field is enough.
+				break
+			}
+		}
+	}
+	return fieldErrors
+}
+
+func checkRule(parent reflect.Value, name string, value reflect.Value, set bool, rule ValidationRule) string {
+	switch rule.Name {
+	case "required":
+		if !set {
+			return name + " is required"
+		}
+	case "min", "max":
+		limit, err := strconv.ParseFloat(rule.Param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: %s of %s isn't a number", rule.Name, name))
+		}
+
+		size, unit := fieldSize(value)
+		if limit == 1 {
+			unit = strings.TrimSuffix(unit, "s")
+		}
+		if rule.Name == "min" && size < limit {
+			return fmt.Sprintf("%s must be at least %s%s", name, rule.Param, unit)
+		}
+		if rule.Name == "max" && size > limit {
+			return fmt.Sprintf("%s must be at most %s%s", name, rule.Param, unit)
+		}
+	case "pattern":
+		if !validationPattern(rule.Param).MatchString(value.String()) {
+			return name + " must match " + rule.Param
+		}
+	case "future":
+		if t, ok := value.Interface().(time.Time); ok && !t.After(time.Now()) {
+			return name + " must be in the future"
+		}
+	case "gtfield", "gtefield":
+		other, ok := parent.Type().FieldByName(rule.Param)
+		if !ok {
+			panic(fmt.Sprintf("validate: %s of %s names an unknown field", rule.Name, name))
+		}
+		otherValue, otherSet := fieldValueOf(parent.FieldByName(rule.Param))
+		if !otherSet {
+			return ""
+		}
+
+		cmp := compareFields(value, otherValue)
+		if cmp < 0 || (cmp == 0 && rule.Name == "gtfield") {
+			if rule.Name == "gtfield" {
+				return name + " must be after " + jsonFieldName(other)
+			}
+			return name + " can't be before " + jsonFieldName(other)
+		}
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q on %s", rule.Name, name))
+	}
+
+	return ""
+}
+
+// fieldValueOf follows pointers and says whether the field is set: a pointer
+// that isn't nil, or a value that is neither zero nor a blank string.
+func fieldValueOf(value reflect.Value) (reflect.Value, bool) {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return value, false
+		}
+		return value.Elem(), true
+	}
+
+	if value.Kind() == reflect.String {
+		return value, strings.TrimSpace(value.String()) != ""
+	}
+	return value, !value.IsZero()
+}
+
+func fieldSize(value reflect.Value) (float64, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), ""
+	case reflect.Slice, reflect.Map:
+		return float64(value.Len()), " items"
+	}
+	panic(fmt.Sprintf("validate: min and max don't work on %s", value.Type()))
+}
+
+func compareFields(a reflect.Value, b reflect.Value) int {
+	if at, ok := a.Interface().(time.Time); ok {
+		bt := b.Interface().(time.Time)
+		switch {
+		case at.Before(bt):
+			return -1
+		case at.After(bt):
+			return 1
+		}
+		return 0
+	}
+
+	as, _ := fieldSize(a)
+	bs, _ := fieldSize(b)
+	switch {
+	case as < bs:
+		return -1
+	case as > bs:
+		return 1
+	}
+	return 0
+}
+
+var validationPatterns sync.Map
+
+func validationPattern(pattern string) *regexp.Regexp {
+	if re, ok := validationPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+
+	re := regexp.MustCompile(pattern)
+	validationPatterns.Store(pattern, re)
+	return re
+}
+
+func parseValidationTag(tag string) []ValidationRule {
+	rules := []ValidationRule{}
+	for _, part := range strings.Split(tag, ",") {
+		if part == "" {
+			continue
+		}
+		name, param := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, param = part[:i], part[i+1:]
+		}
+		rules = append(rules, ValidationRule{Name: name, Param: param})
+	}
+	return rules
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
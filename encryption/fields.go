@@ -0,0 +1,124 @@
+package encryption
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Field is a struct field tagged for encryption, e.g.
+//
+//	Username     string `json:"username" encrypted:"true" blind_index:"UsernameBidx"`
+//	UsernameBidx string `json:"-"`
+//
+// BlindIndex names the field that receives the blind index of the plaintext.
+type Field struct {
+	Name       string
+	JSONName   string
+	BlindIndex string
+}
+
+var fieldsCache sync.Map
+
+// TaggedFields returns the encrypted fields of the struct v points to.
+func TaggedFields(v interface{}) []Field {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	if cached, ok := fieldsCache.Load(t); ok {
+		return cached.([]Field)
+	}
+
+	var fields []Field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Tag.Get("encrypted") != "true" || sf.Type.Kind() != reflect.String {
+			continue
+		}
+
+		jsonName := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if jsonName == "" {
+			jsonName = sf.Name
+		}
+
+		fields = append(fields, Field{
+			Name:       sf.Name,
+			JSONName:   jsonName,
+			BlindIndex: sf.Tag.Get("blind_index"),
+		})
+	}
+
+	fieldsCache.Store(t, fields)
+	return fields
+}
+
+// EncryptFields encrypts every tagged field of the struct v points to with the
+// active key and fills their blind indexes. The fields hold plaintext, even
+// when it starts with "enc:". additionalData returns the AAD of each field.
+func EncryptFields(v interface{}, additionalData func(field Field) []byte) error {
+	kr, err := current()
+	if err != nil {
+		return err
+	}
+
+	rv, err := structValue(v)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range TaggedFields(v) {
+		fv := rv.FieldByName(field.Name)
+		plaintext := fv.String()
+
+		if field.BlindIndex != "" {
+			index := rv.FieldByName(field.BlindIndex)
+			if !index.IsValid() || index.Kind() != reflect.String {
+				return fmt.Errorf("%s: blind index field %s must be a string", field.Name, field.BlindIndex)
+			}
+			index.SetString(kr.BlindIndex(plaintext))
+		}
+
+		ciphertext, err := kr.Encrypt(plaintext, additionalData(field))
+		if err != nil {
+			return fmt.Errorf("%s: %v", field.Name, err)
+		}
+		fv.SetString(ciphertext)
+	}
+
+	return nil
+}
+
+// DecryptFields decrypts every tagged field of the struct v points to, with
+// the AAD they were encrypted with.
+func DecryptFields(v interface{}, additionalData func(field Field) []byte) error {
+	rv, err := structValue(v)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range TaggedFields(v) {
+		fv := rv.FieldByName(field.Name)
+
+		plaintext, err := Decrypt(fv.String(), additionalData(field))
+		if err != nil {
+			return fmt.Errorf("%s: %v", field.Name, err)
+		}
+		fv.SetString(plaintext)
+	}
+
+	return nil
+}
+
+func structValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("expected a pointer to a struct, got %T", v)
+	}
+	return rv.Elem(), nil
+}
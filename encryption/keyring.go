@@ -0,0 +1,285 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	keySize = 32
+	prefix  = "enc:"
+)
+
+var (
+	ErrNoKeyring     = errors.New("encryption keyring is not loaded")
+	ErrUnknownKey    = errors.New("value was encrypted with a key that is not in the keyring")
+	ErrMalformedData = errors.New("malformed encrypted value")
+)
+
+// Keyfile is the on-disk format of the master keys. Every key is base64 encoded
+// and 32 bytes long. Rotating means adding a key and making it Active, older
+// keys have to stay until every value encrypted with them has been rewritten.
+type Keyfile struct {
+	Active        string            `json:"active"`
+	Keys          map[string]string `json:"keys"`
+	BlindIndexKey string            `json:"blind_index_key"`
+}
+
+type Keyring struct {
+	active        string
+	masterKeys    map[string][]byte
+	blindIndexKey []byte
+}
+
+var (
+	keyring   *Keyring
+	keyringMu sync.RWMutex
+)
+
+// LoadKeyfile reads the keyfile at path and makes it the keyring used by the
+// package level functions.
+func LoadKeyfile(path string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var keyfile Keyfile
+	if err := json.Unmarshal(raw, &keyfile); err != nil {
+		return fmt.Errorf("invalid keyfile: %v", err)
+	}
+
+	kr, err := NewKeyring(keyfile)
+	if err != nil {
+		return err
+	}
+
+	keyringMu.Lock()
+	keyring = kr
+	keyringMu.Unlock()
+
+	return nil
+}
+
+func NewKeyring(keyfile Keyfile) (*Keyring, error) {
+	kr := &Keyring{active: keyfile.Active, masterKeys: map[string][]byte{}}
+
+	for id, encoded := range keyfile.Keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", id, err)
+		}
+		kr.masterKeys[id] = key
+	}
+
+	if _, ok := kr.masterKeys[kr.active]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the keyfile", kr.active)
+	}
+
+	blindIndexKey, err := decodeKey(keyfile.BlindIndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("blind index key: %v", err)
+	}
+	kr.blindIndexKey = blindIndexKey
+
+	return kr, nil
+}
+
+// GenerateKey returns a new random base64 encoded key for a keyfile.
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+func current() (*Keyring, error) {
+	keyringMu.RLock()
+	defer keyringMu.RUnlock()
+
+	if keyring == nil {
+		return nil, ErrNoKeyring
+	}
+	return keyring, nil
+}
+
+// Encrypt seals plaintext with a fresh data key, which is itself sealed with
+// the active master key. The result looks like
+// "enc:<key id>:<wrapped data key>:<sealed value>". additionalData, see AAD,
+// has to be given again to Decrypt, so the value can't be moved elsewhere.
+func (kr *Keyring) Encrypt(plaintext string, additionalData []byte) (string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := seal(kr.masterKeys[kr.active], dataKey, []byte(kr.active))
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(dataKey, []byte(plaintext), additionalData)
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + kr.active + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value returned by Encrypt with the same additionalData.
+// Values without the "enc:" prefix were written before encryption was enabled
+// and are returned unchanged.
+func (kr *Keyring) Decrypt(value string, additionalData []byte) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformedData
+	}
+
+	masterKey, ok := kr.masterKeys[parts[0]]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformedData
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformedData
+	}
+
+	dataKey, err := open(masterKey, wrappedKey, []byte(parts[0]))
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(dataKey, sealed, additionalData)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether value is plaintext or was encrypted with a key
+// that is no longer the active one.
+func (kr *Keyring) NeedsRotation(value string) bool {
+	return !strings.HasPrefix(value, prefix+kr.active+":")
+}
+
+// BlindIndex returns a keyed hash of value, so equality lookups can be done on
+// a column without storing the value itself.
+func (kr *Keyring) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, kr.blindIndexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// AAD is the additional data of a value stored in column of the row id of
+// table.
+func AAD(table string, column string, id int) []byte {
+	return []byte(table + "." + column + ":" + strconv.Itoa(id))
+}
+
+func Encrypt(plaintext string, additionalData []byte) (string, error) {
+	kr, err := current()
+	if err != nil {
+		return "", err
+	}
+	return kr.Encrypt(plaintext, additionalData)
+}
+
+func Decrypt(value string, additionalData []byte) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	kr, err := current()
+	if err != nil {
+		return "", err
+	}
+	return kr.Decrypt(value, additionalData)
+}
+
+func BlindIndex(value string) (string, error) {
+	kr, err := current()
+	if err != nil {
+		return "", err
+	}
+	return kr.BlindIndex(value), nil
+}
+
+func seal(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key []byte, sealed []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformedData
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,6 @@
+// Package grpcapi is the protobuf schema of the gRPC API and of the
+// application/x-protobuf answers of the REST API, and its generated code. The
+// server lives in cmd/api.
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative saham.proto
@@ -0,0 +1,666 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: saham.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Saham_Signin_FullMethodName             = "/saham.v1.Saham/Signin"
+	Saham_ListUsers_FullMethodName          = "/saham.v1.Saham/ListUsers"
+	Saham_GetUser_FullMethodName            = "/saham.v1.Saham/GetUser"
+	Saham_CreateUser_FullMethodName         = "/saham.v1.Saham/CreateUser"
+	Saham_UpdateUser_FullMethodName         = "/saham.v1.Saham/UpdateUser"
+	Saham_DeleteUser_FullMethodName         = "/saham.v1.Saham/DeleteUser"
+	Saham_ListOrderItems_FullMethodName     = "/saham.v1.Saham/ListOrderItems"
+	Saham_GetOrderItem_FullMethodName       = "/saham.v1.Saham/GetOrderItem"
+	Saham_CreateOrderItem_FullMethodName    = "/saham.v1.Saham/CreateOrderItem"
+	Saham_UpdateOrderItem_FullMethodName    = "/saham.v1.Saham/UpdateOrderItem"
+	Saham_DeleteOrderItem_FullMethodName    = "/saham.v1.Saham/DeleteOrderItem"
+	Saham_Purchase_FullMethodName           = "/saham.v1.Saham/Purchase"
+	Saham_ListOrders_FullMethodName         = "/saham.v1.Saham/ListOrders"
+	Saham_ListOrderHistories_FullMethodName = "/saham.v1.Saham/ListOrderHistories"
+)
+
+// SahamClient is the client API for Saham service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SahamClient interface {
+	Signin(ctx context.Context, in *SigninRequest, opts ...grpc.CallOption) (*SigninResponse, error)
+	// Admins only.
+	ListUsers(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListUsersResponse, error)
+	GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*User, error)
+	// Admins only, the generated password is only ever returned here.
+	CreateUser(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*CreateUserResponse, error)
+	UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*User, error)
+	// Admins only.
+	DeleteUser(ctx context.Context, in *DeleteUserRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	ListOrderItems(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListOrderItemsResponse, error)
+	GetOrderItem(ctx context.Context, in *GetOrderItemRequest, opts ...grpc.CallOption) (*OrderItem, error)
+	// Admins only.
+	CreateOrderItem(ctx context.Context, in *CreateOrderItemRequest, opts ...grpc.CallOption) (*OrderItem, error)
+	// Admins only.
+	UpdateOrderItem(ctx context.Context, in *UpdateOrderItemRequest, opts ...grpc.CallOption) (*OrderItem, error)
+	// Admins only.
+	DeleteOrderItem(ctx context.Context, in *DeleteOrderItemRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Buys an order item for the signed in user.
+	Purchase(ctx context.Context, in *PurchaseRequest, opts ...grpc.CallOption) (*PurchaseResponse, error)
+	// Streams the signed in user's orders, newest first.
+	ListOrders(ctx context.Context, in *StreamOrderHistoriesRequest, opts ...grpc.CallOption) (Saham_ListOrdersClient, error)
+	// Admins only, streams everyone's order histories, or one user's, newest
+	// first.
+	ListOrderHistories(ctx context.Context, in *StreamOrderHistoriesRequest, opts ...grpc.CallOption) (Saham_ListOrderHistoriesClient, error)
+}
+
+type sahamClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSahamClient(cc grpc.ClientConnInterface) SahamClient {
+	return &sahamClient{cc}
+}
+
+func (c *sahamClient) Signin(ctx context.Context, in *SigninRequest, opts ...grpc.CallOption) (*SigninResponse, error) {
+	out := new(SigninResponse)
+	err := c.cc.Invoke(ctx, Saham_Signin_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sahamClient) ListUsers(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListUsersResponse, error) {
+	out := new(ListUsersResponse)
+	err := c.cc.Invoke(ctx, Saham_ListUsers_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sahamClient) GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, Saham_GetUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sahamClient) CreateUser(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*CreateUserResponse, error) {
+	out := new(CreateUserResponse)
+	err := c.cc.Invoke(ctx, Saham_CreateUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sahamClient) UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, Saham_UpdateUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sahamClient) DeleteUser(ctx context.Context, in *DeleteUserRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Saham_DeleteUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sahamClient) ListOrderItems(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListOrderItemsResponse, error) {
+	out := new(ListOrderItemsResponse)
+	err := c.cc.Invoke(ctx, Saham_ListOrderItems_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sahamClient) GetOrderItem(ctx context.Context, in *GetOrderItemRequest, opts ...grpc.CallOption) (*OrderItem, error) {
+	out := new(OrderItem)
+	err := c.cc.Invoke(ctx, Saham_GetOrderItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sahamClient) CreateOrderItem(ctx context.Context, in *CreateOrderItemRequest, opts ...grpc.CallOption) (*OrderItem, error) {
+	out := new(OrderItem)
+	err := c.cc.Invoke(ctx, Saham_CreateOrderItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sahamClient) UpdateOrderItem(ctx context.Context, in *UpdateOrderItemRequest, opts ...grpc.CallOption) (*OrderItem, error) {
+	out := new(OrderItem)
+	err := c.cc.Invoke(ctx, Saham_UpdateOrderItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sahamClient) DeleteOrderItem(ctx context.Context, in *DeleteOrderItemRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Saham_DeleteOrderItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sahamClient) Purchase(ctx context.Context, in *PurchaseRequest, opts ...grpc.CallOption) (*PurchaseResponse, error) {
+	out := new(PurchaseResponse)
+	err := c.cc.Invoke(ctx, Saham_Purchase_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sahamClient) ListOrders(ctx context.Context, in *StreamOrderHistoriesRequest, opts ...grpc.CallOption) (Saham_ListOrdersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Saham_ServiceDesc.Streams[0], Saham_ListOrders_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &sahamListOrdersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Saham_ListOrdersClient interface {
+	Recv() (*OrderHistory, error)
+	grpc.ClientStream
+}
+
+type sahamListOrdersClient struct {
+	grpc.ClientStream
+}
+
+func (x *sahamListOrdersClient) Recv() (*OrderHistory, error) {
+	m := new(OrderHistory)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *sahamClient) ListOrderHistories(ctx context.Context, in *StreamOrderHistoriesRequest, opts ...grpc.CallOption) (Saham_ListOrderHistoriesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Saham_ServiceDesc.Streams[1], Saham_ListOrderHistories_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &sahamListOrderHistoriesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Saham_ListOrderHistoriesClient interface {
+	Recv() (*OrderHistory, error)
+	grpc.ClientStream
+}
+
+type sahamListOrderHistoriesClient struct {
+	grpc.ClientStream
+}
+
+func (x *sahamListOrderHistoriesClient) Recv() (*OrderHistory, error) {
+	m := new(OrderHistory)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SahamServer is the server API for Saham service.
+// All implementations must embed UnimplementedSahamServer
+// for forward compatibility
+type SahamServer interface {
+	Signin(context.Context, *SigninRequest) (*SigninResponse, error)
+	// Admins only.
+	ListUsers(context.Context, *ListRequest) (*ListUsersResponse, error)
+	GetUser(context.Context, *GetUserRequest) (*User, error)
+	// Admins only, the generated password is only ever returned here.
+	CreateUser(context.Context, *CreateUserRequest) (*CreateUserResponse, error)
+	UpdateUser(context.Context, *UpdateUserRequest) (*User, error)
+	// Admins only.
+	DeleteUser(context.Context, *DeleteUserRequest) (*emptypb.Empty, error)
+	ListOrderItems(context.Context, *ListRequest) (*ListOrderItemsResponse, error)
+	GetOrderItem(context.Context, *GetOrderItemRequest) (*OrderItem, error)
+	// Admins only.
+	CreateOrderItem(context.Context, *CreateOrderItemRequest) (*OrderItem, error)
+	// Admins only.
+	UpdateOrderItem(context.Context, *UpdateOrderItemRequest) (*OrderItem, error)
+	// Admins only.
+	DeleteOrderItem(context.Context, *DeleteOrderItemRequest) (*emptypb.Empty, error)
+	// Buys an order item for the signed in user.
+	Purchase(context.Context, *PurchaseRequest) (*PurchaseResponse, error)
+	// Streams the signed in user's orders, newest first.
+	ListOrders(*StreamOrderHistoriesRequest, Saham_ListOrdersServer) error
+	// Admins only, streams everyone's order histories, or one user's, newest
+	// first.
+	ListOrderHistories(*StreamOrderHistoriesRequest, Saham_ListOrderHistoriesServer) error
+	mustEmbedUnimplementedSahamServer()
+}
+
+// UnimplementedSahamServer must be embedded to have forward compatible implementations.
+type UnimplementedSahamServer struct {
+}
+
+func (UnimplementedSahamServer) Signin(context.Context, *SigninRequest) (*SigninResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Signin not implemented")
+}
+func (UnimplementedSahamServer) ListUsers(context.Context, *ListRequest) (*ListUsersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUsers not implemented")
+}
+func (UnimplementedSahamServer) GetUser(context.Context, *GetUserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedSahamServer) CreateUser(context.Context, *CreateUserRequest) (*CreateUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateUser not implemented")
+}
+func (UnimplementedSahamServer) UpdateUser(context.Context, *UpdateUserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateUser not implemented")
+}
+func (UnimplementedSahamServer) DeleteUser(context.Context, *DeleteUserRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteUser not implemented")
+}
+func (UnimplementedSahamServer) ListOrderItems(context.Context, *ListRequest) (*ListOrderItemsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListOrderItems not implemented")
+}
+func (UnimplementedSahamServer) GetOrderItem(context.Context, *GetOrderItemRequest) (*OrderItem, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrderItem not implemented")
+}
+func (UnimplementedSahamServer) CreateOrderItem(context.Context, *CreateOrderItemRequest) (*OrderItem, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateOrderItem not implemented")
+}
+func (UnimplementedSahamServer) UpdateOrderItem(context.Context, *UpdateOrderItemRequest) (*OrderItem, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateOrderItem not implemented")
+}
+func (UnimplementedSahamServer) DeleteOrderItem(context.Context, *DeleteOrderItemRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteOrderItem not implemented")
+}
+func (UnimplementedSahamServer) Purchase(context.Context, *PurchaseRequest) (*PurchaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Purchase not implemented")
+}
+func (UnimplementedSahamServer) ListOrders(*StreamOrderHistoriesRequest, Saham_ListOrdersServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListOrders not implemented")
+}
+func (UnimplementedSahamServer) ListOrderHistories(*StreamOrderHistoriesRequest, Saham_ListOrderHistoriesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListOrderHistories not implemented")
+}
+func (UnimplementedSahamServer) mustEmbedUnimplementedSahamServer() {}
+
+// UnsafeSahamServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SahamServer will
+// result in compilation errors.
+type UnsafeSahamServer interface {
+	mustEmbedUnimplementedSahamServer()
+}
+
+func RegisterSahamServer(s grpc.ServiceRegistrar, srv SahamServer) {
+	s.RegisterService(&Saham_ServiceDesc, srv)
+}
+
+func _Saham_Signin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SigninRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SahamServer).Signin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Saham_Signin_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SahamServer).Signin(ctx, req.(*SigninRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Saham_ListUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SahamServer).ListUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Saham_ListUsers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SahamServer).ListUsers(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Saham_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SahamServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Saham_GetUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SahamServer).GetUser(ctx, req.(*GetUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Saham_CreateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SahamServer).CreateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Saham_CreateUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SahamServer).CreateUser(ctx, req.(*CreateUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Saham_UpdateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SahamServer).UpdateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Saham_UpdateUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SahamServer).UpdateUser(ctx, req.(*UpdateUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Saham_DeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SahamServer).DeleteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Saham_DeleteUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SahamServer).DeleteUser(ctx, req.(*DeleteUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Saham_ListOrderItems_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SahamServer).ListOrderItems(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Saham_ListOrderItems_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SahamServer).ListOrderItems(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Saham_GetOrderItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOrderItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SahamServer).GetOrderItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Saham_GetOrderItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SahamServer).GetOrderItem(ctx, req.(*GetOrderItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Saham_CreateOrderItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateOrderItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SahamServer).CreateOrderItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Saham_CreateOrderItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SahamServer).CreateOrderItem(ctx, req.(*CreateOrderItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Saham_UpdateOrderItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateOrderItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SahamServer).UpdateOrderItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Saham_UpdateOrderItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SahamServer).UpdateOrderItem(ctx, req.(*UpdateOrderItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Saham_DeleteOrderItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteOrderItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SahamServer).DeleteOrderItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Saham_DeleteOrderItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SahamServer).DeleteOrderItem(ctx, req.(*DeleteOrderItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Saham_Purchase_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurchaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SahamServer).Purchase(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Saham_Purchase_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SahamServer).Purchase(ctx, req.(*PurchaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Saham_ListOrders_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamOrderHistoriesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SahamServer).ListOrders(m, &sahamListOrdersServer{stream})
+}
+
+type Saham_ListOrdersServer interface {
+	Send(*OrderHistory) error
+	grpc.ServerStream
+}
+
+type sahamListOrdersServer struct {
+	grpc.ServerStream
+}
+
+func (x *sahamListOrdersServer) Send(m *OrderHistory) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Saham_ListOrderHistories_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamOrderHistoriesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SahamServer).ListOrderHistories(m, &sahamListOrderHistoriesServer{stream})
+}
+
+type Saham_ListOrderHistoriesServer interface {
+	Send(*OrderHistory) error
+	grpc.ServerStream
+}
+
+type sahamListOrderHistoriesServer struct {
+	grpc.ServerStream
+}
+
+func (x *sahamListOrderHistoriesServer) Send(m *OrderHistory) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Saham_ServiceDesc is the grpc.ServiceDesc for Saham service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Saham_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "saham.v1.Saham",
+	HandlerType: (*SahamServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Signin",
+			Handler:    _Saham_Signin_Handler,
+		},
+		{
+			MethodName: "ListUsers",
+			Handler:    _Saham_ListUsers_Handler,
+		},
+		{
+			MethodName: "GetUser",
+			Handler:    _Saham_GetUser_Handler,
+		},
+		{
+			MethodName: "CreateUser",
+			Handler:    _Saham_CreateUser_Handler,
+		},
+		{
+			MethodName: "UpdateUser",
+			Handler:    _Saham_UpdateUser_Handler,
+		},
+		{
+			MethodName: "DeleteUser",
+			Handler:    _Saham_DeleteUser_Handler,
+		},
+		{
+			MethodName: "ListOrderItems",
+			Handler:    _Saham_ListOrderItems_Handler,
+		},
+		{
+			MethodName: "GetOrderItem",
+			Handler:    _Saham_GetOrderItem_Handler,
+		},
+		{
+			MethodName: "CreateOrderItem",
+			Handler:    _Saham_CreateOrderItem_Handler,
+		},
+		{
+			MethodName: "UpdateOrderItem",
+			Handler:    _Saham_UpdateOrderItem_Handler,
+		},
+		{
+			MethodName: "DeleteOrderItem",
+			Handler:    _Saham_DeleteOrderItem_Handler,
+		},
+		{
+			MethodName: "Purchase",
+			Handler:    _Saham_Purchase_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListOrders",
+			Handler:       _Saham_ListOrders_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListOrderHistories",
+			Handler:       _Saham_ListOrderHistories_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "saham.proto",
+}
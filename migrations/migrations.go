@@ -0,0 +1,10 @@
+// Package migrations holds the SQL migrations applied by storage.Migrate, one
+// directory per database type, in file name order. Files are named
+// <version>_<description>.sql and must never change once they have been
+// applied somewhere.
+package migrations
+
+import "embed"
+
+//go:embed postgres/*.sql sqlite/*.sql
+var FS embed.FS
@@ -0,0 +1,74 @@
+-- Partitions orders_histories by month of created_at. Future partitions are
+-- created by ensure_orders_histories_partitions, which cmd/migrate and the API
+-- call regularly, and old ones are moved to the archive schema by the
+-- archival job.
+
+CREATE OR REPLACE FUNCTION ensure_orders_histories_partition(month DATE) RETURNS void AS $$
+DECLARE
+  start_at DATE := date_trunc('month', month)::date;
+  partition_name TEXT := 'orders_histories_' || to_char(start_at, 'YYYY_MM');
+BEGIN
+  IF to_regclass('public.' || partition_name) IS NULL
+     AND to_regclass('archive.' || partition_name) IS NULL THEN
+    EXECUTE format(
+      'CREATE TABLE public.%I PARTITION OF public.orders_histories FOR VALUES FROM (%L) TO (%L)',
+      partition_name, start_at, (start_at + INTERVAL '1 month')::date
+    );
+  END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION ensure_orders_histories_partitions(months_ahead INT) RETURNS void AS $$
+BEGIN
+  FOR i IN 0..months_ahead LOOP
+    PERFORM ensure_orders_histories_partition((date_trunc('month', now()) + make_interval(months => i))::date);
+  END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE orders_histories RENAME TO orders_histories_unpartitioned;
+ALTER TABLE orders_histories_unpartitioned RENAME CONSTRAINT orders_histories_pkey TO orders_histories_unpartitioned_pkey;
+
+-- The partition key has to be part of the primary key.
+CREATE TABLE orders_histories (
+  id INT NOT NULL DEFAULT nextval('orders_histories_id_seq'),
+  user_id INT NOT NULL,
+  order_item_id INT NOT NULL,
+  descriptions TEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP,
+  deleted_at TIMESTAMP,
+  PRIMARY KEY (id, created_at),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (order_item_id) REFERENCES orders_items(id) ON DELETE CASCADE
+) PARTITION BY RANGE (created_at);
+
+CREATE INDEX orders_histories_user_id_created_at_idx ON orders_histories (user_id, created_at);
+
+-- Catches rows outside every monthly partition, it should stay empty.
+CREATE TABLE orders_histories_default PARTITION OF orders_histories DEFAULT;
+
+SELECT ensure_orders_histories_partition(month::date)
+FROM (SELECT DISTINCT date_trunc('month', created_at) AS month FROM orders_histories_unpartitioned) AS months;
+
+SELECT ensure_orders_histories_partitions(3);
+
+INSERT INTO orders_histories (id, user_id, order_item_id, descriptions, created_at, updated_at, deleted_at)
+SELECT id, user_id, order_item_id, descriptions, created_at, updated_at, deleted_at
+FROM orders_histories_unpartitioned;
+
+ALTER SEQUENCE orders_histories_id_seq OWNED BY orders_histories.id;
+DROP TABLE orders_histories_unpartitioned;
+
+-- Archived partitions are attached here, so they stay queryable together.
+CREATE SCHEMA IF NOT EXISTS archive;
+
+CREATE TABLE archive.orders_histories (
+  id INT NOT NULL,
+  user_id INT NOT NULL,
+  order_item_id INT NOT NULL,
+  descriptions TEXT,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP,
+  deleted_at TIMESTAMP
+) PARTITION BY RANGE (created_at);
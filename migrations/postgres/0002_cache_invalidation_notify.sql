@@ -0,0 +1,23 @@
+-- Every change to a cached table sends the table name on the
+-- cache_invalidation channel, so each API process can evict what it cached
+-- from it. The triggers are per statement and Postgres folds identical
+-- notifications of a transaction into one.
+
+CREATE OR REPLACE FUNCTION notify_cache_invalidation() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('cache_invalidation', TG_TABLE_NAME);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_cache_invalidation
+  AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON users
+  FOR EACH STATEMENT EXECUTE FUNCTION notify_cache_invalidation();
+
+CREATE TRIGGER orders_items_cache_invalidation
+  AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON orders_items
+  FOR EACH STATEMENT EXECUTE FUNCTION notify_cache_invalidation();
+
+CREATE TRIGGER orders_histories_cache_invalidation
+  AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON orders_histories
+  FOR EACH STATEMENT EXECUTE FUNCTION notify_cache_invalidation();
@@ -0,0 +1,20 @@
+-- audit_log keeps who changed what, written in the same transaction as the
+-- change it records. Databases created from docker_postgres_init.sql already
+-- have it, so every statement is a no-op there.
+
+CREATE TABLE IF NOT EXISTS audit_log (
+  id SERIAL PRIMARY KEY,
+  actor_id INT,
+  actor_type VARCHAR(20) NOT NULL,
+  action VARCHAR(20) NOT NULL,
+  entity_type VARCHAR(50) NOT NULL,
+  entity_id INT NOT NULL,
+  changes JSONB,
+  request_id VARCHAR(64),
+  ip VARCHAR(64),
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor_id);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
@@ -0,0 +1,12 @@
+-- Users keep username and fullname encrypted, which is longer than the
+-- plaintext, and find a username by its blind index. Rows written before
+-- encryption are filled in by cmd/migrate, which holds the key the blind
+-- index needs.
+
+ALTER TABLE users
+  ALTER COLUMN username TYPE TEXT,
+  ALTER COLUMN fullname TYPE TEXT;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_bidx VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_bidx_key ON users (username_bidx);
@@ -0,0 +1,16 @@
+-- erasure_requests holds the requests to erase a user's personal data until
+-- another admin approves or rejects them. Databases created from
+-- docker_postgres_init.sql already have it.
+
+CREATE TABLE IF NOT EXISTS erasure_requests (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL,
+  requested_by INT,
+  reason VARCHAR(255),
+  status VARCHAR(20) NOT NULL,
+  approved_by INT,
+  approved_at TIMESTAMP,
+  completed_at TIMESTAMP,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
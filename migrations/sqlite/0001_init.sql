@@ -0,0 +1,71 @@
+-- SQLite has no starter script like project/docker_postgres_init.sql, so its
+-- first migration creates the whole schema. orders_histories isn't
+-- partitioned here and there is no archive.
+
+CREATE TABLE orders_items (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  price INTEGER NOT NULL,
+  expired_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME,
+  deleted_at DATETIME
+);
+
+CREATE TABLE users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username TEXT NOT NULL,
+  username_bidx VARCHAR(64) UNIQUE,
+  fullname TEXT NOT NULL,
+  first_order_id INTEGER REFERENCES orders_items(id),
+  password VARCHAR(100) NOT NULL,
+  role VARCHAR(10) NOT NULL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME,
+  deleted_at DATETIME
+);
+
+CREATE TABLE orders_histories (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  order_item_id INTEGER NOT NULL REFERENCES orders_items(id) ON DELETE CASCADE,
+  descriptions TEXT,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME,
+  deleted_at DATETIME
+);
+
+CREATE INDEX orders_histories_user_id_created_at_idx ON orders_histories (user_id, created_at);
+
+CREATE TABLE audit_log (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  actor_id INTEGER,
+  actor_type VARCHAR(20) NOT NULL,
+  action VARCHAR(20) NOT NULL,
+  entity_type VARCHAR(50) NOT NULL,
+  entity_id INTEGER NOT NULL,
+  changes TEXT,
+  request_id VARCHAR(64),
+  ip VARCHAR(64),
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_log_entity_idx ON audit_log (entity_type, entity_id);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor_id);
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
+
+CREATE TABLE erasure_requests (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  requested_by INTEGER,
+  reason VARCHAR(255),
+  status VARCHAR(20) NOT NULL,
+  approved_by INTEGER,
+  approved_at DATETIME,
+  completed_at DATETIME,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Same admin as the Postgres starter script, password "admin".
+INSERT INTO users (username, fullname, first_order_id, password, role, created_at)
+VALUES ('admin', 'admin', NULL, '$2a$12$ZR3sqMWXNcCEiTy.sJ1jkOC0DN75Pp2UN6oBH2ZdWHxskJcObfECi', 'admin', CURRENT_TIMESTAMP);
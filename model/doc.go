@@ -0,0 +1,4 @@
+// Package model holds the payloads, answers and errors of the API as they go
+// over the wire, for the client. It only depends on the standard library; the
+// database models and their validation rules are in package data.
+package model
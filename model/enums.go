@@ -0,0 +1,58 @@
+package model
+
+type UserRole string
+
+const (
+	Admin   UserRole = "admin"
+	User    UserRole = "user"
+	Retired UserRole = "retired"
+)
+
+type ActorType string
+
+const (
+	ActorUser   ActorType = "user"
+	ActorAPIKey ActorType = "api_key"
+	ActorSystem ActorType = "system"
+)
+
+type AuditAction string
+
+const (
+	AuditCreate AuditAction = "create"
+	AuditUpdate AuditAction = "update"
+	AuditDelete AuditAction = "delete"
+	AuditSignin AuditAction = "signin"
+	AuditErase  AuditAction = "erase"
+)
+
+type ErasureStatus string
+
+const (
+	ErasurePending   ErasureStatus = "pending"
+	ErasureCompleted ErasureStatus = "completed"
+	ErasureRejected  ErasureStatus = "rejected"
+)
+
+// Entities and formats of the exports, and the states of background export
+// jobs.
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatXLSX   = "xlsx"
+
+	ExportEntityUsers          = "users"
+	ExportEntityOrderItems     = "order_items"
+	ExportEntityOrderHistories = "order_histories"
+
+	ExportJobPending = "pending"
+	ExportJobRunning = "running"
+	ExportJobDone    = "done"
+	ExportJobFailed  = "failed"
+)
+
+// Formats order items can be imported from.
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+)
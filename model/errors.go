@@ -0,0 +1,118 @@
+package model
+
+import "errors"
+
+// ErrorKind is what went wrong from the caller's point of view, the API picks
+// the status code from it.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindBadRequest
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindUnavailable
+	KindNotImplemented
+)
+
+// Error is an error that can be shown to clients. Code is a stable machine
+// readable name and Message is safe to send, as are Fields, the invalid fields
+// of a Validation error. Err is the cause and is only logged.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors with the same Code, so a sentinel still matches after
+// Wrap added a cause to it.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of e caused by err.
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+func BadRequest(code string, message string) *Error {
+	return &Error{Kind: KindBadRequest, Code: code, Message: message}
+}
+
+func Validation(code string, message string) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message}
+}
+
+func Unauthorized(code string, message string) *Error {
+	return &Error{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+func Forbidden(code string, message string) *Error {
+	return &Error{Kind: KindForbidden, Code: code, Message: message}
+}
+
+func NotFound(code string, message string) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message}
+}
+
+func Conflict(code string, message string) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: message}
+}
+
+func Unavailable(code string, message string) *Error {
+	return &Error{Kind: KindUnavailable, Code: code, Message: message}
+}
+
+func NotImplemented(code string, message string) *Error {
+	return &Error{Kind: KindNotImplemented, Code: code, Message: message}
+}
+
+// ErrorKindOf returns the kind of err, KindInternal for errors that aren't an
+// *Error.
+func ErrorKindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindInternal
+}
+
+// FieldError is a field that broke one of its rules, Field is its JSON name.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// The errors callers match with errors.Is, on either side of the API.
+var (
+	ErrArchiveNotSupported   = NotImplemented("archive_not_supported", "order histories archive needs Postgres")
+	ErrUnknownExportEntity   = NotFound("unknown_export_entity", "unknown export entity, use users, order_items or order_histories")
+	ErrUnknownExportFormat   = Validation("unknown_export_format", "unknown export format, use csv, ndjson or xlsx")
+	ErrExportJobNotFound     = NotFound("export_job_not_found", "export job not found")
+	ErrExportJobsUnavailable = Unavailable("export_jobs_unavailable", "background exports need Redis, which is unavailable")
+	ErrUserRetired           = Forbidden("user_retired", "user is retired")
+	ErrErasureNotPending     = Conflict("erasure_not_pending", "erasure request is no longer pending")
+	ErrErasureSelfApproval   = Forbidden("erasure_self_approval", "an erasure request has to be approved by another admin")
+	ErrErasureAlreadyPending = Conflict("erasure_already_pending", "user already has a pending erasure request")
+	ErrInvalidCredentials    = Unauthorized("invalid_credentials", "username or password is wrong")
+)
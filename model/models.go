@@ -0,0 +1,69 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// NullableTime is how the API writes a time that may be unset.
+type NullableTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+type Users struct {
+	ID           int           `json:"id"`
+	Username     string        `json:"username"`
+	Fullname     string        `json:"fullname"`
+	FirstOrderId *int          `json:"first_order_id,omitempty"`
+	Password     string        `json:"password,omitempty"`
+	Role         UserRole      `json:"role"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    *NullableTime `json:"updated_at,omitempty"`
+	DeletedAt    *NullableTime `json:"deleted_at,omitempty"`
+}
+
+type OrdersItem struct {
+	ID        int           `json:"id"`
+	Name      string        `json:"name"`
+	Price     int           `json:"price"`
+	ExpiredAt time.Time     `json:"expired_at"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt *NullableTime `json:"updated_at,omitempty"`
+	DeletedAt *NullableTime `json:"deleted_at,omitempty"`
+}
+
+type OrdersHistories struct {
+	ID           int           `json:"id"`
+	UserId       int           `json:"user_id"`
+	OrderItemId  int           `json:"order_item_id"`
+	Descriptions *string       `json:"descriptions"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    *NullableTime `json:"updated_at,omitempty"`
+	DeletedAt    *NullableTime `json:"deleted_at,omitempty"`
+}
+
+type AuditLog struct {
+	ID         int             `json:"id"`
+	ActorID    *int            `json:"actor_id"`
+	ActorType  ActorType       `json:"actor_type"`
+	Action     AuditAction     `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   int             `json:"entity_id"`
+	Changes    json.RawMessage `json:"changes"`
+	RequestID  string          `json:"request_id"`
+	IP         string          `json:"ip"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type ErasureRequest struct {
+	ID          int           `json:"id"`
+	UserId      int           `json:"user_id"`
+	RequestedBy *int          `json:"requested_by"`
+	Reason      string        `json:"reason"`
+	Status      ErasureStatus `json:"status"`
+	ApprovedBy  *int          `json:"approved_by,omitempty"`
+	ApprovedAt  *NullableTime `json:"approved_at,omitempty"`
+	CompletedAt *NullableTime `json:"completed_at,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
@@ -0,0 +1,134 @@
+package model
+
+import "time"
+
+type InsertUserPayload struct {
+	Username string `json:"username"`
+	Fullname string `json:"fullname"`
+	Password string `json:"password"`
+}
+
+type UpdateUserPayload struct {
+	ID           int     `json:"id"`
+	Fullname     *string `json:"fullname"`
+	FirstOrderId *int    `json:"first_order_id,omitempty"`
+}
+
+type InsertOrderItemPayload struct {
+	Name      string    `json:"name"`
+	Price     int       `json:"price"`
+	ExpiredAt time.Time `json:"expired_at,omitempty"`
+}
+
+type UpdateOrderItemPayload struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Price     int       `json:"price"`
+	ExpiredAt time.Time `json:"expired_at,omitempty"`
+}
+
+type SigninPayload struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type JWTTokenPayload struct {
+	ID       int      `json:"id"`
+	Username string   `json:"username"`
+	Role     UserRole `json:"role"`
+}
+
+type InsertOrderHistoryPayload struct {
+	UserId       int     `json:"user_id"`
+	OrderItemId  int     `json:"order_item_id"`
+	Descriptions *string `json:"descriptions,omitempty"`
+}
+
+type ImportOrderItemsOptions struct {
+	Format string `json:"format"`
+	DryRun bool   `json:"dry_run"`
+	Upsert bool   `json:"upsert"`
+}
+
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type ImportReport struct {
+	DryRun   bool             `json:"dry_run"`
+	Applied  bool             `json:"applied"`
+	Total    int              `json:"total"`
+	Valid    int              `json:"valid"`
+	Inserted int              `json:"inserted"`
+	Updated  int              `json:"updated"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+type ExportFilter struct {
+	UserID *int `json:"user_id,omitempty"`
+	Page   int  `json:"page,omitempty"`
+	Limit  int  `json:"limit,omitempty"`
+}
+
+type ExportJob struct {
+	ID         string     `json:"id"`
+	Entity     string     `json:"entity"`
+	Format     string     `json:"format"`
+	Status     string     `json:"status"`
+	FileName   string     `json:"file_name"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type AuditLogFilter struct {
+	ActorID    *int        `json:"actor_id,omitempty"`
+	EntityType string      `json:"entity_type,omitempty"`
+	EntityID   *int        `json:"entity_id,omitempty"`
+	Action     AuditAction `json:"action,omitempty"`
+	From       *time.Time  `json:"from,omitempty"`
+	To         *time.Time  `json:"to,omitempty"`
+}
+
+// UserDataProfile is the part of Users handed out in a personal data export,
+// the password hash is left out on purpose.
+type UserDataProfile struct {
+	ID           int           `json:"id"`
+	Username     string        `json:"username"`
+	Fullname     string        `json:"fullname"`
+	FirstOrderId *int          `json:"first_order_id,omitempty"`
+	Role         UserRole      `json:"role"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    *NullableTime `json:"updated_at,omitempty"`
+	DeletedAt    *NullableTime `json:"deleted_at,omitempty"`
+}
+
+type UserDataBundle struct {
+	GeneratedAt     time.Time         `json:"generated_at"`
+	Profile         UserDataProfile   `json:"profile"`
+	OrdersHistories []OrdersHistories `json:"orders_histories"`
+	AuditLog        []AuditLog        `json:"audit_log"`
+	Sessions        []AuditLog        `json:"sessions"`
+}
+
+type InsertErasureRequestPayload struct {
+	UserId int    `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+type ArchivedOrderHistoryFilter struct {
+	UserID *int       `json:"user_id,omitempty"`
+	From   *time.Time `json:"from,omitempty"`
+	To     *time.Time `json:"to,omitempty"`
+}
+
+// CacheStats counts how cached reads were served: from the in-process cache,
+// from Redis or, on a miss, from the database. Not found rows cached for
+// entity lookups count as hits.
+type CacheStats struct {
+	LocalHits int64 `json:"local_hits"`
+	RedisHits int64 `json:"redis_hits"`
+	Misses    int64 `json:"misses"`
+}
@@ -1,7 +1,8 @@
 CREATE TABLE users (
   id SERIAL PRIMARY KEY,
-  username VARCHAR(255) NOT NULL UNIQUE,
-  fullname VARCHAR(255) NOT NULL,
+  username TEXT NOT NULL,
+  username_bidx VARCHAR(64) UNIQUE,
+  fullname TEXT NOT NULL,
   first_order_id INT,
   password VARCHAR(100) NOT NULL,
   role VARCHAR(10) NOT NULL,
@@ -35,3 +36,33 @@ CREATE TABLE orders_histories (
 
 INSERT INTO users (username,fullname, first_order_id, password, role, created_at, updated_at, deleted_at)
 VALUES ('admin','admin', null, '$2a$12$ZR3sqMWXNcCEiTy.sJ1jkOC0DN75Pp2UN6oBH2ZdWHxskJcObfECi', 'admin', NOW(), null, null);
+
+CREATE TABLE audit_log (
+  id SERIAL PRIMARY KEY,
+  actor_id INT,
+  actor_type VARCHAR(20) NOT NULL,
+  action VARCHAR(20) NOT NULL,
+  entity_type VARCHAR(50) NOT NULL,
+  entity_id INT NOT NULL,
+  changes JSONB,
+  request_id VARCHAR(64),
+  ip VARCHAR(64),
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX audit_log_entity_idx ON audit_log (entity_type, entity_id);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor_id);
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
+
+CREATE TABLE erasure_requests (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL,
+  requested_by INT,
+  reason VARCHAR(255),
+  status VARCHAR(20) NOT NULL,
+  approved_by INT,
+  approved_at TIMESTAMP,
+  completed_at TIMESTAMP,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
@@ -5,6 +5,7 @@ import (
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	config "gitlab.com/nezaysr/go-saham.git/config"
 )
 
@@ -12,7 +13,7 @@ var DB *gorm.DB
 
 func NewDB(params ...string) *gorm.DB {
 	var err error
-	conString := config.GetPostgresConnString()
+	conString := config.GetDBConnString()
 
 	log.Print(conString)
 
@@ -21,9 +22,19 @@ func NewDB(params ...string) *gorm.DB {
 		log.Panic(err)
 	}
 
+	if config.GetDBType() == config.DBTypeSQLite {
+		// SQLite allows one writer at a time, and every connection to an in
+		// memory database would otherwise get a database of its own.
+		DB.DB().SetMaxOpenConns(1)
+		return DB
+	}
+
+	openReplicas()
+
 	return DB
 }
 
+// GetDBInstance returns the primary, used for writes and transactions.
 func GetDBInstance() *gorm.DB {
 	return DB
 }
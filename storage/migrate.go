@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	config "gitlab.com/nezaysr/go-saham.git/config"
+	"gitlab.com/nezaysr/go-saham.git/migrations"
+)
+
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version VARCHAR(255) PRIMARY KEY,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// Migrate applies every migration for the configured database type that
+// hasn't been applied to DB yet. Each migration runs in its own transaction together with
+// its schema_migrations row.
+func Migrate() error {
+	if err := DB.Exec(createSchemaMigrations).Error; err != nil {
+		return err
+	}
+
+	dir := "postgres"
+	if config.GetDBType() == config.DBTypeSQLite {
+		dir = "sqlite"
+	}
+
+	names, err := fs.Glob(migrations.FS, dir+"/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(path.Base(name), ".sql")
+
+		var applied int
+		if err := DB.Table("schema_migrations").Where("version = ?", version).Count(&applied).Error; err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		script, err := fs.ReadFile(migrations.FS, name)
+		if err != nil {
+			return err
+		}
+
+		if err := applyMigration(version, string(script)); err != nil {
+			return err
+		}
+		log.Printf("Applied migration %s", version)
+	}
+
+	return nil
+}
+
+func applyMigration(version string, script string) error {
+	tx := DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := tx.Exec(script).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", version).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
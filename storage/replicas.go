@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	config "gitlab.com/nezaysr/go-saham.git/config"
+)
+
+const replicaCheckInterval = 5 * time.Second
+
+// replicaLagQuery reports whether the server is a standby, whether its WAL
+// receiver is streaming from the primary and how many seconds it is behind. A
+// replica that has replayed everything it received counts as not lagging, even
+// when the last replayed transaction is old because the primary has been idle.
+// The lag is NULL when it can't be known, on a primary or before anything was
+// replayed. The WAL receiver status needs the pg_read_all_stats role.
+const replicaLagQuery = `SELECT pg_is_in_recovery(),
+	EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE status = 'streaming'),
+	CASE
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+	END`
+
+type replica struct {
+	dsn     string
+	db      *gorm.DB
+	healthy int32
+}
+
+var (
+	replicas    []*replica
+	nextReplica uint32
+
+	recentWrites   = map[string]time.Time{}
+	recentWritesMu sync.Mutex
+)
+
+// openReplicas connects to every configured replica and starts checking their
+// health in the background. A replica that can't be reached at boot is kept
+// and retried by the health check instead of failing startup.
+func openReplicas() {
+	dsns := config.GetPostgresReplicaConnStrings()
+	if len(dsns) == 0 {
+		return
+	}
+
+	replicas = nil
+	for _, dsn := range dsns {
+		db, err := gorm.Open(config.GetDBType(), dsn)
+		if err != nil {
+			log.Printf("Failed to connect to replica: %v", err)
+		}
+		replicas = append(replicas, &replica{dsn: dsn, db: db})
+	}
+
+	checkReplicas()
+	go func() {
+		for range time.Tick(replicaCheckInterval) {
+			checkReplicas()
+		}
+	}()
+}
+
+func checkReplicas() {
+	maxLag := config.GetReplicaMaxLag()
+
+	for i, r := range replicas {
+		if r.db == nil {
+			db, err := gorm.Open(config.GetDBType(), r.dsn)
+			if err != nil {
+				atomic.StoreInt32(&r.healthy, 0)
+				continue
+			}
+			r.db = db
+		}
+
+		// A server that isn't a standby, isn't streaming or whose lag is
+		// unknown may be serving stale data, so it isn't used.
+		var inRecovery, streaming bool
+		var lag sql.NullFloat64
+		err := r.db.DB().QueryRow(replicaLagQuery).Scan(&inRecovery, &streaming, &lag)
+		lagSeconds := lag.Float64
+		healthy := err == nil && inRecovery && streaming && lag.Valid &&
+			time.Duration(lagSeconds*float64(time.Second)) <= maxLag
+
+		if wasHealthy := atomic.SwapInt32(&r.healthy, boolToInt32(healthy)) == 1; wasHealthy != healthy {
+			if healthy {
+				log.Printf("Replica %d is healthy again", i)
+			} else {
+				log.Printf("Skipping replica %d, in recovery %t, streaming %t, lag %.1fs (known %t), err %v", i, inRecovery, streaming, lagSeconds, lag.Valid, err)
+			}
+		}
+	}
+}
+
+// GetReadDBInstance returns a connection for read only queries. Reads are spread
+// over the healthy replicas and fall back to the primary when there are none.
+// pinKey identifies who is reading (e.g. "user:12"), reads by someone who just
+// wrote stay on the primary for the read-after-write window so they see their
+// own changes.
+func GetReadDBInstance(pinKey string) *gorm.DB {
+	if len(replicas) == 0 || isPinnedToPrimary(pinKey) {
+		return DB
+	}
+
+	start := atomic.AddUint32(&nextReplica, 1)
+	for i := 0; i < len(replicas); i++ {
+		r := replicas[(int(start)+i)%len(replicas)]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r.db
+		}
+	}
+
+	return DB
+}
+
+// MarkWrite starts the read-after-write window for pinKey.
+func MarkWrite(pinKey string) {
+	if pinKey == "" || len(replicas) == 0 {
+		return
+	}
+
+	now := time.Now()
+	window := config.GetReadAfterWriteWindow()
+
+	recentWritesMu.Lock()
+	defer recentWritesMu.Unlock()
+
+	recentWrites[pinKey] = now
+	for key, at := range recentWrites {
+		if now.Sub(at) > window {
+			delete(recentWrites, key)
+		}
+	}
+}
+
+func isPinnedToPrimary(pinKey string) bool {
+	if pinKey == "" {
+		return false
+	}
+
+	recentWritesMu.Lock()
+	defer recentWritesMu.Unlock()
+
+	at, ok := recentWrites[pinKey]
+	return ok && time.Since(at) <= config.GetReadAfterWriteWindow()
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}